@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// restoreIdle is how long a server must not have served a restore request before it switches what it serves
+const restoreIdle = time.Minute
+
+// serverActivityStruct tracks the restore requests of a server so it only moves to a newer catalog generation or scheduled dump between restores
+type serverActivityStruct struct {
+	mu       sync.Mutex
+	inFlight int
+	last     time.Time
+}
+
+// activityHandler records the requests of h. Probes, /status and the /generation checks of -watch clients are not restores and do not count.
+func activityHandler(a *serverActivityStruct, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/healthz", "/readyz", "/status", "/generation":
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		a.mu.Lock()
+		a.inFlight++
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			a.inFlight--
+			a.last = time.Now()
+			a.mu.Unlock()
+		}()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// idle returns true when no request is being served and none finished within quiet
+func (a *serverActivityStruct) idle(quiet time.Duration) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.inFlight == 0 && time.Since(a.last) >= quiet
+}
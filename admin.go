@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+)
+
+// adminMux serves profiling and other administrative endpoints. It is only reachable when an admin listener is started with -adminPort.
+var adminMux = http.NewServeMux()
+
+func init() {
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// startAdmin starts the admin listener in the background when a port is given
+func startAdmin(bind string, port string) {
+	if port == "" {
+		return
+	}
+
+	addr := net.JoinHostPort(bind, port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: Unable to start the admin listener on", addr, "-", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Admin endpoints listening on", addr)
+	go http.Serve(ln, adminMux)
+}
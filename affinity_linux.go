@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setAffinity pins every thread of the process to cpus, threads started later inherit the mask
+func setAffinity(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		err = unix.SchedSetaffinity(tid, &set)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
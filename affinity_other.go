@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+// setAffinity is only supported on Linux
+func setAffinity(cpus []int) error {
+	return fmt.Errorf("-cpus is only supported on Linux")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// analyzeQueueStruct collects the InnoDB tables restored with -analyzeAfter so their statistics are collected once all imports are done
+type analyzeQueueStruct struct {
+	mu     sync.Mutex
+	tables [][2]string
+}
+
+// analyzeQueue is the queue of tables analyzed after the restore, nil when tables are analyzed while they are locked for the import
+var analyzeQueue *analyzeQueueStruct
+
+// add queues a restored table to be analyzed after all imports complete
+func (q *analyzeQueueStruct) add(schema string, table string) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	q.tables = append(q.tables, [2]string{schema, table})
+	q.mu.Unlock()
+}
+
+// run analyzes every queued table without holding a write lock, a table that cannot be analyzed is still restored and only a warning is printed
+func (q *analyzeQueueStruct) run(db *sql.DB) {
+	if q == nil || len(q.tables) == 0 {
+		return
+	}
+
+	fmt.Println()
+	for _, t := range q.tables {
+		fqTable := addQuotes(t[0]) + "." + addQuotes(t[1])
+		start := time.Now()
+		_, err := execSQL(db, "analyze local table "+fqTable)
+		if err != nil {
+			warnf(levelWarn, "Unable to analyze %s.%s - %s", t[0], t[1], err)
+			continue
+		}
+		fmt.Println("Analyzed:", t[0]+"."+t[1], "in", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// assessTableStruct describes a target table a restore would replace
+type assessTableStruct struct {
+	schema   string
+	table    string
+	engine   string
+	rows     int64
+	size     int64
+	exists   bool
+	sessions []string
+	fks      []string
+	views    []string
+}
+
+// startAssess connects to the target read only and reports which existing tables a restore would drop, their row counts and sizes, sessions using them and foreign keys or views depending on them
+func startAssess(clientConfig clientConfigStruct, dbi *mysqlCredentials, w io.Writer) error {
+	db, err := dbi.connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	taburl := clientConfig.serverURL("tables") + "/"
+	manifest, manifestErr := fetchManifest(clientConfig.serverURL("manifest"))
+
+	// Tables the restore would replace, selected by the filter flags and under their -renameTables names exactly as a restore does
+	restored := make(map[string]bool)
+	var tables []*assessTableStruct
+	for _, schema := range servedSchemas(manifest, manifestErr, taburl) {
+		if !clientConfig.filter.schema(schema) {
+			continue
+		}
+
+		for _, file := range clientConfig.filter.selectTables(schema, servedTables(manifest, manifestErr, taburl, schema)) {
+			targetSchema, table := clientConfig.renames.target(schema, strings.TrimSuffix(file, sqlExtension))
+			restored[targetSchema+"."+table] = true
+			tables = append(tables, &assessTableStruct{schema: targetSchema, table: table})
+		}
+	}
+
+	for _, t := range tables {
+		var engine sql.NullString
+		var rows, size sql.NullInt64
+		err = db.QueryRow("select engine, table_rows, data_length + index_length from information_schema.tables where table_schema = ? and table_name = ?", t.schema, t.table).Scan(&engine, &rows, &size)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.exists, t.engine, t.rows, t.size = true, engine.String, rows.Int64, size.Int64
+
+		// Sessions running statements against the table
+		sessions, err := db.Query("select id, user, host, command, time, ifnull(info, '') from information_schema.processlist where id != connection_id() and (info like ? or (db = ? and info like ?))", "%"+t.schema+"%"+t.table+"%", t.schema, "%"+t.table+"%")
+		if err == nil {
+			for sessions.Next() {
+				var id, user, host, command, info string
+				var time int64
+				if sessions.Scan(&id, &user, &host, &command, &time, &info) == nil {
+					t.sessions = append(t.sessions, fmt.Sprintf("%s %s@%s %s %ds", id, user, host, command, time))
+				}
+			}
+			sessions.Close()
+		}
+
+		// Foreign keys of tables that are not restored would reference the replaced table
+		fks, err := db.Query("select distinct table_schema, table_name, constraint_name from information_schema.key_column_usage where referenced_table_schema = ? and referenced_table_name = ?", t.schema, t.table)
+		if err == nil {
+			for fks.Next() {
+				var schema, table, constraint string
+				if fks.Scan(&schema, &table, &constraint) == nil && !restored[schema+"."+table] {
+					t.fks = append(t.fks, schema+"."+table+" ("+constraint+")")
+				}
+			}
+			fks.Close()
+		}
+
+		// Views are matched by name in their definition since 5.x has no view dependency table
+		views, err := db.Query("select table_schema, table_name from information_schema.views where view_definition like ?", "%`"+t.schema+"`.`"+t.table+"`%")
+		if err == nil {
+			for views.Next() {
+				var schema, view string
+				if views.Scan(&schema, &view) == nil {
+					t.views = append(t.views, schema+"."+view)
+				}
+			}
+			views.Close()
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tACTION\tENGINE\tROWS (ESTIMATE)\tSIZE\tSESSIONS\tFK DEPENDENTS\tVIEW DEPENDENTS")
+	var dropped int
+	var droppedRows, droppedSize int64
+	for _, t := range tables {
+		if !t.exists {
+			fmt.Fprintf(tw, "%s.%s\tcreate\t\t\t\t\t\t\n", t.schema, t.table)
+			continue
+		}
+
+		dropped++
+		droppedRows += t.rows
+		droppedSize += t.size
+		fmt.Fprintf(tw, "%s.%s\tdrop & replace\t%s\t%d\t%s\t%s\t%s\t%s\n", t.schema, t.table, t.engine, t.rows, formatSize(t.size), strings.Join(t.sessions, "; "), strings.Join(t.fks, ", "), strings.Join(t.views, ", "))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%d tables restored, %d existing tables dropped with about %d rows and %s\n", len(tables), dropped, droppedRows, formatSize(droppedSize))
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// authToken is the -authToken shared secret the client sends with every trite server request, blank when the server does not require one
+var authToken string
+
+// setAuthHeader adds the -authToken bearer token to a trite server request
+func setAuthHeader(req *http.Request) {
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+}
+
+// authHandler rejects requests without the bearer token. The health probes stay open so orchestrators can check the server without the secret.
+func authHandler(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="trite"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The tuning flags of a restore are given to the test binary after -args so the benchmarks can be compared with and without them
+var (
+	benchSizes      = flag.String("benchSizes", "1,64,256", "Comma separated sizes in MB of the synthetic .ibd files")
+	benchGOGC       = flag.Int("gogc", 0, "Garbage collector target percentage")
+	benchCPUs       = flag.String("cpus", "", "CPUs trite is pinned to")
+	benchGzBlocks   = flag.Int("gzBlocks", gzBlocks, "Blocks decompressed ahead with -compress=gzip")
+	benchCopyBuffer = flag.Int("copyBuffer", copyBufferSize/1024, "Size in KB of the download buffers")
+)
+
+// benchPageSize is the InnoDB page size synthetic tablespaces are built from
+const benchPageSize = 16384
+
+// BenchmarkDownload measures the transfer path of a restore, synthetic .ibd files are served by the server mode handlers on loopback
+// and downloaded by downloadFiles into a memory backed datadir raw, verified against the server checksum and with each -compress codec.
+func BenchmarkDownload(b *testing.B) {
+	err := applyTuning(tuningStruct{gogc: *benchGOGC, cpus: *benchCPUs, gzBlocks: *benchGzBlocks, copyBuffer: *benchCopyBuffer})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Use memory backed directories so disk speed does not skew results
+	tmp := ""
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		tmp = "/dev/shm"
+	}
+	dir, err := ioutil.TempDir(tmp, "trite-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backupPath := filepath.Join(dir, "backup")
+	datadir := filepath.Join(dir, "datadir")
+	for _, d := range []string{filepath.Join(backupPath, "bench"), filepath.Join(datadir, "bench")} {
+		err = os.MkdirAll(d, 0755)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// The same seed makes the synthetic files identical between runs
+	var mbs []int
+	rnd := rand.New(rand.NewSource(1))
+	for _, s := range strings.Split(*benchSizes, ",") {
+		mb, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || mb <= 0 {
+			b.Fatal("-benchSizes must be a comma separated list of sizes in MB")
+		}
+		err = writeSyntheticIbd(filepath.Join(backupPath, "bench", "t"+strconv.Itoa(mb)+"mb.ibd"), int64(mb)*1048576, rnd)
+		if err != nil {
+			b.Fatal(err)
+		}
+		mbs = append(mbs, mb)
+	}
+
+	mux := http.NewServeMux()
+	handleBackups(mux, backupPath, etagHandler(backupPath, "", http.FileServer(http.Dir(backupPath))))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, transport := range []string{"none", "sums", "gzip", "zstd", "s2"} {
+		clientConfig := clientConfigStruct{quiet: true, filePerms: 0640, verifySums: transport == "sums"}
+		if _, ok := compressEndpoints[transport]; ok {
+			clientConfig.compress = transport
+		}
+
+		for _, mb := range mbs {
+			table := "t" + strconv.Itoa(mb) + "mb"
+			b.Run(transport+"/"+strconv.Itoa(mb)+"MB", func(b *testing.B) {
+				b.SetBytes(int64(mb) * 1048576)
+				for i := 0; i < b.N; i++ {
+					downloadInfo := downloadInfoStruct{
+						ctx:          context.Background(),
+						backurl:      ts.URL + "/backups/",
+						compressurl:  ts.URL + "/" + compressEndpoints[clientConfig.compress] + "/",
+						sumsurl:      ts.URL + "/sums/",
+						schema:       "bench",
+						table:        table,
+						sourceSchema: "bench",
+						sourceTable:  table,
+						mysqldir:     datadir,
+						extensions:   []string{".ibd"},
+						wgApply:      &sync.WaitGroup{},
+						applySlots:   make(chan struct{}, 1),
+					}
+					downloadInfo.applySlots <- struct{}{}
+
+					if !downloadFiles(clientConfig, &downloadInfo, trace.SpanFromContext(downloadInfo.ctx), make(map[string]headStruct), "bench", table) {
+						b.Fatal("Downloading", table, "over", transport, "failed")
+					}
+
+					b.StopTimer()
+					for _, file := range downloadInfo.triteFiles {
+						removeFile(file)
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+// writeSyntheticIbd writes a file of InnoDB sized pages which are half random and half repeated bytes, giving a compression ratio similar to real tablespaces
+func writeSyntheticIbd(file string, size int64, rnd *rand.Rand) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	page := make([]byte, benchPageSize)
+	for written := int64(0); written < size; written += benchPageSize {
+		rnd.Read(page[:benchPageSize/2])
+		for i := benchPageSize / 2; i < benchPageSize; i++ {
+			page[i] = byte(i % 64)
+		}
+
+		n := int64(benchPageSize)
+		if size-written < n {
+			n = size - written
+		}
+		_, err = w.Write(page[:n])
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// blockingPoll is how often a table in use is checked again while waiting for it
+const blockingPoll = time.Second
+
+var errApplyBlocked error
+
+// blockerStruct is another session using a table about to be dropped
+type blockerStruct struct {
+	id      string
+	user    string
+	command string
+	time    int64
+	info    string
+
+	// holdsLock is set when performance_schema shows the session holding a metadata lock on the table, only those sessions are killed
+	holdsLock bool
+}
+
+// killable returns true when -killBlocking may kill the session. Sessions only matched by their statement text, server threads and replication threads are never killed.
+func (b blockerStruct) killable() bool {
+	if !b.holdsLock {
+		return false
+	}
+
+	switch {
+	case b.user == "system user", b.user == "event_scheduler":
+		return false
+	case strings.HasPrefix(b.command, "Binlog Dump"), b.command == "Daemon", b.command == "Connect":
+		return false
+	}
+
+	return true
+}
+
+// String describes a blocking session for the display and error log
+func (b blockerStruct) String() string {
+	return fmt.Sprintf("id %s user %s %s for %ds %q", b.id, b.user, b.command, b.time, b.info)
+}
+
+// blockingSessions returns the other sessions using a table. Metadata locks from performance_schema (5.7+) are used when available, otherwise sessions running statements that mention the table.
+func blockingSessions(q sqlQueryer, schema string, table string) ([]blockerStruct, error) {
+	const columns = "p.id, p.user, p.command, p.time, ifnull(p.info, '')"
+
+	holdsLock := true
+	rows, err := q.Query("select distinct "+columns+" from performance_schema.metadata_locks ml join performance_schema.threads t on ml.owner_thread_id = t.thread_id join information_schema.processlist p on p.id = t.processlist_id where ml.object_type = 'TABLE' and ml.object_schema = ? and ml.object_name = ? and p.id != connection_id()", schema, table)
+	if err != nil {
+		holdsLock = false
+		rows, err = q.Query("select "+columns+" from information_schema.processlist p where p.id != connection_id() and p.command != 'Sleep' and p.info like ?", "%"+table+"%")
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+
+	var blockers []blockerStruct
+	for rows.Next() {
+		b := blockerStruct{holdsLock: holdsLock}
+		err = rows.Scan(&b.id, &b.user, &b.command, &b.time, &b.info)
+		if err != nil {
+			return nil, err
+		}
+		blockers = append(blockers, b)
+	}
+
+	return blockers, rows.Err()
+}
+
+// waitForTable waits until no other session uses a table so dropping it cannot hang on a metadata lock. Sessions holding a metadata lock on the table are killed with -killBlocking.
+// An error is returned once the timeout passes in both modes, such as when the remaining sessions may not be killed.
+func waitForTable(tx *sql.Tx, clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct) error {
+	if clientConfig.blockingTimeout <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(clientConfig.blockingTimeout)
+	announced := false
+	for {
+		blockers, err := blockingSessions(tx, downloadInfo.schema, downloadInfo.table)
+		if err != nil || len(blockers) == 0 {
+			return err
+		}
+
+		var described []string
+		for _, b := range blockers {
+			described = append(described, b.String())
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still in use after %s by %s", clientConfig.blockingTimeout, strings.Join(described, ", "))
+		}
+
+		if clientConfig.killBlocking {
+			for _, b := range blockers {
+				if !b.killable() {
+					continue
+				}
+				journal.printf("KILL", "%s.%s blocked by %s", downloadInfo.schema, downloadInfo.table, b)
+				execSQL(tx, "kill "+b.id)
+			}
+		}
+		if !announced {
+			downloadInfo.publish("Waiting for sessions using the table", nil)
+			announced = true
+		}
+
+		time.Sleep(blockingPoll)
+	}
+}
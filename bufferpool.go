@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// bufferPoolPerApply is the InnoDB buffer pool given to each table applied at once when -applyWorkers is not set
+const bufferPoolPerApply = 512 * 1048576
+
+// bufferPoolApplyWorkers derives how many tables are applied at once from innodb_buffer_pool_size, importing many tablespaces into a small buffer pool thrashes it.
+// The cap is one table per 512MB of buffer pool and never more than the database connections trite uses.
+func bufferPoolApplyWorkers(db *sql.DB, maxConnections int) int {
+	var ignore string
+	var bufferPool int64
+	err := db.QueryRow("show global variables like 'innodb_buffer_pool_size'").Scan(&ignore, &bufferPool)
+	if err != nil {
+		fmt.Println("Unable to read innodb_buffer_pool_size, applying up to", maxConnections, "tables at once -", err)
+		return maxConnections
+	}
+
+	workers := int(bufferPool / bufferPoolPerApply)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > maxConnections {
+		workers = maxConnections
+	}
+	fmt.Printf("InnoDB buffer pool is %s, applying up to %d tables at once (one per %s of buffer pool, at most -triteMaxConnections), set -applyWorkers to override\n", formatSize(bufferPool), workers, formatSize(bufferPoolPerApply))
+
+	return workers
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Generation subdirectories holding the structure dump and the prepared xtrabackup
+	generationDumpDir   = "dump"
+	generationBackupDir = "backup"
+
+	// servingFile marks a generation as in use by a running trite server
+	servingFile = ".trite_serving"
+
+	// catalogPoll is how often a server serving a catalog looks for a newer generation
+	catalogPoll = time.Minute
+
+	// xtrabackupTimeLayout is the format of the times in xtrabackup_info
+	xtrabackupTimeLayout = "2006-01-02 15:04:05"
+)
+
+// watchCatalog restarts the server once a generation newer than served appears in the catalog and no restore is running, so the new generation is served and -watch clients see it on /generation
+func watchCatalog(catalogPath string, served string, a *serverActivityStruct) {
+	var announced string
+	for {
+		time.Sleep(catalogPoll)
+
+		g, err := latestGeneration(catalogPath)
+		if err != nil || g.id == served {
+			continue
+		}
+		if announced != g.id {
+			if runtime.GOOS == "windows" {
+				fmt.Println(time.Now().Format(time.RFC3339), "Generation", g.id, "is newer than", served, "- restart the server to serve it")
+			} else {
+				fmt.Println(time.Now().Format(time.RFC3339), "Generation", g.id, "is newer than", served, "- restarting to serve it once no restore is running")
+			}
+			announced = g.id
+		}
+		if runtime.GOOS == "windows" || !a.idle(restoreIdle) {
+			continue
+		}
+
+		// The restarted server marks the generation it serves, the process id stays the same across the restart
+		os.Remove(filepath.Join(catalogPath, served, servingFile))
+		err = restartServer()
+		fmt.Fprintln(os.Stderr, "Unable to restart the server -", err)
+		os.Exit(1)
+	}
+}
+
+// generationStruct describes one backup generation in a catalog directory
+type generationStruct struct {
+	id         string
+	path       string
+	backupTime time.Time
+}
+
+// dumpPath returns the structure dump directory of a generation
+func (g generationStruct) dumpPath() string {
+	return filepath.Join(g.path, generationDumpDir)
+}
+
+// backupPath returns the xtrabackup directory of a generation
+func (g generationStruct) backupPath() string {
+	return filepath.Join(g.path, generationBackupDir)
+}
+
+// catalogGenerations returns all complete generations in a catalog directory ordered oldest to newest. A generation is a subdirectory containing both a dump and a backup directory.
+func catalogGenerations(catalogPath string) ([]generationStruct, error) {
+	dirs, err := ioutil.ReadDir(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []generationStruct
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+
+		g := generationStruct{id: dir.Name(), path: filepath.Join(catalogPath, dir.Name())}
+		if !isDir(g.dumpPath()) || !isDir(g.backupPath()) {
+			continue
+		}
+		g.backupTime = generationTime(g)
+
+		generations = append(generations, g)
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		if generations[i].backupTime.Equal(generations[j].backupTime) {
+			return generations[i].id < generations[j].id
+		}
+		return generations[i].backupTime.Before(generations[j].backupTime)
+	})
+
+	return generations, nil
+}
+
+// generationTime returns when the backup of a generation was taken. The generation directory mtime is not used since markers like the serving file change it.
+// The end_time in xtrabackup_info is used, or the modification time of xtrabackup_checkpoints with older xtrabackup versions.
+func generationTime(g generationStruct) time.Time {
+	info, err := readBackupInfo(g.backupPath())
+	if err == nil && info.EndTime != "" {
+		t, err := time.ParseInLocation(xtrabackupTimeLayout, info.EndTime, time.Local)
+		if err == nil {
+			return t
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(g.backupPath(), "xtrabackup_checkpoints"))
+	if err == nil {
+		return fi.ModTime()
+	}
+
+	fi, err = os.Stat(g.backupPath())
+	if err == nil {
+		return fi.ModTime()
+	}
+
+	return time.Time{}
+}
+
+// latestGeneration returns the newest generation in a catalog directory
+func latestGeneration(catalogPath string) (generationStruct, error) {
+	generations, err := catalogGenerations(catalogPath)
+	if err != nil {
+		return generationStruct{}, err
+	}
+
+	if len(generations) == 0 {
+		return generationStruct{}, fmt.Errorf("No backup generations with %s and %s directories found in %s", generationDumpDir, generationBackupDir, catalogPath)
+	}
+
+	return generations[len(generations)-1], nil
+}
+
+// markServing records the current process id in a generation so it is not pruned while being served
+func markServing(g generationStruct) error {
+	return ioutil.WriteFile(filepath.Join(g.path, servingFile), []byte(strconv.Itoa(os.Getpid())+"\n"), filePerms)
+}
+
+// isServing returns true if a running trite server has marked the generation as served
+func isServing(g generationStruct) bool {
+	b, err := ioutil.ReadFile(filepath.Join(g.path, servingFile))
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return false
+	}
+
+	return processAlive(pid)
+}
+
+// startPrune deletes catalog generations outside of the retention policy. A generation is kept when it is one of the keepLast newest generations
+// or younger than keepDays. The newest generation and generations being served are never deleted.
+func startPrune(catalogPath string, keepLast int, keepDays int) {
+	generations, err := catalogGenerations(catalogPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -keepDays)
+	var pruned int
+	for i, g := range generations {
+		newest := len(generations) - i
+		switch {
+		case newest == 1:
+			fmt.Println("Keeping", g.id, "(newest)")
+		case keepLast > 0 && newest <= keepLast:
+			fmt.Println("Keeping", g.id, "(keepLast)")
+		case keepDays > 0 && g.backupTime.After(cutoff):
+			fmt.Println("Keeping", g.id, "(keepDays)")
+		case isServing(g):
+			fmt.Println("Keeping", g.id, "(being served)")
+		default:
+			fmt.Println("Removing", g.id)
+			err = os.RemoveAll(g.path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "ERROR: Unable to remove", g.path, "-", err)
+				continue
+			}
+			pruned++
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(pruned, "of", len(generations), "generations removed")
+}
+
+// isDir returns true if path exists and is a directory
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatalogGenerations(t *testing.T) {
+	catalog, err := ioutil.TempDir("", "trite-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(catalog)
+
+	tests := []struct {
+		id      string
+		endTime string
+	}{
+		{"b", "2020-01-03 00:00:00"},
+		{"a", "2020-01-02 00:00:00"},
+		{"c", ""},
+		{"d", "2020-01-03 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		backup := filepath.Join(catalog, tt.id, generationBackupDir)
+		for _, dir := range []string{backup, filepath.Join(catalog, tt.id, generationDumpDir)} {
+			err = os.MkdirAll(dir, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = ioutil.WriteFile(filepath.Join(backup, "xtrabackup_checkpoints"), []byte("backup_type = full-prepared\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.endTime != "" {
+			err = ioutil.WriteFile(filepath.Join(backup, "xtrabackup_info"), []byte("end_time = "+tt.endTime+"\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Without xtrabackup_info the checkpoints modification time is used
+	checkpoints := filepath.Join(catalog, "c", generationBackupDir, "xtrabackup_checkpoints")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	err = os.Chtimes(checkpoints, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Marking a generation as served changes its directory mtime but not its order
+	generations, err := catalogGenerations(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = markServing(generations[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generations, err = catalogGenerations(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, g := range generations {
+		ids = append(ids, g.id)
+	}
+	if got := strings.Join(ids, ","); got != "c,a,b,d" {
+		t.Errorf("catalogGenerations ordered %s, expected c,a,b,d", got)
+	}
+}
+
+func TestIsServing(t *testing.T) {
+	catalog, err := ioutil.TempDir("", "trite-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(catalog)
+
+	// A process that has exited leaves its pid behind in the generation
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), childPasswordEnv+"=secret", "MYSQL_PWD=secret")
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exited := cmd.Process.Pid
+
+	tests := []struct {
+		id       string
+		serving  string
+		expected bool
+	}{
+		{"marked", strconv.Itoa(os.Getpid()), true},
+		{"unmarked", "", false},
+		{"exited", strconv.Itoa(exited), false},
+		{"garbage", "trite", false},
+	}
+
+	for _, tt := range tests {
+		g := generationStruct{id: tt.id, path: filepath.Join(catalog, tt.id)}
+		err = os.MkdirAll(g.path, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.serving != "" {
+			err = ioutil.WriteFile(filepath.Join(g.path, servingFile), []byte(tt.serving+"\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := isServing(g); got != tt.expected {
+			t.Errorf("%s: isServing = %t, expected %t", tt.id, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// chainInfoStruct describes the backup chain being served. BackupTime is the end time of the last backup applied and is when the served data is effective.
+type chainInfoStruct struct {
+	Full         backupInfoStruct   `json:"full"`
+	Incrementals []backupInfoStruct `json:"incrementals"`
+	BackupTime   string             `json:"backupTime"`
+	ToLSN        string             `json:"toLsn"`
+}
+
+// backupInfoStruct stores xtrabackup metadata for one backup in a chain
+type backupInfoStruct struct {
+	Path       string `json:"path"`
+	BackupType string `json:"backupType"`
+	FromLSN    string `json:"fromLsn"`
+	ToLSN      string `json:"toLsn"`
+	EndTime    string `json:"endTime"`
+}
+
+// readBackupInfo reads the xtrabackup metadata of a backup directory
+func readBackupInfo(dir string) (backupInfoStruct, error) {
+	info := backupInfoStruct{Path: dir}
+	checkpoints := filepath.Join(dir, "xtrabackup_checkpoints")
+
+	var err error
+	info.BackupType, err = xtrabackupValue(checkpoints, "backup_type")
+	if err != nil {
+		return info, err
+	}
+	info.FromLSN, _ = xtrabackupValue(checkpoints, "from_lsn")
+	info.ToLSN, _ = xtrabackupValue(checkpoints, "to_lsn")
+
+	// xtrabackup_info does not exist with older xtrabackup versions
+	info.EndTime, _ = xtrabackupValue(filepath.Join(dir, "xtrabackup_info"), "end_time")
+
+	return info, nil
+}
+
+// loadChain reads the metadata for a full backup and its incrementals. When prepare is true the incrementals are merged into the full backup with xtrabackup,
+// otherwise the chain must already have been merged.
+func loadChain(fullPath string, incrementalPaths []string, prepare bool) (chainInfoStruct, error) {
+	var chain chainInfoStruct
+	var err error
+
+	for _, incPath := range incrementalPaths {
+		inc, err := readBackupInfo(incPath)
+		if err != nil {
+			return chain, err
+		}
+		chain.Incrementals = append(chain.Incrementals, inc)
+	}
+
+	if prepare && len(incrementalPaths) > 0 {
+		err = prepareChain(fullPath, incrementalPaths)
+		if err != nil {
+			return chain, err
+		}
+	}
+
+	chain.Full, err = readBackupInfo(fullPath)
+	if err != nil {
+		return chain, err
+	}
+
+	// Incrementals must have been applied to the full backup up to the last incrementals lsn
+	last := chain.Full
+	if len(chain.Incrementals) > 0 {
+		last = chain.Incrementals[len(chain.Incrementals)-1]
+		if chain.Full.ToLSN != last.ToLSN {
+			return chain, fmt.Errorf("The full backup is at lsn %s but the last incremental is at lsn %s, merge the incrementals or use -prepareChain", chain.Full.ToLSN, last.ToLSN)
+		}
+	}
+
+	if chain.Full.BackupType != "full-prepared" {
+		return chain, fmt.Errorf("The full backup type is %s, it must be prepared with --apply-log --export or use -prepareChain", chain.Full.BackupType)
+	}
+
+	chain.BackupTime = last.EndTime
+	chain.ToLSN = last.ToLSN
+
+	return chain, nil
+}
+
+// prepareChain merges incremental backups into a full backup and prepares the result for transporting. The full backup is modified in place.
+func prepareChain(fullPath string, incrementalPaths []string) error {
+	fmt.Println("Preparing full backup", fullPath)
+	err := runXtrabackup("--prepare", "--apply-log-only", "--target-dir="+fullPath)
+	if err != nil {
+		return err
+	}
+
+	for i, incPath := range incrementalPaths {
+		fmt.Println("Applying incremental backup", incPath)
+		args := []string{"--prepare", "--target-dir=" + fullPath, "--incremental-dir=" + incPath}
+
+		// Only the last incremental rolls back uncommitted transactions
+		if i < len(incrementalPaths)-1 {
+			args = append(args, "--apply-log-only")
+		}
+
+		err = runXtrabackup(args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Exporting tablespaces")
+	return runXtrabackup("--prepare", "--export", "--target-dir="+fullPath)
+}
+
+// runXtrabackup runs xtrabackup with output sent to the terminal
+func runXtrabackup(args ...string) error {
+	cmd := exec.Command("xtrabackup", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("xtrabackup %v failed - %s", args, err)
+	}
+
+	return nil
+}
+
+// chainHandler serves the backup chain metadata as json
+func chainHandler(chain chainInfoStruct) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(chain)
+	}
+}
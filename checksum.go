@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// sumPool holds sha256 hashers so verifying downloads does not allocate a hasher per file
+var sumPool = sync.Pool{New: func() interface{} { return sha256.New() }}
+
+// sumReader hashes everything read through it so a download is verified without reading the file a second time
+type sumReader struct {
+	reader io.Reader
+	h      hash.Hash
+}
+
+// newSumReader wraps r with a pooled sha256 hasher
+func newSumReader(r io.Reader) *sumReader {
+	h := sumPool.Get().(hash.Hash)
+	h.Reset()
+
+	return &sumReader{reader: r, h: h}
+}
+
+func (s *sumReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.h.Write(p[:n])
+	return n, err
+}
+
+// sum returns the hex encoded checksum of the bytes read and returns the hasher to the pool
+func (s *sumReader) sum() string {
+	var b [sha256.Size]byte
+	sum := hex.EncodeToString(s.h.Sum(b[:0]))
+	sumPool.Put(s.h)
+
+	return sum
+}
+
+// sumHeader asks the server to hash the file while it is sent when the download is verified
+func sumHeader(header http.Header, verify bool) http.Header {
+	if verify {
+		header.Set(sumRequestHeader, "sha256")
+	}
+
+	return header
+}
+
+// fetchSumAsync fetches the checksum of a backup file while it downloads, the server answers once it has hashed the file it is sending
+func fetchSumAsync(ctx context.Context, url string) <-chan string {
+	c := make(chan string, 1)
+	go func() {
+		c <- fetchSum(ctx, url)
+	}()
+
+	return c
+}
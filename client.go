@@ -1,8 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,7 +11,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -20,7 +19,8 @@ import (
 	"time"
 
 	"github.com/joshuaprunier/mysqlUTF8"
-	"github.com/klauspost/pgzip"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"golang.org/x/net/html"
 )
@@ -33,34 +33,84 @@ type (
 		triteMaxConnections     int
 		errorLogFile            string
 		minDownloadProgressSize int64
-		gz                      bool
+		progressInterval        time.Duration
+		compress                string
+		maskRules               maskRulesMap
+		rowFilters              rowFiltersMap
+		renames                 renameMap
+		keepOld                 bool
+		downloadRetries         int
+		applyRetries            int
+		retryBackoff            time.Duration
+		undoDir                 string
+		journalFile             string
+		liveTables              []string
+		reportFile              string
+		lineOutput              bool
+		jsonOutput              io.Writer
+		quiet                   bool
+		diskSpace               string
+		targetDatadir           string
+		changedOnly             bool
+		skipAnalyze             bool
+		hooks                   *progressHooksStruct
+		analyzeAfter            bool
+		refreshStateFile        string
+		preflight               bool
+		caseMismatch            string
+		dedup                   bool
+		verifySums              bool
+		resume                  bool
+		downloadWorkers         int
+		applyWorkers            int
+		warmTables              []string
+		filter                  tableFilterStruct
+		sanitize                []string
+		strictDDL               bool
+		eventLog                string
+		metricsFile             string
+		allowMissingCfg         bool
+		filePerms               os.FileMode
+		datadirMap              datadirMapStruct
+		dataDirectories         []datadirMapStruct
+		logicalSource           *mysqlCredentials
+		blockingTimeout         time.Duration
+		mdlTimeout              time.Duration
+		killBlocking            bool
 	}
 
 	downloadInfoStruct struct {
+		ctx           context.Context
 		db            *sql.DB
 		taburl        string
 		backurl       string
-		gzurl         string
+		compressurl   string
+		sumsurl       string
 		schema        string
 		table         string
+		sourceSchema  string
+		sourceTable   string
 		encodedSchema string
 		encodedTable  string
 		mysqldir      string
+		dataDirectory string
+		fingerprint   *tableFingerprintStruct
+		session       map[string]string
 		uid           int
 		gid           int
 		engine        string
 		extensions    []string
 		triteFiles    []string
 		version       string
-		displayInfo   displayInfoStruct
-		displayChan   chan displayInfoStruct
+		events        *eventBusStruct
 		wgApply       *sync.WaitGroup
-	}
+		applySlots    chan struct{}
+		live          bool
+		keyring       bool
+		partitioned   bool
 
-	displayInfoStruct struct {
-		w       io.Writer
-		fqTable string
-		status  string
+		// lowerCaseFiles is set when the target has lower_case_table_names=1 and stores table files in lower case
+		lowerCaseFiles bool
 	}
 )
 
@@ -69,33 +119,98 @@ const (
 )
 
 var (
-	displayTable           string
-	errCount               int
-	errDownloadUnsupported error
-	errDownloadExp         error
-	errApplyDrop           error
-	errDownloadSize        error
-	errApplyCreate         error
-	errApplyDiscard        error
-	errApplyLock           error
-	errApplyRename         error
-	errApplyImport         error
-	errApplyAnalyze        error
-	errApplyUnlock         error
-	errObjectApply         error
+	displayTable             string
+	errCount                 int
+	errCountMu               sync.Mutex
+	errDownloadUnsupported   error
+	errDownloadDataDirectory error
+	errDownloadExp           error
+	errDownloadCfg           error
+	errApplyDrop             error
+	errDownloadSize          error
+	errDownloadChecksum      error
+	errDownloadChanged       error
+	errDownloadDecompress    error
+	errApplyCreate           error
+	errApplyDiscard          error
+	errApplyLock             error
+	errApplyRename           error
+	errApplyImport           error
+	errApplyAnalyze          error
+	errApplyUnlock           error
+	errObjectApply           error
 )
 
-// startClient is responsible for retrieving database creation satements and binary table files from a trite server instance.
-func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
+// startClient is responsible for retrieving database creation satements and binary table files from a trite server instance. The number of errors encountered is returned.
+func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) int {
+	defer exitOnPanic()
+
+	// Reset the error count and report for repeated runs in watch mode
+	errCount = 0
+	report = newReport(serverURL(clientConfig.triteServerURL, clientConfig.triteServerPort))
+	undo = nil
+	if clientConfig.undoDir != "" {
+		undo = newUndo(clientConfig.undoDir)
+	}
+	if clientConfig.skipAnalyze {
+		warnf(levelInfo, "Imported InnoDB tables are not analyzed, -skipAnalyze leaves their index statistics to MySQL")
+	}
+	analyzeQueue = nil
+	if clientConfig.analyzeAfter {
+		analyzeQueue = &analyzeQueueStruct{}
+	}
+	refreshState = nil
+	if clientConfig.changedOnly {
+		var err error
+		refreshState, err = loadRefreshState(clientConfig.refreshStateFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read the refresh state -", err)
+			fatalExit(1)
+		}
+	}
+
+	// Always keep an operation journal to help debug failed restores
+	err := openJournal(clientConfig.journalFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to create operation journal -", err)
+		fatalExit(1)
+	}
+	defer closeJournal()
+
+	// Error details are written by one goroutine so concurrent table errors stay readable
+	openErrorLog(clientConfig.errorLogFile)
+	defer closeErrorLog()
+
+	// Only the summary and errors are printed in quiet mode
+	stdout := os.Stdout
+	if clientConfig.quiet {
+		os.Stdout, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		checkErr(err)
+		defer func() {
+			os.Stdout.Close()
+			os.Stdout = stdout
+		}()
+	}
+
+	// Temporary files left by failed tables or an interrupted run are removed
+	keepPartials = clientConfig.resume
+	tempCleanup.Do(func() { onExit(cleanTempFiles) })
+	defer cleanTempFiles()
+
+	// The restore is traced when main has set up tracing for an OTLP endpoint
+	ctx, restoreSpan := tracer.Start(context.Background(), "restore", trace.WithAttributes(attribute.String("trite.server", clientConfig.triteServerURL)))
+	defer restoreSpan.End()
+
 	// Make a database connection
 	db, err := dbi.connect()
-	defer db.Close()
 
 	// Problem connecting to database
 	if err != nil {
+		journal.printf("ERROR", "%s", err)
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fatalExit(1)
 	}
+	defer db.Close()
 
 	// Check MySQL max_connections and set db driver accordingly
 	var ignore string
@@ -108,15 +223,20 @@ func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
 	} else {
 		fmt.Fprintln(os.Stderr, "MySQL max connections is lower than", clientConfig.triteMaxConnections)
 		fmt.Fprintln(os.Stderr, "Increase MySQL's max_connections variable or decrease triteMaxConnections")
-		os.Exit(1)
+		fatalExit(1)
 	}
 
 	db.SetMaxIdleConns(0)
 
+	// Importing many tablespaces at once into a small buffer pool thrashes it
+	if clientConfig.applyWorkers == 0 {
+		clientConfig.applyWorkers = bufferPoolApplyWorkers(db, clientConfig.triteMaxConnections)
+	}
+
 	// Problem connecting to database
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fatalExit(1)
 	}
 
 	// Detect MySQL version and set import flag for 5.1 & 5.5
@@ -125,89 +245,261 @@ func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
 	checkErr(err)
 
 	var importFlag string
+	var globals map[string]string
+	var restoreGlobals sync.Once
 	if strings.HasPrefix(version, "5.1") || strings.HasPrefix(version, "5.5") {
 		err = db.QueryRow("show global variables like '%innodb%import%'").Scan(&importFlag, &ignore)
 		checkErr(err)
 
-		_, err = db.Exec("set global " + importFlag + "=1")
+		// The import flag is set back to its original value when the restore ends, is interrupted or fails
+		globals = saveVariables(db, "global", importFlag)
+		onExit(func() { restoreGlobals.Do(func() { restoreVariables(db, "global", globals) }) })
+		_, err = execSQL(db, "set global "+importFlag+"=1")
 		checkErr(err)
-	} else if strings.HasPrefix(version, "5.6") || strings.HasPrefix(version, "10") {
-		// No import flag for 5.6 or MariaDB 10
+	} else if strings.HasPrefix(version, "5.6") || strings.HasPrefix(version, "5.7") || strings.HasPrefix(version, "10") {
+		// No import flag for 5.6, 5.7 or MariaDB 10
 	} else {
-		fmt.Fprintln(os.Stderr, version, "is not supported")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "MySQL", version, "is not supported, trite restores to MySQL 5.1, 5.5, 5.6, 5.7 and MariaDB 10")
+		fatalExit(1)
 	}
 
+	// Encrypted 5.7 tablespaces can only be imported with a keyring plugin loaded
+	keyring := keyringActive(db)
+
 	// Get MySQL datadir
 	var mysqldir string
 	err = db.QueryRow("show variables like 'datadir'").Scan(&ignore, &mysqldir)
 	checkErr(err)
 
-	// Make sure mysql datadir is writable
-	err = ioutil.WriteFile(mysqldir+"/trite_test", []byte("delete\n"), mysqlPerms)
-	if err != nil {
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, "The MySQL data directory is not writable as this user!")
-		fmt.Fprintln(os.Stderr)
-		os.Exit(1)
+	// Logical mode never touches the datadir, rows are copied from the source database instead
+	var logicalSource *sql.DB
+	if clientConfig.logicalSource != nil {
+		logicalSource, err = clientConfig.logicalSource.connect()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to connect to the logical source database -", err)
+			fatalExit(1)
+		}
+		defer logicalSource.Close()
+		fmt.Println("Logical mode: tables are copied over SQL from the source database without writing to the datadir")
 	} else {
-		os.Remove(mysqldir + "/trite_test")
+		// A containerized MySQL reports the datadir path inside the container, -targetDatadir replaces the reported path when it is reached through a symlink or another mount
+		reportedDatadir := mysqldir
+		if clientConfig.targetDatadir != "" {
+			mysqldir = clientConfig.targetDatadir
+		} else {
+			// A datadir found in container mounts must belong to this instance, 5.1 and 5.5 have no server_uuid and need -datadirMap
+			var serverUUID string
+			db.QueryRow("select @@server_uuid").Scan(&serverUUID)
+
+			mysqldir, err = resolveDatadir(mysqldir, clientConfig.datadirMap, serverUUID)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fatalExit(1)
+			}
+		}
+
+		// DATA DIRECTORY paths in create statements are the paths MySQL sees, the datadir is translated like the path reported for it
+		clientConfig.dataDirectories = append([]datadirMapStruct{{container: filepath.Clean(reportedDatadir), host: mysqldir}}, clientConfig.dataDirectories...)
+
+		// Restored files are owned like the files already in the datadir unless -fileOwner/-fileGroup are given
+		detectFileOwner(dbi, mysqldir)
+
+		// Make sure mysql datadir is writable
+		testFile := filepath.Join(mysqldir, "trite_test"+triteExtension)
+		err = ioutil.WriteFile(testFile, []byte("delete\n"), clientConfig.filePerms)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, "The MySQL data directory is not writable as this user!")
+			if clientConfig.datadirMap.container != "" {
+				fmt.Fprintln(os.Stderr, "Check", mysqldir, "is the host path -datadirMap should point to and is mounted read-write -", err)
+			}
+			fmt.Fprintln(os.Stderr)
+			fatalExit(1)
+		} else {
+			removeFile(testFile)
+		}
 	}
 
 	// URL variables
-	taburl := "http://" + clientConfig.triteServerURL + ":" + clientConfig.triteServerPort + "/tables/"
-	backurl := "http://" + clientConfig.triteServerURL + ":" + clientConfig.triteServerPort + "/backups/"
-	gzurl := "http://" + clientConfig.triteServerURL + ":" + clientConfig.triteServerPort + "/gz/"
+	taburl := clientConfig.serverURL("tables") + "/"
+	backurl := clientConfig.serverURL("backups") + "/"
+	compressurl := clientConfig.serverURL(compressEndpoints[clientConfig.compress]) + "/"
+	sumsurl := clientConfig.serverURL("sums") + "/"
 
-	// Verify server urls are accessible
+	// Verify server urls are accessible, logical mode does not need backup files
 	urls := []string{taburl, backurl}
+	if logicalSource != nil {
+		urls = urls[:1]
+	}
 	for _, url := range urls {
-		_, err = http.Head(url)
+		_, err = httpHead(url)
 		if err != nil {
 			fmt.Fprintln(os.Stderr)
 			fmt.Fprintln(os.Stderr)
 			fmt.Fprintln(os.Stderr, "Problem connecting to", url)
 			fmt.Fprintln(os.Stderr, "Check that the server is running, port number is correct or that a firewall is not blocking access")
-			os.Exit(1)
+			fatalExit(1)
 		}
 	}
 
-	// Get a list of schemas from the trite server
-	base, err := http.Get(taburl)
-	checkHTTP(base, taburl)
-	defer base.Body.Close()
-	checkErr(err)
+	// Dump only servers can only be restored logically and backups only servers have no create statements, older servers do not say
+	manifest, manifestErr := fetchManifest(clientConfig.serverURL("manifest"))
+	if manifestErr == nil {
+		if manifest.BackupsOnly {
+			fmt.Fprintln(os.Stderr, "The trite server at", clientConfig.triteServerURL, "only serves backup files, a structure dump (-dumpPath) is needed to restore")
+			fatalExit(1)
+		}
+		if manifest.DumpOnly && logicalSource == nil && len(clientConfig.liveTables) == 0 {
+			fmt.Fprintln(os.Stderr, "The trite server at", clientConfig.triteServerURL, "only serves a structure dump, use -logicalSourceDsn to copy the rows or serve a backup with -backupPath")
+			fatalExit(1)
+		}
+	}
+
+	// Dump files are verified against the checksums written by dump mode, older dumps have none
+	dumpSums, err = loadDumpSums(taburl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read the dump checksums -", err)
+		fatalExit(1)
+	}
+
+	// Display when the backup being restored was taken, older servers do not provide chain metadata
+	chainURL := clientConfig.serverURL("chain")
+	chainResp, err := httpGet(chainURL)
+	if err == nil {
+		var chain chainInfoStruct
+		if chainResp.StatusCode == 200 && json.NewDecoder(chainResp.Body).Decode(&chain) == nil && chain.BackupTime != "" {
+			fmt.Println("Restoring backup taken at", chain.BackupTime, "( lsn", chain.ToLSN, ")")
+			fmt.Println()
+		}
+		chainResp.Body.Close()
+	}
+
+	// Preflight only confirms the restore can be started
+	if clientConfig.preflight {
+		fmt.Println("Preflight checks passed")
+		return 0
+	}
+
+	// Keep small downloaded files so identical tables are copied locally
+	if clientConfig.dedup {
+		err = openDedup()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to create the deduplication directory -", err)
+			fatalExit(1)
+		}
+		defer closeDedup()
+	}
+
+	// Get a list of schemas from the trite server manifest, servers without one are read from the directory listing. Only live exported tables are restored when they are requested.
+	var schemas []string
+	if len(clientConfig.liveTables) == 0 {
+		served := servedSchemas(manifest, manifestErr, taburl)
+
+		// Only schemas selected by the filter flags are restored
+		for _, schema := range served {
+			if clientConfig.filter.schema(schema) {
+				schemas = append(schemas, schema)
+			}
+		}
 
-	schemas := parseAnchor(base)
+		if len(schemas) < len(served) {
+			fmt.Println("Restoring", len(schemas), "of", len(served), "schemas served by", clientConfig.triteServerURL)
+		}
+	}
 
-	// Start up download workers
+	// Start up download workers, a table takes an apply slot before it is downloaded and gives it back once it is applied so downloaded files do not pile up waiting for a connection
 	var wgDownload sync.WaitGroup
 	dl := make(chan downloadInfoStruct)
-	go func() {
-		for d := range dl {
-			downloadTable(clientConfig, d)
-			wgDownload.Done()
-		}
-	}()
+	applySlots := make(chan struct{}, clientConfig.applyWorkers)
+	for i := 0; i < clientConfig.downloadWorkers; i++ {
+		go func() {
+			defer exitOnPanic()
+			for d := range dl {
+				applySlots <- struct{}{}
+				if d.live {
+					downloadLiveTable(clientConfig, d)
+				} else if logicalSource != nil {
+					copyTableLogical(clientConfig, logicalSource, d)
+				} else {
+					downloadTable(clientConfig, d)
+				}
+				wgDownload.Done()
+			}
+		}()
+	}
 
-	// Single thread display info from concurrent processes
-	displayChan := make(chan displayInfoStruct)
-	go display(displayChan)
+	// Table status events are consumed by the display, the report and the optional event log. Quiet mode only displays errors and progress hooks replace the display.
+	events := newEventBus()
+	if clientConfig.hooks != nil {
+		events.subscribe(clientConfig.hooks.consume)
+	} else if clientConfig.quiet {
+		events.subscribe(displayErrors)
+	} else if clientConfig.jsonOutput != nil {
+		events.subscribe(displayJSON(clientConfig.jsonOutput))
+	} else if clientConfig.lineOutput {
+		events.subscribe(displayLines)
+	} else {
+		events.subscribe(display)
+	}
+	events.subscribe(reportEvents)
+	if clientConfig.eventLog != "" {
+		logger, err := eventLogger(clientConfig.eventLog)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to open event log -", err)
+			fatalExit(1)
+		}
+		events.subscribe(logger)
+	}
+	if clientConfig.metricsFile != "" {
+		exporter, err := metricsExporter(clientConfig.metricsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to write the metrics file -", err)
+			fatalExit(1)
+		}
+		events.subscribe(exporter)
+	}
 
 	// Apply wait group
 	var wgApply sync.WaitGroup
 
+	// Get the list of tables to transport for every schema before anything is changed
+	schemaTables := make(map[string][]string)
+	var served, selected int
+	for _, schema := range schemas {
+		tables := servedTables(manifest, manifestErr, taburl, schema)
+		served += len(tables)
+		if tables = clientConfig.filter.selectTables(schema, tables); len(tables) > 0 {
+			schemaTables[schema] = tables
+			selected += len(tables)
+		}
+	}
+	if selected < served {
+		fmt.Println("Restoring", selected, "of", served, "tables in the selected schemas")
+	}
+
+	// Names with upper case letters from a case sensitive source are stored in lower case files by the target
+	lowerCaseFiles, err := checkLowerCaseNames(db, clientConfig.caseMismatch, schemas, schemaTables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fatalExit(1)
+	}
+
+	// Show how much data each schema will transfer
+	sizes, sizesErr := fetchSizes(clientConfig.serverURL("sizes"))
+	if len(schemas) > 0 && sizesErr == nil {
+		printRestorePlan(sizes, schemas, schemaTables)
+	}
+
+	// A restore that cannot fit in the datadir is stopped before any table is dropped, logical mode does not write files
+	if logicalSource == nil {
+		checkDiskSpace(clientConfig, mysqldir, restoreSize(sizes, sizesErr, backurl, schemas, schemaTables))
+	}
+
 	// Loop through all schemas and apply tables
 	for _, schema := range schemas {
 		// Check if schema exists
-		checkSchema(db, schema, taburl+path.Join(schema, schema+sqlExtension))
-
-		// Parse html and get a list of tables to transport
-		tablesDir, err := http.Get(taburl + path.Join(schema, "tables"))
-		checkHTTP(tablesDir, taburl+path.Join(schema, "tables"))
-		defer tablesDir.Body.Close()
-		checkErr(err)
-		tables := parseAnchor(tablesDir)
+		checkSchema(db, schema, joinURL(taburl, schema, schema+sqlExtension), schema+"/"+schema+sqlExtension)
+		tables := schemaTables[schema]
 
 		// ignore when path is empty
 		if len(tables) > 0 {
@@ -215,26 +507,39 @@ func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
 				wgDownload.Add(1)
 				wgApply.Add(1)
 				downloadInfo := downloadInfoStruct{
-					db:          db,
-					taburl:      taburl,
-					backurl:     backurl,
-					gzurl:       gzurl,
-					schema:      schema,
-					table:       table[:len(table)-4],
-					mysqldir:    mysqldir,
-					uid:         dbi.uid,
-					gid:         dbi.gid,
-					version:     version,
-					displayChan: displayChan,
-					wgApply:     &wgApply,
+					ctx:            ctx,
+					db:             db,
+					taburl:         taburl,
+					backurl:        backurl,
+					compressurl:    compressurl,
+					sumsurl:        sumsurl,
+					schema:         schema,
+					table:          strings.TrimSuffix(table, sqlExtension),
+					sourceSchema:   schema,
+					sourceTable:    strings.TrimSuffix(table, sqlExtension),
+					mysqldir:       mysqldir,
+					uid:            dbi.uid,
+					gid:            dbi.gid,
+					version:        version,
+					keyring:        keyring,
+					events:         events,
+					wgApply:        &wgApply,
+					applySlots:     applySlots,
+					lowerCaseFiles: lowerCaseFiles,
 				}
 
 				// Do filename encoding for schema and table if needed
-				if mysqlUTF8.NeedsEncoding(downloadInfo.schema) {
-					downloadInfo.encodedSchema = mysqlUTF8.EncodeFilename(downloadInfo.schema)
+				if mysqlUTF8.NeedsEncoding(downloadInfo.sourceSchema) {
+					downloadInfo.encodedSchema = mysqlUTF8.EncodeFilename(downloadInfo.sourceSchema)
 				}
-				if mysqlUTF8.NeedsEncoding(downloadInfo.table) {
-					downloadInfo.encodedTable = mysqlUTF8.EncodeFilename(downloadInfo.table)
+				if mysqlUTF8.NeedsEncoding(downloadInfo.sourceTable) {
+					downloadInfo.encodedTable = mysqlUTF8.EncodeFilename(downloadInfo.sourceTable)
+				}
+
+				// Tables in the rename file are restored under their new name, the files are still downloaded by the served name
+				downloadInfo.schema, downloadInfo.table = clientConfig.renames.target(downloadInfo.sourceSchema, downloadInfo.sourceTable)
+				if downloadInfo.schema != schema {
+					createRenameSchema(db, downloadInfo.schema)
 				}
 
 				// Send downloadInfo into channel and begin download
@@ -242,13 +547,63 @@ func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
 			}
 		}
 	}
+
+	// Queue tables exported live from the source database
+	exporturl := clientConfig.serverURL("export") + "/"
+	for _, fqTable := range clientConfig.liveTables {
+		names := strings.SplitN(fqTable, ".", 2)
+		if len(names) != 2 {
+			fmt.Fprintln(os.Stderr, fqTable, "must be in schema.table format")
+			fatalExit(1)
+		}
+
+		checkSchema(db, names[0], joinURL(exporturl, names[0], names[0]+sqlExtension), "")
+
+		wgDownload.Add(1)
+		wgApply.Add(1)
+		downloadInfo := downloadInfoStruct{
+			ctx:          ctx,
+			db:           db,
+			taburl:       exporturl,
+			schema:       names[0],
+			table:        names[1],
+			sourceSchema: names[0],
+			sourceTable:  names[1],
+			mysqldir:     mysqldir,
+			uid:          dbi.uid,
+			gid:          dbi.gid,
+			version:      version,
+			keyring:      keyring,
+			events:       events,
+			wgApply:      &wgApply,
+			applySlots:   applySlots,
+			live:         true,
+		}
+		if mysqlUTF8.NeedsEncoding(downloadInfo.schema) {
+			downloadInfo.encodedSchema = mysqlUTF8.EncodeFilename(downloadInfo.schema)
+		}
+
+		dl <- downloadInfo
+	}
+
 	wgDownload.Wait()
+	close(dl)
 	wgApply.Wait()
+	events.close()
+
+	// Collect the statistics of tables restored with -analyzeAfter
+	analyzeQueue.run(db)
+
+	// Read hot tables into the buffer pool
+	if len(clientConfig.warmTables) > 0 {
+		fmt.Println()
+		warmBufferPool(db, clientConfig.warmTables)
+	}
 
-	// Loop through all schemas again and apply triggers, views, procedures & functions
+	// Loop through all schemas again and apply triggers, views, procedures, functions & events
 	time.Sleep(1 * time.Millisecond)
 	fmt.Println()
-	objectTypes := []string{"trigger", "view", "procedure", "function"}
+	objectTypes := []string{"trigger", "view", "procedure", "function", "event"}
 	for _, schema := range schemas {
 		for _, objectType := range objectTypes {
 			applyObjects(db, clientConfig, objectType, schema, taburl)
@@ -256,43 +611,65 @@ func startClient(clientConfig clientConfigStruct, dbi *mysqlCredentials) {
 	}
 
 	// Reset global db variables
-	if importFlag != "" {
-		_, err = db.Exec("set global " + importFlag + "=0")
+	restoreGlobals.Do(func() { err = restoreVariables(db, "global", globals) })
+	if err != nil {
+		warnf(levelError, "Unable to restore the global variables - %s", err)
 	}
 
 	errCount := getErrCount()
 	if errCount > 0 {
 		// Add spacing to error log to make multiple runs easier to read
-		f, err := os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_APPEND, 0644)
-		checkErr(err)
-
-		l := log.New(f, "", log.LstdFlags)
+		var b bytes.Buffer
+		l := log.New(&b, "", log.LstdFlags)
+		l.Println("Operation journal for this run:", clientConfig.journalFile)
 		for i := 0; i < 10; i++ {
 			l.Println()
 		}
-		f.Close()
+		errorLog.queue(b.Bytes())
 
 		// Print to stdout an alert that errors ere encountered during processing
-		fmt.Println()
-		fmt.Println("! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ")
-		fmt.Println(errCount, "errors were encountered")
-		fmt.Println("Check", clientConfig.errorLogFile, "for more details")
-		fmt.Println("! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ")
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, "! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ")
+		fmt.Fprintln(stdout, errCount, "errors were encountered")
+		fmt.Fprintln(stdout, "Check", clientConfig.errorLogFile, "for more details")
+		fmt.Fprintln(stdout, "Include", clientConfig.errorLogFile, "and", clientConfig.journalFile, "when reporting a problem")
+		fmt.Fprintln(stdout, "! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ! ")
 	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, report.summary())
+
+	if clientConfig.reportFile != "" {
+		err = report.write(clientConfig.reportFile, errCount)
+		if err != nil {
+			warnf(levelError, "Unable to write the restore report - %s", err)
+		}
+	}
+
+	// Undo scripts revert each schema to how it was before the restore
+	undo.summary()
+
+	// The next -changedOnly refresh compares tables with what was restored by this one
+	err = refreshState.write()
+	if err != nil {
+		warnf(levelError, "Unable to write the refresh state - %s", err)
+	}
+
+	return errCount
 }
 
 // getErrCount returns the number of errors encountered
 func getErrCount() int {
+	errCountMu.Lock()
+	defer errCountMu.Unlock()
+
 	return errCount
 }
 
 // incErrCount increases the error count
 func incErrCount() {
-	var mu sync.Mutex
-
-	mu.Lock()
+	errCountMu.Lock()
 	errCount++
-	mu.Unlock()
+	errCountMu.Unlock()
 }
 
 // getDisplayTable returns the current table name being displayed
@@ -313,8 +690,64 @@ func setDisplayTable(table string) {
 func checkHTTP(r *http.Response, url string) {
 	if r.StatusCode != 200 {
 		fmt.Println(r.StatusCode, "returned from:", url)
-		os.Exit(1)
+		fatalExit(1)
+	}
+}
+
+// servedSchemas returns the schemas in the structure dump from the manifest, or from the directory listing of servers without a manifest
+func servedSchemas(manifest manifestStruct, manifestErr error, taburl string) []string {
+	var schemas []string
+	if manifestErr == nil {
+		for _, schema := range manifest.Schemas {
+			schemas = append(schemas, schema.Name)
+		}
+
+		return schemas
+	}
+
+	base, err := httpGet(taburl)
+	checkHTTP(base, taburl)
+	defer base.Body.Close()
+	checkErr(err)
+
+	// The dump checksums file is the only file in the dump root
+	for _, name := range parseAnchor(base) {
+		if name != dumpSumsFile {
+			schemas = append(schemas, name)
+		}
+	}
+
+	return schemas
+}
+
+// servedTables returns the create statement files of a schema from the manifest, or from the directory listing of servers without a manifest
+func servedTables(manifest manifestStruct, manifestErr error, taburl string, schema string) []string {
+	var tables []string
+	if manifestErr == nil {
+		for _, s := range manifest.Schemas {
+			if s.Name == schema {
+				for _, table := range s.Tables {
+					tables = append(tables, table.Name+sqlExtension)
+				}
+			}
+		}
+
+		return tables
+	}
+
+	tablesDir, err := httpGet(dirURL(taburl, schema, "tables"))
+	checkHTTP(tablesDir, dirURL(taburl, schema, "tables"))
+	defer tablesDir.Body.Close()
+	checkErr(err)
+
+	// Only create statement files name a table
+	for _, table := range parseAnchor(tablesDir) {
+		if strings.HasSuffix(table, sqlExtension) {
+			tables = append(tables, table)
+		}
 	}
+
+	return tables
 }
 
 // parseAnchor returns a string slice list of objects from an http.FileServer(). Trailing forward slashes from directories are removed.
@@ -328,10 +761,17 @@ func parseAnchor(r *http.Response) []string {
 			break
 		}
 
+		// Text is unescaped so names containing characters such as & or < are returned as they are on disk
 		if tt == html.TextToken {
-			a := tok.Raw()
-			if a[0] != 10 {
-				txt = append(txt, string(bytes.Trim(a, "/")))
+			a := tok.Text()
+			if len(bytes.Trim(a, "\n")) == 0 {
+				continue
+			}
+
+			// Never follow names that could escape the MySQL data directory
+			name := string(bytes.Trim(a, "/"))
+			if validObjectName(name) {
+				txt = append(txt, name)
 			}
 		}
 	}
@@ -339,60 +779,128 @@ func parseAnchor(r *http.Response) []string {
 }
 
 // checkSchema creates a schema if it does not already exist
-func checkSchema(db *sql.DB, schema string, schemaCreateURL string) {
+func checkSchema(db *sql.DB, schema string, schemaCreateURL string, dumpFile string) {
 	var exists string
 	err := db.QueryRow("show databases like '" + schema + "'").Scan(&exists)
 
 	if err != nil {
-		resp, err := http.Get(schemaCreateURL)
+		resp, err := httpGet(schemaCreateURL)
 		checkHTTP(resp, schemaCreateURL)
 		defer resp.Body.Close()
 		checkErr(err)
 
 		stmt, _ := ioutil.ReadAll(resp.Body)
-		_, err = db.Exec(string(stmt))
+
+		// Statements from the server are run as they are so only a single create database statement is accepted
+		if dumpFile != "" {
+			err = dumpSums.verify(dumpFile, stmt)
+		}
+		if err == nil {
+			err = checkCreateStatement(string(stmt), "database")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Schema", schema, "was not created -", err)
+			fatalExit(1)
+		}
+		_, err = execSQL(db, string(stmt))
 		checkErr(err)
+		err = undo.createdSchema(schema)
+		if err != nil {
+			warnf(levelError, "Unable to add schema %s to the undo script - %s", schema, err)
+		}
+	}
+}
+
+// displayLines prints every display event on its own line for logs and terminals without carriage return support
+func displayLines(events <-chan tableEventStruct) {
+	for e := range events {
+		fmt.Fprintf(os.Stdout, "%s %s\n", e.Time.Format(time.RFC3339), e.line())
+	}
+}
+
+// displayErrors prints tables that could not be restored to stderr for quiet mode
+func displayErrors(events <-chan tableEventStruct) {
+	for e := range events {
+		if e.Status == statusError {
+			fmt.Fprintf(os.Stderr, "%s %s: %s - %s\n", e.Time.Format(time.RFC3339), e.Status, e.fqTable(), e.Error)
+		}
+	}
+}
+
+// publish sends a status change of the table being restored to the event bus
+func (downloadInfo *downloadInfoStruct) publish(status string, err error) {
+	e := tableEventStruct{Schema: downloadInfo.schema, Table: downloadInfo.table, Status: status}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	downloadInfo.events.publish(e)
+}
+
+// skip ends a table that is not restored for a reason other than an error, it is reported as skipped and does not count as an error
+func (downloadInfo *downloadInfoStruct) skip(reason string) {
+	journal.printf("SKIPPED", "%s.%s %s", downloadInfo.schema, downloadInfo.table, reason)
+	refreshState.failed(downloadInfo)
+	downloadInfo.events.publish(tableEventStruct{Schema: downloadInfo.schema, Table: downloadInfo.table, Status: statusSkipped, Reason: reason})
+	downloadInfo.done()
+}
+
+// drawEvents returns a drawFunc publishing the download progress of a file of the table as events
+func (downloadInfo *downloadInfoStruct) drawEvents(file string) drawFunc {
+	return func(prefix string, progress, total int64) error {
+		// There is no line to blank out
+		if progress == -1 && total == -1 {
+			return nil
+		}
+
+		p := &fileProgressStruct{File: file, Bytes: progress, Size: total, Percent: 100}
+		if total > 0 {
+			p.Percent = int(progress * 100 / total)
+		}
+		downloadInfo.events.publish(tableEventStruct{Schema: downloadInfo.schema, Table: downloadInfo.table, Status: statusDownloading, Progress: p})
+
+		return nil
 	}
 }
 
 // display receives display events and queues events to make printing sane
-func display(displayChan chan displayInfoStruct) {
+func display(events <-chan tableEventStruct) {
 	var lastDisplayLength int
-	var currentDisplay displayInfoStruct
-	var displayQueue []displayInfoStruct
+	var currentDisplay tableEventStruct
+	var displayQueue []tableEventStruct
 
 	// Receive channel display events
-	for displayInfo := range displayChan {
-		if currentDisplay.fqTable == "" {
+	for displayInfo := range events {
+		if currentDisplay.fqTable() == "" {
 			currentDisplay = displayInfo
 		}
 
 		// Set current display table
-		if getDisplayTable() == "" && currentDisplay.status == "Downloading" {
-			setDisplayTable(currentDisplay.fqTable)
+		if getDisplayTable() == "" && currentDisplay.Status == statusDownloading {
+			setDisplayTable(currentDisplay.fqTable())
 		}
 
 		// If the channel event is for the current table update the display otherwise add it to the queue
-		if currentDisplay.fqTable == displayInfo.fqTable {
+		if currentDisplay.fqTable() == displayInfo.fqTable() {
 			// Blank out the previous status and display new status
-			fmt.Fprintf(displayInfo.w, strings.Repeat(" ", lastDisplayLength)+"\r")
-			line := fmt.Sprintf("%s: %s", displayInfo.status, displayInfo.fqTable)
+			fmt.Fprintf(os.Stdout, strings.Repeat(" ", lastDisplayLength)+"\r")
+			line := displayInfo.line()
 			lastDisplayLength = len(line)
-			fmt.Fprintf(displayInfo.w, line+"\r")
+			fmt.Fprintf(os.Stdout, line+"\r")
 
 			// Decide what to do when receiving a tables final status
-			if displayInfo.status == "Restored" || displayInfo.status == "ERROR" {
-				fmt.Fprintf(displayInfo.w, "\n")
+			if displayInfo.final() {
+				fmt.Fprintf(os.Stdout, "\n")
 				// Blank current table variable if queue is empty otherwise display queued events
 				if len(displayQueue) == 0 {
-					currentDisplay.fqTable = ""
+					currentDisplay = tableEventStruct{}
 				} else {
-					var tmpQueue []displayInfoStruct
+					var tmpQueue []tableEventStruct
 					for i := 0; i < len(displayQueue); i++ {
-						if displayQueue[i].status == "Restored" || displayQueue[i].status == "ERROR" {
-							line := fmt.Sprintf("%s: %s", displayQueue[i].status, displayQueue[i].fqTable)
-							fmt.Fprintf(displayInfo.w, line+"\n")
-						} else if displayQueue[i].fqTable != currentDisplay.fqTable {
+						if displayQueue[i].final() {
+							line := displayQueue[i].line()
+							fmt.Fprintf(os.Stdout, line+"\n")
+						} else if displayQueue[i].fqTable() != currentDisplay.fqTable() {
 							tmpQueue = append(tmpQueue, displayQueue[i])
 						}
 					}
@@ -403,17 +911,17 @@ func display(displayChan chan displayInfoStruct) {
 						currentDisplay = displayQueue[0]
 
 						// Set current display table
-						if currentDisplay.status == "Downloading" {
-							setDisplayTable(currentDisplay.fqTable)
+						if currentDisplay.Status == statusDownloading {
+							setDisplayTable(currentDisplay.fqTable())
 						}
 
 						// Oldest queue item is now current table so display the status
-						line := fmt.Sprintf("%s: %s", currentDisplay.status, currentDisplay.fqTable)
+						line := currentDisplay.line()
 						lastDisplayLength = len(line)
-						fmt.Fprintf(currentDisplay.w, line+"\r")
+						fmt.Fprintf(os.Stdout, line+"\r")
 					} else {
-						currentDisplay.fqTable = ""
-						setDisplayTable(currentDisplay.fqTable)
+						currentDisplay = tableEventStruct{}
+						setDisplayTable(currentDisplay.fqTable())
 					}
 				}
 			}
@@ -424,7 +932,7 @@ func display(displayChan chan displayInfoStruct) {
 			} else {
 				var tableInQueue bool
 				for i := 0; i < len(displayQueue); i++ {
-					if displayQueue[i].fqTable == displayInfo.fqTable {
+					if displayQueue[i].fqTable() == displayInfo.fqTable() {
 						displayQueue[i] = displayInfo
 						tableInQueue = true
 					}
@@ -440,10 +948,11 @@ func display(displayChan chan displayInfoStruct) {
 
 // downloadTables retrieves files from the HTTP server. Files to download is MySQL engine specific.
 func downloadTable(clientConfig clientConfigStruct, downloadInfo downloadInfoStruct) {
-	downloadInfo.displayInfo.w = os.Stdout
-	downloadInfo.displayInfo.fqTable = downloadInfo.schema + "." + downloadInfo.table
-	downloadInfo.displayInfo.status = "Downloading"
-	downloadInfo.displayChan <- downloadInfo.displayInfo
+	downloadInfo.publish(statusDownloading, nil)
+
+	var span trace.Span
+	downloadInfo.ctx, span = tracer.Start(downloadInfo.ctx, "download", trace.WithAttributes(attribute.String("trite.schema", downloadInfo.schema), attribute.String("trite.table", downloadInfo.table)))
+	defer span.End()
 
 	// Use encoded schema and table if present
 	var schemaFilename string
@@ -451,44 +960,76 @@ func downloadTable(clientConfig clientConfigStruct, downloadInfo downloadInfoStr
 	if downloadInfo.encodedSchema != "" {
 		schemaFilename = downloadInfo.encodedSchema
 	} else {
-		schemaFilename = downloadInfo.schema
+		schemaFilename = downloadInfo.sourceSchema
 	}
 
 	if downloadInfo.encodedTable != "" {
 		tableFilename = downloadInfo.encodedTable
 	} else {
-		tableFilename = downloadInfo.table
+		tableFilename = downloadInfo.sourceTable
 	}
 
+	// HEAD responses of the files found while planning are reused when they are downloaded
+	heads := make(map[string]headStruct)
+
 	// Ensure backup exists and check the engine type
 	// Assume InnoDB first
-	resp, err := http.Head(downloadInfo.backurl + path.Join(schemaFilename, tableFilename+".ibd"))
+	resp, err := httpRequest(downloadInfo.ctx, "HEAD", joinURL(downloadInfo.backurl, schemaFilename, tableFilename+".ibd"))
 	checkErr(err)
 
+	// Partitioned tables have a table#P#partition.ibd file per partition instead of a .ibd, the partitions are found in the backup directory listing
+	var partitions []string
+	if resp.StatusCode == 200 {
+		partitions = []string{""}
+		heads[".ibd"] = newHead(resp)
+	} else if partitions = backupPartitions(downloadInfo.ctx, dirURL(downloadInfo.backurl, schemaFilename), tableFilename); len(partitions) > 0 {
+		// Partition tablespaces can only be imported by MySQL 5.7
+		if !strings.HasPrefix(downloadInfo.version, "5.7") {
+			errDownloadUnsupported = fmt.Errorf("Table %s.%s is partitioned, partitioned tables can only be transported to MySQL 5.7", downloadInfo.schema, downloadInfo.table)
+			handleDownloadError(clientConfig, &downloadInfo, errDownloadUnsupported)
+
+			return
+		}
+		downloadInfo.partitioned = true
+	}
+
 	var engine string
 	var extensions []string
-	if resp.StatusCode == 200 {
+	if len(partitions) > 0 {
 		engine = "InnoDB"
 
-		// 5.1 & 5.5 use .exp - 5.6 uses .cfg but it is ignored. Metadata checks appeared too brittle in testing.
-		if strings.HasPrefix(downloadInfo.version, "5.1") || strings.HasPrefix(downloadInfo.version, "5.5") {
-			extensions = append(extensions, ".exp")
-		}
+		// Every partition has its own .cfg, .cfp and .ibd files which are named by appending the partition to the table name
+		var missingCfg bool
+		for _, partition := range partitions {
+			// 5.1 & 5.5 use .exp - 5.6+ use .cfg for the import consistency checks
+			if strings.HasPrefix(downloadInfo.version, "5.1") || strings.HasPrefix(downloadInfo.version, "5.5") {
+				extensions = append(extensions, partition+".exp")
+			} else {
+				metadata, err := exportMetadata(clientConfig, &downloadInfo, joinURL(downloadInfo.backurl, schemaFilename, tableFilename+partition), heads, partition, &missingCfg)
+				if err != nil {
+					handleDownloadError(clientConfig, &downloadInfo, err)
 
-		extensions = append(extensions, ".ibd")
+					return
+				}
+				extensions = append(extensions, metadata...)
+			}
+
+			extensions = append(extensions, partition+".ibd")
+		}
 	} else {
 		// Check for MyISAM
-		resp, err := http.Head(downloadInfo.backurl + path.Join(schemaFilename, tableFilename+".MYD"))
+		resp, err := httpRequest(downloadInfo.ctx, "HEAD", joinURL(downloadInfo.backurl, schemaFilename, tableFilename+".MYD"))
 		checkErr(err)
 
 		if resp.StatusCode == 200 {
 			engine = "MyISAM"
+			heads[".MYD"] = newHead(resp)
 			extensions = append(extensions, ".MYI")
 			extensions = append(extensions, ".MYD")
 			extensions = append(extensions, ".frm")
 		} else {
-			errDownloadUnsupported = fmt.Errorf("Table %s.%s is using an unsupported engine", downloadInfo.schema, downloadInfo.table)
-			handleDownloadError(clientConfig, &downloadInfo, errDownloadUnsupported)
+			// Tables of other engines such as MEMORY have no data files in the backup
+			downloadInfo.skip("no .ibd, partition or .MYD file in the backup")
 
 			return
 		}
@@ -498,149 +1039,393 @@ func downloadTable(clientConfig clientConfigStruct, downloadInfo downloadInfoStr
 	downloadInfo.engine = engine
 	downloadInfo.extensions = extensions
 
+	// Tablespaces created with DATA DIRECTORY are restored to that directory, DATA DIRECTORY clauses of partition definitions are not supported
+	if engine == "InnoDB" && !downloadInfo.partitioned {
+		downloadInfo.dataDirectory, err = tableDataDirectory(clientConfig, &downloadInfo)
+		if err == nil && downloadInfo.dataDirectory != "" {
+			err = downloadInfo.makeSchemaDir()
+		}
+		if err != nil {
+			errDownloadDataDirectory = fmt.Errorf("Unable to prepare the DATA DIRECTORY of table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+			handleDownloadError(clientConfig, &downloadInfo, errDownloadDataDirectory)
+
+			return
+		}
+	}
+
+	// With -changedOnly a table restored from the same create statement and backup files by the last refresh is left as it is
+	if refreshState != nil {
+		fp, ok := tableFingerprint(&downloadInfo, schemaFilename, tableFilename)
+		if ok && refreshState.unchanged(downloadInfo.schema+"."+downloadInfo.table, fp) && tableExists(downloadInfo.db, downloadInfo.schema, downloadInfo.table) {
+			journal.printf("UNCHANGED", "%s.%s", downloadInfo.schema, downloadInfo.table)
+			downloadInfo.publish(statusUnchanged, nil)
+			downloadInfo.done()
+
+			return
+		}
+		if ok {
+			downloadInfo.fingerprint = &fp
+		}
+	}
+
+	// Files are downloaded with the trite extension and renamed once the table is applied
+	if !downloadFiles(clientConfig, &downloadInfo, span, heads, schemaFilename, tableFilename) {
+		return
+	}
+
+	// Call applyTables
+	go applyTables(clientConfig, &downloadInfo)
+}
+
+// downloadFiles downloads the files of a table into the schema directory with the trite extension and records them in triteFiles.
+// It returns false when a file failed and the error was handled, the table is then not applied.
+func downloadFiles(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct, span trace.Span, heads map[string]headStruct, schemaFilename string, tableFilename string) bool {
 	// Loop through and download all files from extensions array
 	var triteFiles []string
-	for _, extension := range extensions {
-		triteFile := filepath.Join(downloadInfo.mysqldir, schemaFilename, tableFilename+extension+".trite")
+	for _, extension := range downloadInfo.extensions {
+		triteFile := filepath.Join(downloadInfo.schemaDir(), localFilename(downloadInfo.table, downloadInfo.lowerCaseFiles)+localPartition(extension, downloadInfo.lowerCaseFiles)+triteExtension)
+		trackTempFile(triteFile)
 
 		// Ensure the .exp exists if we expect it
 		// Checking this due to a bug encountered where XtraBackup did not create a tables .exp file
-		if extension == ".exp" {
-			resp, err := http.Head(downloadInfo.backurl + path.Join(schemaFilename, tableFilename+".exp"))
-			checkHTTP(resp, downloadInfo.backurl+path.Join(schemaFilename, tableFilename+".exp"))
+		if strings.HasSuffix(extension, ".exp") {
+			resp, err := httpRequest(downloadInfo.ctx, "HEAD", joinURL(downloadInfo.backurl, schemaFilename, tableFilename+extension))
+			checkHTTP(resp, joinURL(downloadInfo.backurl, schemaFilename, tableFilename+extension))
 			checkErr(err)
 
 			if resp.StatusCode != 200 {
 				errDownloadExp = fmt.Errorf("The .exp file is missing for table %s.%s", downloadInfo.schema, downloadInfo.table)
-				handleDownloadError(clientConfig, &downloadInfo, errDownloadExp)
+				handleDownloadError(clientConfig, downloadInfo, errDownloadExp)
 
-				return
+				return false
 			}
+			heads[extension] = newHead(resp)
+		}
+
+		// A partial download left by a stopped run is continued with -resume, compressed downloads cannot be resumed at a byte offset of the file
+		var offset int64
+		if clientConfig.resume && clientConfig.compress == "" {
+			offset = resumePartial(triteFile)
 		}
 
 		// Request and write file
-		fo, err := os.Create(triteFile)
+		fo, err := os.OpenFile(triteFile, os.O_WRONLY|os.O_CREATE, 0666)
+		journalFile("create", err, triteFile)
 		checkErr(err)
 		defer fo.Close()
 
 		if runtime.GOOS != "windows" {
 			// Chown to mysql user
 			os.Chown(triteFile, downloadInfo.uid, downloadInfo.gid)
-			os.Chmod(triteFile, mysqlPerms)
+			os.Chmod(triteFile, clientConfig.filePerms)
 		}
 
 		// Get the size of the file from the trite server here because the file may be compressed during download in which case the content length is -1
-		headfile := downloadInfo.backurl + path.Join(schemaFilename, tableFilename+extension)
-		head, err := http.Head(headfile)
-		checkHTTP(head, headfile)
-		checkErr(err)
-		sizeServer := head.ContentLength
-
-		var urlfile string
-		if clientConfig.gz == true {
-			urlfile = downloadInfo.gzurl + path.Join(schemaFilename, tableFilename+extension)
-		} else {
-			urlfile = downloadInfo.backurl + path.Join(schemaFilename, tableFilename+extension)
+		head, ok := heads[extension]
+		if !ok {
+			headfile := joinURL(downloadInfo.backurl, schemaFilename, tableFilename+extension)
+			resp, err := httpRequest(downloadInfo.ctx, "HEAD", headfile)
+			checkHTTP(resp, headfile)
+			checkErr(err)
+			head = newHead(resp)
 		}
+		sizeServer := head.size
 
-		// Download files from trite server
-		w := bufio.NewWriter(fo)
-		resp, err := http.Get(urlfile)
-		checkHTTP(resp, urlfile)
-		defer resp.Body.Close()
+		// The partial is only continued when the server file has not changed since it was written, complete partials are downloaded again
+		if offset > 0 {
+			fi, err := fo.Stat()
+			if err != nil || !resumeValid(head, offset, fi.ModTime()) {
+				offset = 0
+			}
+		}
+		err = fo.Truncate(offset)
+		checkErr(err)
+		_, err = fo.Seek(offset, io.SeekStart)
 		checkErr(err)
 
-		var r io.Reader
-		if clientConfig.gz == true {
-			r, _ = pgzip.NewReader(resp.Body)
+		// Copy an identical file downloaded earlier instead of downloading it again
+		var sum string
+		if clientConfig.dedup && sizeServer <= dedupMaxSize {
+			sum = fetchSum(downloadInfo.ctx, joinURL(downloadInfo.sumsurl, schemaFilename, tableFilename+extension))
+			if kept := dedup.lookup(sum); kept != "" {
+				err = copyFile(kept, triteFile)
+				journalFile("copy", err, kept, triteFile)
+				if err == nil {
+					span.AddEvent("deduplicated", trace.WithAttributes(attribute.String("trite.file", extension)))
+					triteFiles = append(triteFiles, triteFile)
+					continue
+				}
+			}
+		}
+
+		var urlfile string
+		if clientConfig.compress != "" {
+			urlfile = joinURL(downloadInfo.compressurl, schemaFilename, tableFilename+extension)
 		} else {
-			r = bufio.NewReader(resp.Body)
+			urlfile = joinURL(downloadInfo.backurl, schemaFilename, tableFilename+extension)
 		}
 
+		// Download files from trite server, a stream broken by a failed server is continued from a mirror serving the same generation
+		// and failed transfers are retried with backoff, continuing from the bytes already written when the server supports ranges
+		var sums *sumReader
+		var expected <-chan string
 		var sizeDown int64
-		if extension != ".exp" && sizeServer > clientConfig.minDownloadProgressSize*1073741824 {
-			progressReader := &reader{
-				reader:     r,
-				size:       sizeServer,
-				drawFunc:   drawTerminalf(downloadInfo.displayInfo.w, drawTextFormatPercent),
-				drawPrefix: "Downloading: " + downloadInfo.schema + "." + downloadInfo.table,
+		var revalidated bool
+		var failovers, retries int
+		downloadingTempFile(triteFile, true)
+		for {
+			resp, err := httpRequestHeader(downloadInfo.ctx, "GET", urlfile, rangeHeader(sumHeader(head.conditions(), clientConfig.verifySums), offset))
+			if err != nil && retryDownload(downloadInfo.ctx, clientConfig, &retries, urlfile, err) {
+				continue
+			}
+			checkErr(err)
+			defer resp.Body.Close()
+
+			// Server errors are often temporary such as a restarting proxy
+			if resp.StatusCode >= http.StatusInternalServerError && retryDownload(downloadInfo.ctx, clientConfig, &retries, urlfile, fmt.Errorf("%s returned", resp.Status)) {
+				resp.Body.Close()
+				continue
 			}
-			sizeDown, err = w.ReadFrom(progressReader)
 
-		} else {
-			sizeDown, err = w.ReadFrom(r)
+			// Mirrors have their own validators so the file is checked again on the mirror after a failover
+			if resp.StatusCode == http.StatusPreconditionFailed && mirrors != nil && !revalidated {
+				resp.Body.Close()
+				revalidated = true
+				if mirrorHead, ok := mirrors.revalidate(downloadInfo.ctx, joinURL(downloadInfo.backurl, schemaFilename, tableFilename+extension), head); ok {
+					head = mirrorHead
+					continue
+				}
+			}
 
-		}
+			// The file changed on the server after it was planned, such as the backup being swapped mid-run
+			if resp.StatusCode == http.StatusPreconditionFailed {
+				removeFile(triteFile)
 
-		checkErr(err)
-		w.Flush()
+				errDownloadChanged = fmt.Errorf("The %s file for %s.%s changed on the trite server during the restore", extension, downloadInfo.schema, downloadInfo.table)
+				handleDownloadError(clientConfig, downloadInfo, errDownloadChanged)
+
+				return false
+			}
+			// Servers that cannot send a range, such as when decrypting, send the whole file
+			if resp.StatusCode != http.StatusPartialContent {
+				checkHTTP(resp, urlfile)
+				if offset > 0 {
+					offset = 0
+					err = fo.Truncate(0)
+					checkErr(err)
+					_, err = fo.Seek(0, io.SeekStart)
+					checkErr(err)
+					if sums != nil {
+						sums.h.Reset()
+					}
+				}
+			}
+			report.addKeyID(resp.Header.Get(keyIDHeader))
+
+			// -maxRate limits the bytes received from the network so compressed downloads are limited before they are decompressed
+			var r io.Reader = rateLimit.reader(resp.Body)
+			if clientConfig.compress != "" {
+				r = decompressReader(clientConfig.compress, r)
+			}
 
-		// Check if size of file downloaded matches size on server -- Add retry ability
+			// Checksums are calculated as the file streams to disk, the server checksum is fetched at the same time
+			if clientConfig.verifySums {
+				if sums == nil {
+					if sum != "" {
+						known := make(chan string, 1)
+						known <- sum
+						expected = known
+					} else {
+						expected = fetchSumAsync(downloadInfo.ctx, joinURL(downloadInfo.sumsurl, schemaFilename, tableFilename+extension))
+					}
+					sums = newSumReader(r)
+
+					if offset > 0 {
+						err = sums.hashPrefix(triteFile, offset)
+						checkErr(err)
+					}
+				}
+				sums.reader = r
+				r = sums
+			}
+
+			var copied int64
+			if clientConfig.hooks.progress() || !clientConfig.quiet && (clientConfig.jsonOutput != nil || !strings.HasSuffix(extension, ".exp") && sizeServer > clientConfig.minDownloadProgressSize) {
+				progressReader := &reader{
+					reader:     r,
+					size:       sizeServer,
+					progress:   offset,
+					drawFunc:   drawTerminalf(os.Stdout, drawTextFormatPercent),
+					drawPrefix: "Downloading: " + downloadInfo.schema + "." + downloadInfo.table,
+				}
+				if clientConfig.jsonOutput != nil || clientConfig.hooks.progress() {
+					progressReader.drawFunc = downloadInfo.drawEvents(downloadInfo.table + extension)
+					progressReader.drawAlways = true
+				} else if clientConfig.lineOutput {
+					progressReader.drawFunc = drawLinef(os.Stdout, drawTextFormatPercent)
+					progressReader.drawInterval = lineDrawInterval
+					progressReader.drawAlways = true
+				}
+				if clientConfig.progressInterval > 0 {
+					progressReader.drawInterval = clientConfig.progressInterval
+				}
+				copied, err = downloadCopy(fo, progressReader)
+
+			} else {
+				copied, err = downloadCopy(fo, r)
+
+			}
+			sizeDown = offset + copied
+
+			// Continue from the bytes already written on the next mirror or after a backoff, compressed streams and oversized files start over
+			failed := err
+			if failed == nil && sizeDown != sizeServer {
+				failed = fmt.Errorf("%d of %d bytes received", sizeDown, sizeServer)
+			}
+			if failed != nil && failovers < mirrors.count()-1 && mirrors.failover(resp.Request.URL.String()) {
+				failovers++
+			} else if failed == nil || !retryDownload(downloadInfo.ctx, clientConfig, &retries, urlfile, failed) {
+				// A compressed stream that still cannot be inflated after the retries fails the table instead of the restore
+				if err != nil && clientConfig.compress != "" {
+					resp.Body.Close()
+					removeFile(triteFile)
+
+					errDownloadDecompress = fmt.Errorf("The %s file for %s.%s could not be decompressed from the %s stream - %s", extension, downloadInfo.schema, downloadInfo.table, clientConfig.compress, err)
+					handleDownloadError(clientConfig, downloadInfo, errDownloadDecompress)
+
+					return false
+				}
+				checkErr(err)
+				break
+			}
+
+			resp.Body.Close()
+			offset = sizeDown
+			if clientConfig.compress != "" || sizeDown > sizeServer {
+				offset = 0
+				err = fo.Truncate(0)
+				checkErr(err)
+				_, err = fo.Seek(0, io.SeekStart)
+				checkErr(err)
+				if sums != nil {
+					sums.h.Reset()
+				}
+			}
+		}
+		span.AddEvent("downloaded", trace.WithAttributes(attribute.String("trite.file", extension), attribute.Int64("trite.bytes", sizeDown), attribute.Int64("trite.resumedAt", offset)))
+
+		// Check if size of file downloaded matches size on server after the retries
 		if sizeDown != sizeServer {
-			// Remove partial file download
-			os.Remove(triteFile)
+			// Remove partial file download, a short download is kept for -resume
+			if !keepPartials || sizeDown > sizeServer {
+				removeFile(triteFile)
+			}
 
 			errDownloadSize = fmt.Errorf("The %s file did not download properly for %s.%s", extension, downloadInfo.schema, downloadInfo.table)
-			handleDownloadError(clientConfig, &downloadInfo, errDownloadSize)
+			handleDownloadError(clientConfig, downloadInfo, errDownloadSize)
+
+			return false
 		}
 
+		// Servers without checksums return a blank sum and the file is not verified
+		if sums != nil {
+			got := sums.sum()
+			if want := <-expected; want != "" && got != want {
+				removeFile(triteFile)
+
+				errDownloadChecksum = fmt.Errorf("The %s file checksum %s does not match the server checksum %s for %s.%s", extension, got, want, downloadInfo.schema, downloadInfo.table)
+				handleDownloadError(clientConfig, downloadInfo, errDownloadChecksum)
+
+				return false
+			}
+		}
+		downloadingTempFile(triteFile, false)
+		dedup.add(sum, triteFile)
+
 		triteFiles = append(triteFiles, triteFile)
 	}
 
 	downloadInfo.triteFiles = triteFiles
 
-	// Call applyTables
-	go applyTables(clientConfig, &downloadInfo)
+	return true
+}
+
+// done marks the table finished and frees its apply slot
+func (downloadInfo *downloadInfoStruct) done() {
+	<-downloadInfo.applySlots
+	downloadInfo.wgApply.Done()
 }
 
 // handleDownloadError deals with logging and notification of errors that may occur during the download phase
 func handleDownloadError(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct, applyErr error) {
 	// Log the error
-	var f *os.File
-	var err error
-	f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		checkErr(err)
-	}
-
-	l := log.New(f, "DOWNLOAD ERROR\t", log.LstdFlags)
-	l.Println(applyErr)
-	f.Close()
+	var b bytes.Buffer
+	l := log.New(&b, "DOWNLOAD ERROR\t", log.LstdFlags)
+	l.Println(downloadInfo.schema+"."+downloadInfo.table, applyErr)
+	errorLog.write("DOWNLOAD ERROR", b.Bytes())
 
 	incErrCount()
+	refreshState.failed(downloadInfo)
 
 	// Send error status to display
-	downloadInfo.displayInfo.status = "ERROR"
-	downloadInfo.displayChan <- downloadInfo.displayInfo
-	downloadInfo.wgApply.Done()
+	downloadInfo.publish(statusError, applyErr)
+	downloadInfo.done()
 }
 
 // applyTables performs all of the database actions required to restore a table
 func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct) {
-	downloadInfo.displayInfo.status = "Applying"
-	downloadInfo.displayChan <- downloadInfo.displayInfo
+	defer exitOnPanic()
+	downloadInfo.publish(statusApplying, nil)
+
+	var span trace.Span
+	downloadInfo.ctx, span = tracer.Start(downloadInfo.ctx, "apply", trace.WithAttributes(attribute.String("trite.schema", downloadInfo.schema), attribute.String("trite.table", downloadInfo.table), attribute.String("trite.engine", downloadInfo.engine)))
+	defer span.End()
 
-	// Start db transaction
+	// Start db transaction. The connection is only taken from the pool once the files are downloaded so a long download cannot leave it idle past wait_timeout.
 	tx, err := downloadInfo.db.Begin()
 	checkErr(err)
 
-	// make the following code work for any settings -- need to preserve before changing so they can be changed back, figure out global vs session and how to handle not setting properly
-	_, err = tx.Exec("set session foreign_key_checks=0")
-	_, err = tx.Exec("set session lock_wait_timeout=60")
-	_, err = tx.Exec("use " + addQuotes(downloadInfo.schema))
+	// The connection goes back to the pool afterwards so the session variables changed here are restored before the transaction ends
+	downloadInfo.session = saveVariables(tx, "session", "foreign_key_checks", "lock_wait_timeout")
+	_, err = execSQL(tx, "set session foreign_key_checks=0")
+	_, err = execSQL(tx, fmt.Sprintf("set session lock_wait_timeout=%d", int(clientConfig.mdlTimeout.Seconds())))
+	_, err = execSQL(tx, "use "+addQuotes(downloadInfo.schema))
 
 	switch downloadInfo.engine {
 	case "InnoDB":
 		// Get table create
-		resp, err := http.Get(downloadInfo.taburl + path.Join(downloadInfo.schema, "tables", downloadInfo.table+sqlExtension))
-		checkHTTP(resp, downloadInfo.taburl+path.Join(downloadInfo.schema, "tables", downloadInfo.table+sqlExtension))
+		resp, err := httpRequest(downloadInfo.ctx, "GET", joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension))
+		checkHTTP(resp, joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension))
 		defer resp.Body.Close()
 		checkErr(err)
 		stmt, _ := ioutil.ReadAll(resp.Body)
+		err = dumpSums.verify(downloadInfo.sourceSchema+"/tables/"+downloadInfo.sourceTable+sqlExtension, stmt)
+		if downloadInfo.table != downloadInfo.sourceTable {
+			stmt = []byte(renameCreate(string(stmt), downloadInfo.table))
+		}
+
+		// Statements from the server are run as they are so only a single create table statement is accepted
+		if err == nil {
+			err = checkCreateStatement(string(stmt), "table")
+		}
+		if err != nil {
+			errApplyCreate = fmt.Errorf("There was an error creating table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+			handleApplyError(tx, clientConfig, downloadInfo, errApplyCreate)
+
+			return
+		}
+
+		// Never hang on a metadata lock held by another session
+		err = waitForTable(tx, clientConfig, downloadInfo)
+		if err != nil {
+			errApplyBlocked = fmt.Errorf("Table %s.%s was skipped, it is %s", downloadInfo.schema, downloadInfo.table, err)
+			handleApplyError(tx, clientConfig, downloadInfo, errApplyBlocked)
+
+			return
+		}
 
-		// Drop table if exists
-		_, err = tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		// Drop table if exists, or keep it as <table>_old with -keepOld
+		err = replaceTable(tx, clientConfig, downloadInfo)
 		if err != nil {
 			errApplyDrop = fmt.Errorf("There was an error dropping table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyDrop)
@@ -649,7 +1434,7 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 		}
 
 		// Create table
-		_, err = tx.Exec(string(stmt))
+		_, err = execSQL(tx, string(stmt))
 		if err != nil {
 			errApplyCreate = fmt.Errorf("There was an error creating table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyCreate)
@@ -658,7 +1443,7 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 		}
 
 		// Discard the tablespace
-		_, err = tx.Exec("alter table " + addQuotes(downloadInfo.table) + " discard tablespace")
+		_, err = execMDL(tx, clientConfig, downloadInfo, "alter table "+addQuotes(downloadInfo.table)+" discard "+downloadInfo.tablespaces())
 		if err != nil {
 			errApplyDiscard = fmt.Errorf("There was an error discarding the tablespace for %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyDiscard)
@@ -667,7 +1452,7 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 		}
 
 		// Lock the table just in case
-		_, err = tx.Exec("lock table " + addQuotes(downloadInfo.table) + " write")
+		_, err = execMDL(tx, clientConfig, downloadInfo, "lock table "+addQuotes(downloadInfo.table)+" write")
 		if err != nil {
 			errApplyLock = fmt.Errorf("There was an error locking table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyLock)
@@ -677,7 +1462,7 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 
 		// Rename trite download files
 		for _, triteFile := range downloadInfo.triteFiles {
-			err := os.Rename(triteFile, triteFile[:len(triteFile)-6])
+			err := renameFile(triteFile, strings.TrimSuffix(triteFile, triteExtension))
 			if err != nil {
 				errApplyRename = fmt.Errorf("There was an error renaming table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 				handleApplyError(tx, clientConfig, downloadInfo, errApplyRename)
@@ -688,7 +1473,22 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 		}
 
 		// Import the tablespace
-		_, err = tx.Exec("alter table " + addQuotes(downloadInfo.table) + " import tablespace")
+		_, err = execMDL(tx, clientConfig, downloadInfo, "alter table "+addQuotes(downloadInfo.table)+" import "+downloadInfo.tablespaces())
+
+		// A row format mismatch is fixed by recreating the table with the row format of the .ibd file
+		if isSchemaMismatch(err) {
+			if format := mismatchRowFormat(err); format != "" {
+				journal.printf("MISMATCH", "%s.%s recreating with ROW_FORMAT=%s - %s", downloadInfo.schema, downloadInfo.table, format, err)
+				if retryErr := retryImportRowFormat(tx, downloadInfo, string(stmt), format); retryErr != nil {
+					err = fmt.Errorf("%s, recreating with ROW_FORMAT=%s failed - %s", err, format, retryErr)
+				} else {
+					err = nil
+				}
+			}
+			if err != nil {
+				err = fmt.Errorf("%s\n%s", err, schemaMismatchAdvice(tx, downloadInfo.schema, downloadInfo.table, err))
+			}
+		}
 		if err != nil {
 			errApplyImport = fmt.Errorf("There was an error importing the tablespace for %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyImport)
@@ -696,17 +1496,47 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 			return
 		}
 
-		// Analyze the table otherwise there will be no index statistics
-		_, err = tx.Exec("analyze local table " + addQuotes(downloadInfo.table))
-		if err != nil {
-			errApplyAnalyze = fmt.Errorf("There was an error analyzing table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
-			handleApplyError(tx, clientConfig, downloadInfo, errApplyAnalyze)
+		removeExportMetadata(downloadInfo)
 
-			return
+		// Remove rows that do not match the tables row filter
+		if filterStmt := clientConfig.rowFilters.filterStatement(downloadInfo.schema, downloadInfo.table); filterStmt != "" {
+			_, err = execSQL(tx, filterStmt)
+			if err != nil {
+				errApplyRowFilter = fmt.Errorf("There was an error filtering rows for table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+				handleApplyError(tx, clientConfig, downloadInfo, errApplyRowFilter)
+
+				return
+			}
+		}
+
+		// Mask sensitive columns before the table is considered restored
+		if maskStmt := clientConfig.maskRules.maskStatement(downloadInfo.schema, downloadInfo.table, generatedColumns(tx, downloadInfo.schema, downloadInfo.table)); maskStmt != "" {
+			_, err = execSQL(tx, maskStmt)
+			if err != nil {
+				errApplyMask = fmt.Errorf("There was an error masking table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+				handleApplyError(tx, clientConfig, downloadInfo, errApplyMask)
+
+				return
+			}
+		}
+
+		// Analyze the table otherwise there will be no index statistics, -analyzeAfter queues it until all imports are done and -skipAnalyze leaves it to MySQL
+		switch {
+		case clientConfig.skipAnalyze:
+		case clientConfig.analyzeAfter:
+			analyzeQueue.add(downloadInfo.schema, downloadInfo.table)
+		default:
+			_, err = execSQL(tx, "analyze local table "+addQuotes(downloadInfo.table))
+			if err != nil {
+				errApplyAnalyze = fmt.Errorf("There was an error analyzing table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+				handleApplyError(tx, clientConfig, downloadInfo, errApplyAnalyze)
+
+				return
+			}
 		}
 
 		// Unlock the table
-		_, err = tx.Exec("unlock tables")
+		_, err = execSQL(tx, "unlock tables")
 		if err != nil {
 			errApplyUnlock = fmt.Errorf("There was an error unlocking table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyUnlock)
@@ -715,12 +1545,22 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 		}
 
 		// Commit transaction
+		restoreVariables(tx, "session", downloadInfo.session)
 		err = tx.Commit()
 		checkErr(err)
 
 	case "MyISAM":
-		// Drop table if exists
-		_, err := tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		// Never hang on a metadata lock held by another session
+		err = waitForTable(tx, clientConfig, downloadInfo)
+		if err != nil {
+			errApplyBlocked = fmt.Errorf("Table %s.%s was skipped, it is %s", downloadInfo.schema, downloadInfo.table, err)
+			handleApplyError(tx, clientConfig, downloadInfo, errApplyBlocked)
+
+			return
+		}
+
+		// Drop table if exists, or keep it as <table>_old with -keepOld
+		err := replaceTable(tx, clientConfig, downloadInfo)
 		if err != nil {
 			errApplyDrop = fmt.Errorf("There was an error dropping table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 			handleApplyError(tx, clientConfig, downloadInfo, errApplyDrop)
@@ -730,7 +1570,7 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 
 		// Rename happens here
 		for _, triteFile := range downloadInfo.triteFiles {
-			err := os.Rename(triteFile, triteFile[:len(triteFile)-6])
+			err := renameFile(triteFile, strings.TrimSuffix(triteFile, triteExtension))
 			if err != nil {
 				errApplyRename = fmt.Errorf("There was an error renaming table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
 				handleApplyError(tx, clientConfig, downloadInfo, errApplyRename)
@@ -739,19 +1579,45 @@ func applyTables(clientConfig clientConfigStruct, downloadInfo *downloadInfoStru
 			}
 		}
 
+		// Remove rows that do not match the tables row filter
+		if filterStmt := clientConfig.rowFilters.filterStatement(downloadInfo.schema, downloadInfo.table); filterStmt != "" {
+			_, err = execSQL(tx, filterStmt)
+			if err != nil {
+				errApplyRowFilter = fmt.Errorf("There was an error filtering rows for table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+				handleApplyError(tx, clientConfig, downloadInfo, errApplyRowFilter)
+
+				return
+			}
+		}
+
+		// Mask sensitive columns before the table is considered restored
+		if maskStmt := clientConfig.maskRules.maskStatement(downloadInfo.schema, downloadInfo.table, generatedColumns(tx, downloadInfo.schema, downloadInfo.table)); maskStmt != "" {
+			_, err = execSQL(tx, maskStmt)
+			if err != nil {
+				errApplyMask = fmt.Errorf("There was an error masking table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+				handleApplyError(tx, clientConfig, downloadInfo, errApplyMask)
+
+				return
+			}
+		}
+
 		// Commit transaction
+		restoreVariables(tx, "session", downloadInfo.session)
 		err = tx.Commit()
 		checkErr(err)
 
 	default:
-		fmt.Fprintln(os.Stderr, "\t*", "Backup does not exist or", downloadInfo.table, "is using an engine other than InnoDB or MyISAM")
-		fmt.Fprintln(os.Stderr, "\t*", "Skipping")
+		restoreVariables(tx, "session", downloadInfo.session)
+		tx.Rollback()
+		downloadInfo.skip("engine " + downloadInfo.engine + " is not InnoDB or MyISAM")
+
+		return
 	}
 
-	downloadInfo.displayInfo.status = "Restored"
-	downloadInfo.displayChan <- downloadInfo.displayInfo
+	refreshState.restored(downloadInfo)
+	downloadInfo.publish(statusRestored, nil)
 
-	downloadInfo.wgApply.Done()
+	downloadInfo.done()
 }
 
 // handleApplyError deals with rollback, logging and notification of errors that may occur during the apply phase
@@ -778,25 +1644,19 @@ func handleApplyError(tx *sql.Tx, clientConfig clientConfigStruct, downloadInfo
 		fmt.Println("ERROR:", err)
 	}
 
-	// Log the error
-	var f *os.File
-	f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		checkErr(err)
-	}
-
-	l := log.New(f, "APPLY ERROR\t", log.LstdFlags)
-	l.Println(applyErr)
+	// Log the error, the entry is built first and written as a whole
+	var b bytes.Buffer
+	l := log.New(&b, "APPLY ERROR\t", log.LstdFlags)
+	l.Println(downloadInfo.schema+"."+downloadInfo.table, applyErr)
 	l.Println("SHOW ENGINE INNODB STATUS output displayed to help debug the above apply error")
 	l.Println(innodbStatus)
 	l.Println("Processlist at the time of the error to help debug the above apply error")
 
 	// Tabwriter to make the processlist more readable
 	tw := new(tabwriter.Writer)
-	tw.Init(f, 0, 8, 1, ' ', tabwriter.Debug)
+	tw.Init(&b, 0, 8, 1, ' ', tabwriter.Debug)
 	fmt.Fprintln(tw, "id\tuser\thost\tdatabase\tcommand\ttime\tstate\tinfo")
-	for rows.Next() {
+	for rows != nil && rows.Next() {
 		err = rows.Scan(&id, &user, &host, &database, &command, &time, &state, &info)
 		if err != nil {
 			fmt.Println("ERROR:", err)
@@ -805,67 +1665,97 @@ func handleApplyError(tx *sql.Tx, clientConfig clientConfigStruct, downloadInfo
 		fmt.Fprintln(tw, id, "\t", user, "\t", host, "\t", database, "\t", command, "\t", time, "\t", state, "\t", info)
 	}
 	tw.Flush()
+	if rows != nil {
+		rows.Close()
+	}
 
-	f.Close()
+	errorLog.write("APPLY ERROR", b.Bytes())
 
 	// Handle rollback and cleanup depending on the error
 	switch applyErr {
+	case errApplyBlocked:
+		for _, triteFile := range downloadInfo.triteFiles {
+			removeFile(triteFile)
+		}
+		restoreVariables(tx, "session", downloadInfo.session)
+		tx.Rollback()
+
 	case errApplyDrop:
 		for _, triteFile := range downloadInfo.triteFiles {
-			os.Remove(triteFile)
+			removeFile(triteFile)
 		}
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyCreate:
 		for _, triteFile := range downloadInfo.triteFiles {
-			os.Remove(triteFile)
+			removeFile(triteFile)
 		}
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyDiscard:
 		for _, triteFile := range downloadInfo.triteFiles {
-			os.Remove(triteFile)
+			removeFile(triteFile)
 		}
-		tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyLock:
 		for _, triteFile := range downloadInfo.triteFiles {
-			os.Remove(triteFile)
+			removeFile(triteFile)
 		}
-		tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyRename:
 		for _, triteFile := range downloadInfo.triteFiles {
-			os.Remove(triteFile)
+			removeFile(triteFile)
 		}
-		tx.Exec("unlock tables")
-		tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		execSQL(tx, "unlock tables")
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyImport:
-		tx.Exec("unlock tables")
-		tx.Exec("drop table if exists " + addQuotes(downloadInfo.table))
+		execSQL(tx, "unlock tables")
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
+		tx.Rollback()
+
+	case errApplyRowFilter, errApplyMask:
+		// Never leave an unfiltered or unmasked copy of the table behind
+		execSQL(tx, "unlock tables")
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
+		tx.Rollback()
+
+	case errApplyLogical:
+		execSQL(tx, "drop table if exists "+addQuotes(downloadInfo.table))
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyAnalyze:
-		tx.Exec("unlock tables")
+		execSQL(tx, "unlock tables")
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 
 	case errApplyUnlock:
+		restoreVariables(tx, "session", downloadInfo.session)
 		tx.Rollback()
 	}
 
 	incErrCount()
+	refreshState.failed(downloadInfo)
 
 	// Send error status to display
-	downloadInfo.displayInfo.status = "ERROR"
-	downloadInfo.displayChan <- downloadInfo.displayInfo
-	downloadInfo.wgApply.Done()
+	downloadInfo.publish(statusError, applyErr)
+	downloadInfo.done()
 }
 
-// applyObjects is a generic function for creating procedures, functions, views and triggers.
+// applyObjects is a generic function for creating procedures, functions, views and triggers. An object that cannot be created is logged and reported and the remaining objects are still applied.
 func applyObjects(db *sql.DB, clientConfig clientConfigStruct, objectType string, schema string, taburl string) {
 	objectTypePlural := objectType + "s"
 
@@ -873,76 +1763,190 @@ func applyObjects(db *sql.DB, clientConfig clientConfigStruct, objectType string
 	tx, err := db.Begin()
 	checkErr(err)
 
+	// Objects are created with the session variables they were defined with, the values of the pooled connection are restored before the transaction ends
+	session := saveVariables(tx, "session", "foreign_key_checks", "sql_mode", "character_set_client", "collation_connection", "collation_database", "time_zone", "explicit_defaults_for_timestamp")
+	_, err = execSQL(tx, "set session foreign_key_checks=0")
+
 	// Use schema
-	_, err = tx.Exec("set session foreign_key_checks=0")
-	_, err = tx.Exec("use " + schema)
+	_, err = execSQL(tx, "use "+schema)
 
 	// Get a list of objects to create
-	loc, err := http.Get(taburl + path.Join(schema, objectTypePlural))
-	checkHTTP(loc, taburl+path.Join(schema, objectTypePlural))
+	loc, err := httpGet(dirURL(taburl, schema, objectTypePlural))
+	if err == nil && loc.StatusCode == 404 && objectType == "event" {
+		// Dumps taken before events were supported do not have an events directory
+		loc.Body.Close()
+		restoreVariables(tx, "session", session)
+		tx.Rollback()
+
+		return
+	}
+	if err == nil && loc.StatusCode != 200 {
+		loc.Body.Close()
+		err = fmt.Errorf("%d returned from: %s", loc.StatusCode, dirURL(taburl, schema, objectTypePlural))
+	}
+	if err != nil {
+		errObjectApply = fmt.Errorf("There was an error listing %s for %s - %s", objectTypePlural, schema, err)
+		handleObjectError(clientConfig, errObjectApply)
+		report.addObject(objectType, schema, "", errObjectApply)
+		restoreVariables(tx, "session", session)
+		tx.Rollback()
+
+		return
+	}
 	defer loc.Body.Close()
-	checkErr(err)
 	objects := parseAnchor(loc)
 	fmt.Println("Applying", objectTypePlural, "for", schema)
 
-	// Only continue if there are objects to create
-	if len(objects) > 0 {
-		for _, object := range objects {
+	// Errors are recorded per object so one bad definition does not stop the rest
+	for _, object := range objects {
+		objectName, _ := parseFileName(object)
+		err = applyObject(tx, clientConfig, objectType, schema, joinURL(taburl, schema, objectTypePlural, object), objectName)
+		if err != nil {
+			errObjectApply = fmt.Errorf("There was an error creating %s %s.%s - %s", objectType, schema, objectName, err)
+			handleObjectError(clientConfig, errObjectApply)
+		}
+		report.addObject(objectType, schema, objectName, err)
+	}
 
-			objectName, _ := parseFileName(object)
-			_, err := tx.Exec("drop " + objectType + " if exists " + addQuotes(objectName))
-			resp, err := http.Get(taburl + path.Join(schema, objectTypePlural, object))
-			checkHTTP(resp, taburl+path.Join(schema, objectTypePlural, object))
-			defer resp.Body.Close()
-			checkErr(err)
-			stmt, _ := ioutil.ReadAll(resp.Body)
+	// Commit transaction
+	restoreVariables(tx, "session", session)
+	err = tx.Commit()
+	checkErr(err)
+}
 
-			var objInfo createInfoStruct
-			err = json.Unmarshal(stmt, &objInfo)
-			checkErr(err)
+// applyObject downloads the create statement for one object and creates it with the session variables it was defined with
+func applyObject(tx *sql.Tx, clientConfig clientConfigStruct, objectType string, schema string, url string, objectName string) error {
+	_, err := execSQL(tx, "drop "+objectType+" if exists "+addQuotes(objectName))
+	if err != nil {
+		return err
+	}
 
-			// Set session level variables to recreate stored code properly
-			if objInfo.SQLMode != "" {
-				_, err = tx.Exec("set session sql_mode = '" + objInfo.SQLMode + "'")
-			}
-			if objInfo.CharsetClient != "" {
-				_, err = tx.Exec("set session character_set_client = '" + objInfo.CharsetClient + "'")
-			}
-			if objInfo.Collation != "" {
-				_, err = tx.Exec("set session collation_connection = '" + objInfo.Collation + "'")
-			}
-			if objInfo.DbCollation != "" {
-				_, err = tx.Exec("set session collation_database = '" + objInfo.DbCollation + "'")
-			}
+	resp, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%d returned from: %s", resp.StatusCode, url)
+	}
 
-			// Create object
-			_, err = tx.Exec(objInfo.Create)
-			if err != nil {
-				errObjectApply = fmt.Errorf("There was an error creating %s %s.%s - %s", objectType, schema, objInfo.Name, err)
-				handleObjectError(clientConfig, errObjectApply)
-			}
+	stmt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = dumpSums.verify(schema+"/"+objectType+"s/"+objectName+sqlExtension, stmt)
+	if err != nil {
+		return err
+	}
+
+	var objInfo createInfoStruct
+	err = json.Unmarshal(stmt, &objInfo)
+	if err != nil {
+		return err
+	}
+
+	// Statements and session values from the server are run as they are so they are checked first
+	err = checkCreateStatement(objInfo.Create, objectType)
+	if err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"sql_mode": objInfo.SQLMode, "character_set_client": objInfo.CharsetClient, "collation_connection": objInfo.Collation,
+		"collation_database": objInfo.DbCollation, "time_zone": objInfo.TimeZone, "explicit_defaults_for_timestamp": objInfo.ExplicitDefaultsForTimestamp} {
+		err = checkSessionValue(name, value)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Commit transaction
-	err = tx.Commit()
-	checkErr(err)
+	// Set session level variables to recreate stored code properly, the object is not created with the wrong settings when one cannot be set
+	var session []string
+	if objInfo.SQLMode != "" {
+		session = append(session, "set session sql_mode = '"+sanitizeSQLMode(tx, objectName, objInfo.SQLMode)+"'")
+	}
+	if objInfo.CharsetClient != "" {
+		session = append(session, "set session character_set_client = '"+objInfo.CharsetClient+"'")
+	}
+	if objInfo.Collation != "" {
+		session = append(session, "set session collation_connection = '"+objInfo.Collation+"'")
+	}
+	if objInfo.DbCollation != "" {
+		session = append(session, "set session collation_database = '"+objInfo.DbCollation+"'")
+	}
+	if objInfo.TimeZone != "" {
+		session = append(session, "set session time_zone = '"+objInfo.TimeZone+"'")
+	}
+	if objInfo.ExplicitDefaultsForTimestamp != "" {
+		session = append(session, "set session explicit_defaults_for_timestamp = "+objInfo.ExplicitDefaultsForTimestamp)
+	}
+	for _, stmt := range session {
+		_, err = execSQL(tx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create object, with strict DDL the -sanitize rewrites are only used when the statement fails as written
+	if !clientConfig.strictDDL {
+		return createSanitized(tx, clientConfig, objectType, schema, objectName, objInfo.Create)
+	}
+
+	_, err = execSQL(tx, objInfo.Create)
+	if err != nil && len(clientConfig.sanitize) > 0 {
+		return createSanitized(tx, clientConfig, objectType, schema, objectName, objInfo.Create)
+	}
+
+	return err
+}
+
+// createSanitized runs a create statement after the -sanitize rewrites, recording any rewrite in the report
+func createSanitized(tx *sql.Tx, clientConfig clientConfigStruct, objectType string, schema string, objectName string, stmt string) error {
+	rewritten, applied := sanitizeStatement(stmt, clientConfig.sanitize)
+	if len(applied) > 0 {
+		warnf(levelInfo, "Removed %s from %s %s.%s", strings.Join(applied, ","), objectType, schema, objectName)
+		report.addRewrite(objectType, schema, objectName, applied, stmt, rewritten)
+	}
+
+	_, err := execSQL(tx, rewritten)
+
+	return err
+}
+
+// supportedSQLModes caches whether the target server accepts each sql_mode
+var supportedSQLModes = make(map[string]bool)
+
+// sanitizeSQLMode removes modes the target server does not support (e.g. NO_AUTO_CREATE_USER on 8.0) from an objects sql_mode so it can still be created
+func sanitizeSQLMode(tx *sql.Tx, objectName string, sqlMode string) string {
+	var kept, stripped []string
+	for _, mode := range strings.Split(sqlMode, ",") {
+		supported, ok := supportedSQLModes[mode]
+		if !ok {
+			_, err := tx.Exec("set session sql_mode = '" + mode + "'")
+			supported = err == nil
+			supportedSQLModes[mode] = supported
+		}
+
+		if supported {
+			kept = append(kept, mode)
+		} else {
+			stripped = append(stripped, mode)
+		}
+	}
+
+	if len(stripped) > 0 {
+		warnf(levelInfo, "Removed sql_mode %s not supported by the target from %s", strings.Join(stripped, ","), objectName)
+		journal.printf("SQLMODE", "%s removed %s", objectName, strings.Join(stripped, ","))
+	}
+
+	return strings.Join(kept, ",")
 }
 
 // handleObjectError deals with logging and notification of errors that may occur during the object applying phase
 func handleObjectError(clientConfig clientConfigStruct, applyErr error) {
 	// Log the error
-	var f *os.File
-	var err error
-	f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		f, err = os.OpenFile(clientConfig.errorLogFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		checkErr(err)
-	}
-
-	l := log.New(f, "OBJECT APPLY ERROR\t", log.LstdFlags)
+	var b bytes.Buffer
+	l := log.New(&b, "OBJECT APPLY ERROR\t", log.LstdFlags)
 	l.Println(applyErr)
-	f.Close()
+	errorLog.write("OBJECT APPLY ERROR", b.Bytes())
 
 	incErrCount()
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func FuzzParseAnchor(f *testing.F) {
+	f.Add([]byte("<pre>\n<a href=\"orders.sql\">orders.sql</a>\n<a href=\"shop/\">shop/</a>\n</pre>\n"))
+	f.Add([]byte("<pre>\n<a href=\"a%26b.sql\">a&amp;b.sql</a>\n<a href=\"x\">&lt;x&gt;.ibd</a>\n</pre>\n"))
+	f.Add([]byte("<a href=\"..\">..</a><a href=\"/\">/</a><a>../../etc/passwd</a><a>.</a>"))
+	f.Add([]byte("<a>a\x00b</a><a>\n\n</a><a>//</a><pre"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		r := &http.Response{Body: ioutil.NopCloser(bytes.NewReader(body))}
+		for _, name := range parseAnchor(r) {
+			if !validObjectName(name) {
+				t.Errorf("invalid name %q returned", name)
+			}
+		}
+	})
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
 
-	_ "github.com/go-sql-driver/mysql" // Go MySQL driver
+	"github.com/go-sql-driver/mysql" // Go MySQL driver
 )
 
 const (
@@ -33,6 +41,8 @@ type (
 		sock   string
 		schema string
 		tls    bool
+		pubKey string
+		params string
 		uid    int
 		gid    int
 	}
@@ -45,6 +55,13 @@ type (
 		CharsetClient string
 		Collation     string
 		DbCollation   string
+		timestampInfoStruct
+	}
+
+	// timestampInfoStruct stores the source servers timestamp related session variables so stored code behaves the same once restored
+	timestampInfoStruct struct {
+		TimeZone                     string `json:",omitempty"`
+		ExplicitDefaultsForTimestamp string `json:",omitempty"`
 	}
 )
 
@@ -55,14 +72,16 @@ func checkErr(e error) {
 	}
 }
 
-// ParseFileName splits a file name and returns two strings of the base and 3 digit extension
+// ParseFileName splits a file name at its last dot and returns the base and extension, names without an extension return a blank extension
 func parseFileName(text string) (string, string) {
-	ext := strings.Split(text, ".")
-	ext = ext[cap(ext)-1:]
-	ret := ext[0]
-	file := strings.TrimSuffix(text, "."+ret)
+	ext := filepath.Ext(text)
+
+	return strings.TrimSuffix(text, ext), strings.TrimPrefix(ext, ".")
+}
 
-	return file, ret
+// validObjectName returns true when a schema, table or file name received from a server is safe to use in a local path
+func validObjectName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
 }
 
 // AddQuotes adds backtick quotes in cases where identifiers are all numeric or match reserved keywords
@@ -71,29 +90,71 @@ func addQuotes(s string) string {
 	return s
 }
 
+// readPassword prompts for a password without echo when stdin is a terminal, otherwise the first line of stdin is used so passwords can be piped in
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "Enter password: ")
+		pwd, err := terminal.ReadPassword(fd)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		return string(pwd), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPasswordFile returns the first line of a password file
+func readPasswordFile(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.SplitN(strings.TrimRight(string(b), "\r\n"), "\n", 2)[0], nil
+}
+
 // connect returns a MySQL database connection handler
 func (dbi *mysqlCredentials) connect() (*sql.DB, error) {
-	// If password is blank prompt user
-	if dbi.pass == "" {
-		fmt.Println("Enter password: ")
-		pwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-		if err != nil {
-			if err != io.EOF {
-				checkErr(err)
-			}
-		}
+	// If password is blank prompt user or read it from stdin
+	if dbi.pass == "" || dbi.pass == "-" {
+		pwd, err := readPassword()
+		checkErr(err)
 
-		dbi.pass = string(pwd)
+		dbi.pass = pwd
 	}
 
-	// Set MySQL driver parameters
-	dbParameters := "sql_log_bin=0&wait_timeout=" + mysqlTimeout + "&net_write_timeout=" + mysqlWaitTimeout
+	// Set MySQL driver parameters. Native passwords are allowed explicitly so older accounts keep working against servers defaulting to caching_sha2_password.
+	dbParameters := "sql_log_bin=0&wait_timeout=" + mysqlTimeout + "&net_write_timeout=" + mysqlWaitTimeout + "&allowNativePasswords=true"
 
 	// Append cleartext and tls parameters if TLS is specified
 	if dbi.tls == true {
 		dbParameters = dbParameters + "&allowCleartextPasswords=1&tls=skip-verify"
 	}
 
+	// Append driver parameters passed through -dsn
+	if dbi.params != "" {
+		dbParameters = dbParameters + "&" + dbi.params
+	}
+
+	// Use a local copy of the servers RSA public key for caching_sha2_password & sha256_password full authentication over non-TLS tcp connections.
+	// Without it the driver requests the key from the server during the handshake.
+	if dbi.pubKey != "" {
+		err := registerServerPubKey(dbi.pubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		dbParameters = dbParameters + "&serverPubKey=" + serverPubKeyName
+	}
+
 	// Determine tcp or socket connection
 	var db *sql.DB
 	var err error
@@ -107,14 +168,180 @@ func (dbi *mysqlCredentials) connect() (*sql.DB, error) {
 
 	// Ping database to verify credentials
 	err = db.Ping()
+	if err != nil {
+		return db, authError(err)
+	}
+
+	// Pooled connections left idle, such as logical source connections while tables download, are closed well before the server drops them at wait_timeout.
+	// A -dsn parameter can lower wait_timeout so the session value is used.
+	var waitTimeout int
+	err = db.QueryRow("select @@session.wait_timeout").Scan(&waitTimeout)
+	if err == nil && waitTimeout > 1 {
+		db.SetConnMaxIdleTime(time.Duration(waitTimeout/2) * time.Second)
+	}
+
+	return db, nil
+}
+
+// mergeDSN fills in connection details from a Go MySQL driver DSN. Values for flags found in setFlags were given explicitly and are kept.
+func (dbi *mysqlCredentials) mergeDSN(dsn string, setFlags map[string]bool) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("Unable to parse -dsn - %s", err)
+	}
+
+	if !setFlags["user"] {
+		dbi.user = cfg.User
+	}
+	if !setFlags["pass"] {
+		dbi.pass = cfg.Passwd
+	}
+
+	// Only fill in the address when neither a host nor a socket was given explicitly
+	if !setFlags["host"] && !setFlags["socket"] {
+		switch cfg.Net {
+		case "unix":
+			dbi.sock = cfg.Addr
+		case "tcp", "tcp6":
+			host, port, err := net.SplitHostPort(cfg.Addr)
+			if err != nil {
+				return fmt.Errorf("Unable to parse -dsn address %s - %s", cfg.Addr, err)
+			}
+
+			dbi.host = host
+			if !setFlags["port"] {
+				dbi.port = port
+			}
+		default:
+			return fmt.Errorf("Unsupported -dsn network %s", cfg.Net)
+		}
+	}
 
-	return db, err
+	if dbi.schema == "" {
+		dbi.schema = cfg.DBName
+	}
+
+	// Keep the raw parameters so unusual driver options are passed through untouched
+	dbi.params = dsnParams(dsn)
+
+	return nil
+}
+
+// dsnParams returns the raw parameters of a DSN. Like the MySQL driver they are found after the last / so a password containing ? or / is not mistaken for them.
+func dsnParams(dsn string) string {
+	dbname := dsn[strings.LastIndex(dsn, "/")+1:]
+	if i := strings.Index(dbname, "?"); i != -1 {
+		return dbname[i+1:]
+	}
+
+	return ""
+}
+
+// serverPubKeyName is the name the -serverPubKey key is registered under with the MySQL driver
+const serverPubKeyName = "trite"
+
+// registerServerPubKey reads a PEM encoded RSA public key and registers it with the MySQL driver
+func registerServerPubKey(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("%s does not contain a PEM encoded public key", file)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Unable to parse public key %s - %s", file, err)
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s is not an RSA public key", file)
+	}
+
+	mysql.RegisterServerPubKey(serverPubKeyName, rsaPub)
+
+	return nil
+}
+
+// authError adds guidance to authentication plugin errors returned from the MySQL driver
+func authError(err error) error {
+	switch err {
+	case mysql.ErrCleartextPassword:
+		return fmt.Errorf("%s\nThe MySQL account uses a cleartext authentication plugin, use -tls to allow cleartext passwords", err)
+	case mysql.ErrNativePassword:
+		return fmt.Errorf("%s\nThe MySQL account uses mysql_native_password which has been disabled", err)
+	case mysql.ErrOldPassword:
+		return fmt.Errorf("%s\nThe MySQL account uses a pre 4.1 password hash, reset the password to use a supported plugin", err)
+	case mysql.ErrUnknownPlugin:
+		return fmt.Errorf("%s\nThe MySQL account uses an authentication plugin trite does not support, supported plugins are mysql_native_password, caching_sha2_password, sha256_password and mysql_clear_password", err)
+	}
+
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		switch mysqlErr.Number {
+		case 1045:
+			return fmt.Errorf("%s\nCheck the user name and password. Accounts using caching_sha2_password over tcp without -tls require the server RSA key, which is requested automatically or can be provided with -serverPubKey", err)
+		case 1251:
+			return fmt.Errorf("%s\nThe server requires a newer authentication plugin than the account is configured with", err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "caching_sha2_password") || strings.Contains(err.Error(), "sha256_password") {
+		return fmt.Errorf("%s\nUse -tls or provide the server RSA public key with -serverPubKey to authenticate over an unencrypted tcp connection", err)
+	}
+
+	return err
+}
+
+var (
+	exitMu    sync.Mutex
+	exitFuncs []func()
+)
+
+// onExit registers a cleanup function that is run when trite is stopped with a signal, exits on a fatal error or panics
+func onExit(fn func()) {
+	exitMu.Lock()
+	exitFuncs = append(exitFuncs, fn)
+	exitMu.Unlock()
+}
+
+// runExitFuncs runs registered cleanup functions in reverse order
+func runExitFuncs() {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+
+	for i := len(exitFuncs) - 1; i >= 0; i-- {
+		exitFuncs[i]()
+	}
+	exitFuncs = nil
+}
+
+// fatalExit runs the cleanup functions and exits, fatal errors exit through it so settings changed on the target are set back and temporary files are removed
+func fatalExit(code int) {
+	runExitFuncs()
+	os.Exit(code)
+}
+
+// exitOnPanic runs the cleanup functions before a panic that is not recovered ends trite. Goroutines defer it since a panic skips the deferred functions of every other goroutine.
+func exitOnPanic() {
+	if r := recover(); r != nil {
+		runExitFuncs()
+		panic(r)
+	}
 }
 
 // Catch signals
 func catchNotifications() {
-	state, err := terminal.GetState(int(os.Stdin.Fd()))
-	checkErr(err)
+	// Terminal state only exists with a TTY, minimal containers have none
+	var state *terminal.State
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		state, err = terminal.GetState(int(os.Stdin.Fd()))
+		checkErr(err)
+	}
 
 	// Deal with SIGINT
 	sigChan := make(chan os.Signal, 1)
@@ -125,7 +352,10 @@ func catchNotifications() {
 		for sig := range sigChan {
 			// Prevent exiting on accidental signal send
 			if time.Now().Sub(timer) < time.Second*signalTimeout {
-				terminal.Restore(int(os.Stdin.Fd()), state)
+				if state != nil {
+					terminal.Restore(int(os.Stdin.Fd()), state)
+				}
+				runExitFuncs()
 				os.Exit(0)
 			}
 
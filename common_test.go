@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		ext  string
+	}{
+		{"orders.sql", "orders", "sql"},
+		{"orders.ibd", "orders", "ibd"},
+		{"orders.frm", "orders", "frm"},
+		{"my.table.v2.sql", "my.table.v2", "sql"},
+		{"my.table.v2.ibd", "my.table.v2", "ibd"},
+		{"orders#P#p0.ibd", "orders#P#p0", "ibd"},
+		{"a.b.c", "a.b", "c"},
+		{"orders.trigger", "orders", "trigger"},
+		{"orders.procedure", "orders", "procedure"},
+		{"orders", "orders", ""},
+		{"orders.", "orders", ""},
+		{".hidden", "", "hidden"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		base, ext := parseFileName(tt.name)
+		if base != tt.base || ext != tt.ext {
+			t.Errorf("parseFileName(%q) = %q, %q, expected %q, %q", tt.name, base, ext, tt.base, tt.ext)
+		}
+	}
+}
+
+func FuzzParseFileName(f *testing.F) {
+	for _, name := range []string{"orders.sql", "my.table.v2.sql", "orders", ".", "a..b", "orders#P#p0.ibd"} {
+		f.Add(name)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		base, ext := parseFileName(name)
+		if ext == "" {
+			if base != name && base+"." != name {
+				t.Errorf("parseFileName(%q) = %q, %q lost part of the name", name, base, ext)
+			}
+			return
+		}
+		if base+"."+ext != name {
+			t.Errorf("parseFileName(%q) = %q, %q does not rebuild the name", name, base, ext)
+		}
+	})
+}
+
+func TestMergeDSN(t *testing.T) {
+	tests := []struct {
+		dsn    string
+		pass   string
+		host   string
+		schema string
+		params string
+	}{
+		{"user:secret@tcp(db1:3306)/", "secret", "db1", "", ""},
+		{"user:secret@tcp(db1:3306)/shop?timeout=5s&readTimeout=30s", "secret", "db1", "shop", "timeout=5s&readTimeout=30s"},
+		{"user:pa?ss@tcp(db1:3306)/", "pa?ss", "db1", "", ""},
+		{"user:pa?ss@tcp(db1:3306)/shop?timeout=5s", "pa?ss", "db1", "shop", "timeout=5s"},
+		{"user:pa/s?s@tcp(db1:3306)/?timeout=5s", "pa/s?s", "db1", "", "timeout=5s"},
+		{"user:p@ss?word@unix(/var/lib/mysql/mysql.sock)/?charset=utf8mb4", "p@ss?word", "", "", "charset=utf8mb4"},
+	}
+
+	for _, tt := range tests {
+		var dbi mysqlCredentials
+		err := dbi.mergeDSN(tt.dsn, nil)
+		if err != nil {
+			t.Errorf("mergeDSN(%q) = %s", tt.dsn, err)
+			continue
+		}
+		if dbi.pass != tt.pass || dbi.host != tt.host || dbi.schema != tt.schema || dbi.params != tt.params {
+			t.Errorf("mergeDSN(%q) = pass %q host %q schema %q params %q, expected %q %q %q %q", tt.dsn, dbi.pass, dbi.host, dbi.schema, dbi.params, tt.pass, tt.host, tt.schema, tt.params)
+		}
+	}
+}
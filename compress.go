@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// compressEndpoints is the server endpoint serving backup files compressed with each -compress codec, gzip keeps the /gz/ endpoint older clients use
+var compressEndpoints = map[string]string{"gzip": "gz", "zstd": "zstd", "s2": "s2"}
+
+// compressResponseWriter writes a response body through a compressor
+type compressResponseWriter struct {
+	http.ResponseWriter
+	io.Writer
+}
+
+// Write compresses b
+func (w compressResponseWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+// WriteHeader drops the length of the uncompressed file, the compressed body is shorter and its length is not known until it is written
+func (w compressResponseWriter) WriteHeader(status int) {
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// compressHandler serves the files of h compressed with codec. Range requests are served whole since a compressed stream cannot start at a byte offset of the file.
+func compressHandler(codec string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		w.Header().Set("Content-Encoding", "identity")
+
+		var c io.WriteCloser
+		var err error
+		switch codec {
+		case "gzip":
+			c, err = pgzip.NewWriterLevel(w, pgzip.BestCompression)
+		case "zstd":
+			c, err = zstd.NewWriter(w)
+		case "s2":
+			c = s2.NewWriter(w)
+		}
+		checkErr(err)
+		defer c.Close()
+
+		h.ServeHTTP(compressResponseWriter{ResponseWriter: w, Writer: c}, r)
+	})
+}
+
+// failedReader returns err from every read, a stream that cannot be decompressed fails the download attempt like a broken connection
+type failedReader struct {
+	err error
+}
+
+// Read returns the error
+func (r failedReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// decompressReader returns a reader decompressing a download compressed with codec. Corrupt data, including a gzip stream whose checksum or length trailer does not match, is returned as a read error.
+func decompressReader(codec string, r io.Reader) io.Reader {
+	var d io.Reader
+	var err error
+	switch codec {
+	case "gzip":
+		d, err = gzipReader(r)
+	case "zstd":
+		var z *zstd.Decoder
+		z, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			d = z.IOReadCloser()
+		}
+	case "s2":
+		d = s2.NewReader(r)
+	default:
+		d = r
+	}
+	if err != nil {
+		return failedReader{fmt.Errorf("Unable to read the %s stream - %s", codec, err)}
+	}
+
+	return d
+}
+
+// parseCompress checks a -compress codec, none and a blank codec download files uncompressed
+func parseCompress(codec string) (string, error) {
+	switch codec {
+	case "", "none":
+		return "", nil
+	case "gzip", "zstd", "s2":
+		return codec, nil
+	case "lz4":
+		return "", fmt.Errorf("-compress lz4 is not supported, s2 is a codec of the same speed class")
+	}
+
+	return "", fmt.Errorf("-compress must be gzip, zstd, s2 or none")
+}
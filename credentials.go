@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// lookupCredentials fills in the MySQL password from an external credential store. credPath is interpreted per source:
+// mylogin is the login path in .mylogin.cnf, vault is the secret path and keychain is the service name.
+// Values given explicitly are kept, a password already set by -pass, -passFile, MYSQL_PWD or -dsn is not looked up and flags found in setFlags are not overridden.
+func (dbi *mysqlCredentials) lookupCredentials(credSource string, credPath string, setFlags map[string]bool) error {
+	switch credSource {
+	case "mylogin":
+		if credPath == "" {
+			credPath = "client"
+		}
+		return dbi.myLoginCredentials(credPath, setFlags)
+	case "vault":
+		if credPath == "" {
+			return fmt.Errorf("-credPath is required to read credentials from vault")
+		}
+		if dbi.pass != "" {
+			return nil
+		}
+		pass, err := vaultSecret(credPath, "password")
+		if err != nil {
+			return err
+		}
+		dbi.pass = pass
+	case "keychain":
+		if credPath == "" {
+			credPath = "trite"
+		}
+		if dbi.pass != "" {
+			return nil
+		}
+		pass, err := keychainPassword(credPath, dbi.user)
+		if err != nil {
+			return err
+		}
+		dbi.pass = pass
+	default:
+		return fmt.Errorf("Unknown -credSource %s, valid sources are mylogin, vault and keychain", credSource)
+	}
+
+	return nil
+}
+
+// myLoginCredentials reads the user, password, host, port and socket for a login path from the obfuscated .mylogin.cnf created by mysql_config_editor.
+// Values already set on the command line, by -dsn or from the environment are kept.
+func (dbi *mysqlCredentials) myLoginCredentials(loginPath string, setFlags map[string]bool) error {
+	file := os.Getenv("MYSQL_TEST_LOGIN_FILE")
+	if file == "" {
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		file = filepath.Join(u.HomeDir, ".mylogin.cnf")
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	text, err := decryptMyLogin(b)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s - %s", file, err)
+	}
+
+	var found bool
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+
+		if section != loginPath {
+			continue
+		}
+		found = true
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+
+		switch key {
+		case "user":
+			if dbi.user == "" {
+				dbi.user = value
+			}
+		case "password":
+			if dbi.pass == "" {
+				dbi.pass = value
+			}
+		case "host":
+			if dbi.host == "" && dbi.sock == "" {
+				dbi.host = value
+			}
+		case "port":
+			// The port flag has a default so only explicitly given ports are kept
+			if !setFlags["port"] && !setFlags["dsn"] {
+				dbi.port = value
+			}
+		case "socket":
+			if dbi.sock == "" && dbi.host == "" {
+				dbi.sock = value
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("Login path %s not found in %s", loginPath, file)
+	}
+
+	return nil
+}
+
+// decryptMyLogin returns the plain text of a .mylogin.cnf file. The file starts with 4 unused bytes and a 20 byte key
+// followed by length prefixed AES-128-ECB encrypted lines.
+func decryptMyLogin(b []byte) ([]byte, error) {
+	if len(b) < 24 {
+		return nil, fmt.Errorf("file is too short")
+	}
+
+	key := make([]byte, 16)
+	for i, k := range b[4:24] {
+		key[i%16] ^= k
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var text []byte
+	b = b[24:]
+	for len(b) >= 4 {
+		size := int(binary.LittleEndian.Uint32(b[:4]))
+		b = b[4:]
+		if size > len(b) || size%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("corrupt encrypted line")
+		}
+
+		line := make([]byte, size)
+		for i := 0; i < size; i += aes.BlockSize {
+			block.Decrypt(line[i:i+aes.BlockSize], b[i:i+aes.BlockSize])
+		}
+		b = b[size:]
+
+		// Remove PKCS padding
+		if size > 0 {
+			pad := int(line[size-1])
+			if pad > 0 && pad <= aes.BlockSize {
+				line = line[:size-pad]
+			}
+		}
+
+		text = append(text, line...)
+	}
+
+	return text, nil
+}
+
+// vaultSecret reads a field from a HashiCorp Vault KV secret using the VAULT_ADDR and VAULT_TOKEN environment variables. Both KV version 1 and 2 are supported.
+func vaultSecret(secretPath string, field string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to read secrets from vault")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(secretPath, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%d returned from vault reading %s", resp.StatusCode, secretPath)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&secret)
+	if err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret one level deeper
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no %s field", secretPath, field)
+	}
+
+	return value, nil
+}
+
+// keychainPassword reads a password from the macOS keychain or the freedesktop secret service on Linux and the BSDs. Windows has neither.
+func keychainPassword(service string, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "user", account)
+	default:
+		return "", fmt.Errorf("-credSource=keychain is not supported on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Unable to read the password for %s from the %s keychain - %s", account, service, err)
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
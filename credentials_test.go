@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// encryptMyLogin obfuscates lines the way mysql_config_editor writes .mylogin.cnf
+func encryptMyLogin(t *testing.T, lines []string) []byte {
+	raw := []byte("12345678901234567890")
+	key := make([]byte, 16)
+	for i, k := range raw {
+		key[i%16] ^= k
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	b.Write([]byte{0, 0, 0, 0})
+	b.Write(raw)
+	for _, line := range lines {
+		plain := []byte(line + "\n")
+		pad := aes.BlockSize - len(plain)%aes.BlockSize
+		plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+		encrypted := make([]byte, len(plain))
+		for i := 0; i < len(plain); i += aes.BlockSize {
+			block.Encrypt(encrypted[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+		}
+
+		size := make([]byte, 4)
+		binary.LittleEndian.PutUint32(size, uint32(len(encrypted)))
+		b.Write(size)
+		b.Write(encrypted)
+	}
+
+	return b.Bytes()
+}
+
+func TestMyLoginCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite-mylogin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, ".mylogin.cnf")
+	err = ioutil.WriteFile(file, encryptMyLogin(t, []string{"[client]", "user = login", `password = "fromfile"`, "host = db1", "port = 3307", "[other]", "user = other"}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("MYSQL_TEST_LOGIN_FILE", os.Getenv("MYSQL_TEST_LOGIN_FILE"))
+	os.Setenv("MYSQL_TEST_LOGIN_FILE", file)
+
+	tests := []struct {
+		name     string
+		dbi      mysqlCredentials
+		setFlags map[string]bool
+		expected mysqlCredentials
+	}{
+		{"nothing given", mysqlCredentials{port: "3306"}, nil, mysqlCredentials{user: "login", pass: "fromfile", host: "db1", port: "3307"}},
+		{"flags given", mysqlCredentials{user: "me", pass: "secret", host: "db2", port: "3308"}, map[string]bool{"user": true, "pass": true, "host": true, "port": true}, mysqlCredentials{user: "me", pass: "secret", host: "db2", port: "3308"}},
+		{"default port given", mysqlCredentials{port: "3306"}, map[string]bool{"port": true}, mysqlCredentials{user: "login", pass: "fromfile", host: "db1", port: "3306"}},
+		{"dsn given", mysqlCredentials{user: "dsn", pass: "dsnpass", sock: "/tmp/mysql.sock", port: "3306"}, map[string]bool{"dsn": true}, mysqlCredentials{user: "dsn", pass: "dsnpass", sock: "/tmp/mysql.sock", port: "3306"}},
+		{"environment password", mysqlCredentials{pass: "fromenv", port: "3306"}, nil, mysqlCredentials{user: "login", pass: "fromenv", host: "db1", port: "3307"}},
+	}
+
+	for _, tt := range tests {
+		dbi := tt.dbi
+		err := dbi.lookupCredentials("mylogin", "", tt.setFlags)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if dbi.user != tt.expected.user || dbi.pass != tt.expected.pass || dbi.host != tt.expected.host || dbi.port != tt.expected.port || dbi.sock != tt.expected.sock {
+			t.Errorf("%s: credentials %+v, expected %+v", tt.name, dbi, tt.expected)
+		}
+	}
+
+	var dbi mysqlCredentials
+	err = dbi.lookupCredentials("mylogin", "missing", nil)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing login path returned %v", err)
+	}
+}
+
+func TestKeychainPasswordWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("only windows has no keychain")
+	}
+
+	_, err := keychainPassword("trite", "me")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("keychainPassword on windows returned %v", err)
+	}
+}
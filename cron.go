@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed 5 field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minute map[int]bool
+	hour   map[int]bool
+	dom    map[int]bool
+	month  map[int]bool
+	dow    map[int]bool
+	anyDom bool
+	anyDow bool
+}
+
+// parseCron parses a standard 5 field cron expression. Fields support *, lists, ranges and steps (e.g. */15, 1-5, 0,30).
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Cron expression %q must have 5 fields", expr)
+	}
+
+	var sched cronSchedule
+	var err error
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	sets := []*map[int]bool{&sched.minute, &sched.hour, &sched.dom, &sched.month, &sched.dow}
+	for i, field := range fields {
+		*sets[i], err = parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("Cron expression %q - %s", expr, err)
+		}
+	}
+
+	// Sunday may be written as 7
+	if sched.dow[7] {
+		sched.dow[0] = true
+	}
+
+	sched.anyDom = fields[2] == "*"
+	sched.anyDow = fields[4] == "*"
+
+	return &sched, nil
+}
+
+// parseCronField returns the set of values matched by one cron field
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+
+	// Allow 7 for Sunday in the day of week field
+	if max == 6 {
+		max = 7
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+// next returns the first time after t matching the schedule
+func (sched *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Searching minute by minute is cheap and a matching time always exists within 5 years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if sched.month[int(t.Month())] && sched.dayMatches(t) && sched.hour[t.Hour()] && sched.minute[t.Minute()] {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+
+	return limit
+}
+
+// dayMatches follows cron semantics where a restricted day of month or day of week matches if either matches
+func (sched *cronSchedule) dayMatches(t time.Time) bool {
+	dom := sched.dom[t.Day()]
+	dow := sched.dow[int(t.Weekday())]
+
+	switch {
+	case sched.anyDom && sched.anyDow:
+		return true
+	case sched.anyDom:
+		return dow
+	case sched.anyDow:
+		return dom
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// dataDirectoryOption matches the DATA DIRECTORY table option on the closing line of a create table statement, partition definitions are not matched
+var dataDirectoryOption = regexp.MustCompile(`(?m)^\)[^\n]*? DATA DIRECTORY='((?:[^'\\]|\\.|'')*)'`)
+
+// dataDirectory returns the DATA DIRECTORY of a create table statement or a blank string when the table is stored in the datadir
+func dataDirectory(stmt string) string {
+	m := dataDirectoryOption.FindStringSubmatch(stmt)
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
+
+// parseDataDirectories parses the comma separated -dataDirectories list. Each entry is a directory tables may be created in with DATA DIRECTORY,
+// or a mysql:host pair when MySQL sees the directory at another path like -datadirMap.
+func parseDataDirectories(list string) ([]datadirMapStruct, error) {
+	var dirs []datadirMapStruct
+	if list == "" {
+		return dirs, nil
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, ":") {
+			entry += ":" + entry
+		}
+
+		m, err := parseDatadirMap(entry)
+		if err != nil {
+			return nil, fmt.Errorf("-dataDirectories entries must be absolute paths or mysql:host path pairs, %s is not", entry)
+		}
+		dirs = append(dirs, m)
+	}
+
+	return dirs, nil
+}
+
+// hostDataDirectory returns the path on this host of a DATA DIRECTORY as MySQL sees it. Only the datadir and the -dataDirectories are accepted,
+// a create statement from the server cannot make the client write anywhere else.
+func hostDataDirectory(dir string, dirs []datadirMapStruct) (string, error) {
+	for _, m := range dirs {
+		if hostDir, ok := m.translate(dir); ok {
+			return hostDir, nil
+		}
+	}
+
+	return "", fmt.Errorf("DATA DIRECTORY '%s' is not in the datadir or a directory allowed with -dataDirectories", dir)
+}
+
+// tableDataDirectory fetches the create statement of an InnoDB table to find whether its tablespace is created outside of the datadir with DATA DIRECTORY.
+// Files are written to the directory so it must be an absolute path without .. elements from a verified create statement, it is returned as the path on this host.
+func tableDataDirectory(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct) (string, error) {
+	url := joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension)
+	resp, err := httpRequest(downloadInfo.ctx, "GET", url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	checkHTTP(resp, url)
+
+	stmt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	err = dumpSums.verify(downloadInfo.sourceSchema+"/tables/"+downloadInfo.sourceTable+sqlExtension, stmt)
+	if err != nil {
+		return "", err
+	}
+
+	dir := dataDirectory(string(stmt))
+	if dir == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(dir) || strings.Contains(dir, "..") {
+		return "", fmt.Errorf("DATA DIRECTORY '%s' is not an absolute path", dir)
+	}
+
+	return hostDataDirectory(dir, clientConfig.dataDirectories)
+}
+
+// schemaDir returns the directory the table files are restored to, the schema directory under the DATA DIRECTORY of the table or under the datadir
+func (downloadInfo *downloadInfoStruct) schemaDir() string {
+	base := downloadInfo.mysqldir
+	if downloadInfo.dataDirectory != "" {
+		base = downloadInfo.dataDirectory
+	}
+
+	return filepath.Join(base, localFilename(downloadInfo.schema, downloadInfo.lowerCaseFiles))
+}
+
+// makeSchemaDir creates the schema directory under a DATA DIRECTORY owned like restored files, MySQL only creates it when the table is created after the download
+func (downloadInfo *downloadInfoStruct) makeSchemaDir() error {
+	dir := downloadInfo.schemaDir()
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		os.Chown(dir, downloadInfo.uid, downloadInfo.gid)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// datadirMapStruct translates the datadir reported by a containerized MySQL to the path it is mounted at on the host
+type datadirMapStruct struct {
+	container string
+	host      string
+}
+
+// parseDatadirMap parses a container:host -datadirMap value
+func parseDatadirMap(s string) (datadirMapStruct, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+		return datadirMapStruct{}, fmt.Errorf("-datadirMap must be an absolute container path and host path separated by a colon (e.g. /var/lib/mysql:/srv/mysql-data)")
+	}
+
+	return datadirMapStruct{container: filepath.Clean(parts[0]), host: filepath.Clean(parts[1])}, nil
+}
+
+// translate returns the host path of a path inside the container
+func (m datadirMapStruct) translate(path string) (string, bool) {
+	path = filepath.Clean(path)
+	if path == m.container {
+		return m.host, true
+	}
+	if strings.HasPrefix(path, m.container+"/") {
+		return m.host + strings.TrimPrefix(path, m.container), true
+	}
+
+	return path, false
+}
+
+// resolveDatadir returns the host path of the MySQL datadir. A datadir that does not exist on this host is looked up in the mounts of running Docker containers,
+// a mount is only used when the auto.cnf in it has the server_uuid of the instance trite is connected to.
+func resolveDatadir(datadir string, m datadirMapStruct, serverUUID string) (string, error) {
+	if m.container != "" {
+		hostDir, ok := m.translate(datadir)
+		if !ok {
+			return "", fmt.Errorf("The MySQL datadir %s is not under the -datadirMap container path %s", datadir, m.container)
+		}
+		if _, err := os.Stat(hostDir); err != nil {
+			return "", fmt.Errorf("The MySQL datadir %s is mapped to %s which cannot be used on this host - %s", datadir, hostDir, err)
+		}
+
+		return hostDir, nil
+	}
+
+	if _, err := os.Stat(datadir); err == nil {
+		return datadir, nil
+	}
+
+	// MySQL is probably running in a container with the datadir mounted from elsewhere on the host
+	mounts := dockerMounts(datadir)
+	if len(mounts) == 0 {
+		return "", fmt.Errorf("The MySQL datadir %s does not exist on this host. If MySQL runs in a container use -datadirMap=%s:<host path of the mounted datadir>", datadir, datadir)
+	}
+
+	// Other MySQL containers on the host mount the same container path, writing into their datadir would corrupt another instance
+	var found, matched []string
+	for _, mount := range mounts {
+		found = append(found, mount.container+":"+mount.host)
+		hostDir, _ := mount.translate(datadir)
+		if serverUUID != "" && datadirUUID(hostDir) == serverUUID {
+			matched = append(matched, hostDir)
+		}
+	}
+
+	switch {
+	case len(matched) == 1:
+		fmt.Println("MySQL appears to run in a container, using datadir", matched[0], "mounted at", datadir, "with server_uuid", serverUUID)
+
+		return matched[0], nil
+	case serverUUID == "":
+		return "", fmt.Errorf("The MySQL datadir %s does not exist on this host and the server has no server_uuid to identify the container mounting it (%s), choose one with -datadirMap", datadir, strings.Join(found, ", "))
+	}
+
+	return "", fmt.Errorf("The MySQL datadir %s does not exist on this host and no single running container mount has an auto.cnf with server_uuid %s (%s), choose one with -datadirMap", datadir, serverUUID, strings.Join(found, ", "))
+}
+
+// datadirUUID returns the server-uuid from the auto.cnf in a datadir, an empty string when there is none
+func datadirUUID(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "auto.cnf"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "server-uuid" {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+
+	return ""
+}
+
+// dockerMounts returns the mounts of running Docker containers which contain datadir. Nothing is returned when the docker cli is unavailable.
+func dockerMounts(datadir string) []datadirMapStruct {
+	ids, err := exec.Command("docker", "ps", "-q").Output()
+	if err != nil {
+		return nil
+	}
+
+	var mounts []datadirMapStruct
+	for _, id := range strings.Fields(string(ids)) {
+		out, err := exec.Command("docker", "inspect", "--format", "{{range .Mounts}}{{.Destination}}:{{.Source}}\n{{end}}", id).Output()
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			m, err := parseDatadirMap(line)
+			if err != nil {
+				continue
+			}
+			if _, ok := m.translate(datadir); ok {
+				mounts = append(mounts, m)
+			}
+		}
+	}
+
+	return mounts
+}
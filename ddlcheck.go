@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// createObjectKeywords are the object types a create statement can make, the first one found names the type of the statement
+var createObjectKeywords = map[string]bool{
+	"DATABASE": true, "SCHEMA": true, "TABLE": true, "VIEW": true, "PROCEDURE": true, "FUNCTION": true, "TRIGGER": true, "EVENT": true,
+	"INDEX": true, "USER": true, "ROLE": true, "SERVER": true, "TABLESPACE": true, "LOGFILE": true, "SPATIAL": true,
+}
+
+// storedProgramTypes are the object types whose bodies may hold BEGIN ... END and CASE ... END blocks with semicolons
+var storedProgramTypes = map[string]bool{"PROCEDURE": true, "FUNCTION": true, "TRIGGER": true, "EVENT": true}
+
+// sessionValue matches the sql_mode, character set, collation and time zone values objects are created with
+var sessionValue = regexp.MustCompile(`^[A-Za-z0-9_,:+./-]*$`)
+
+// sqlToken is a word, quoted name or punctuation of a statement outside of strings and comments
+type sqlToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSQL splits a statement into tokens. Strings and comments are skipped but the contents of /*!NNNNN ... */ version comments are run by MySQL so they are tokenized.
+func tokenizeSQL(stmt string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	var versionComment bool
+
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '#' || (c == '-' && strings.HasPrefix(stmt[i:], "-- ")) || (c == '-' && strings.HasPrefix(stmt[i:], "--\n")):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+
+		case strings.HasPrefix(stmt[i:], "/*!"):
+			i += 3
+			for i < len(stmt) && stmt[i] >= '0' && stmt[i] <= '9' {
+				i++
+			}
+			versionComment = true
+
+		case c == '*' && versionComment && strings.HasPrefix(stmt[i:], "*/"):
+			i += 2
+			versionComment = false
+
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(stmt); j++ {
+				if stmt[j] == '\\' && c != '`' {
+					j++
+					continue
+				}
+				if stmt[j] == c {
+					if j+1 < len(stmt) && stmt[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(stmt) {
+				return nil, fmt.Errorf("unterminated %c quote", c)
+			}
+			tokens = append(tokens, sqlToken{text: stmt[i+1 : j], quoted: true})
+			i = j + 1
+
+		case c == '_' || c == '$' || c == '@' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+			j := i
+			for j < len(stmt) && (stmt[j] == '_' || stmt[j] == '$' || stmt[j] >= '0' && stmt[j] <= '9' || stmt[j] >= 'a' && stmt[j] <= 'z' || stmt[j] >= 'A' && stmt[j] <= 'Z' || stmt[j] >= 0x80) {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			tokens = append(tokens, sqlToken{text: strings.ToUpper(stmt[i:j])})
+			i = j
+
+		default:
+			tokens = append(tokens, sqlToken{text: string(c)})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// checkCreateStatement ensures a create statement fetched from a trite server is a single create statement of the expected object type, such as TABLE or PROCEDURE.
+// Stored program bodies may contain semicolons inside BEGIN ... END and CASE ... END blocks, any other semicolon must end the statement. Tables, views and databases have no blocks, words such as begin are names in them.
+func checkCreateStatement(stmt string, objectType string) error {
+	tokens, err := tokenizeSQL(stmt)
+	if err != nil {
+		return fmt.Errorf("Rejected %s create statement - %s", strings.ToLower(objectType), err)
+	}
+	if len(tokens) == 0 || tokens[0].quoted || tokens[0].text != "CREATE" {
+		return fmt.Errorf("Rejected %s create statement, it does not start with CREATE", strings.ToLower(objectType))
+	}
+
+	// The first object keyword is the type of object created, after clauses such as OR REPLACE, ALGORITHM and DEFINER
+	var found string
+	for _, token := range tokens[1:] {
+		if !token.quoted && createObjectKeywords[token.text] {
+			found = token.text
+			break
+		}
+	}
+	if found == "SCHEMA" {
+		found = "DATABASE"
+	}
+	if found != strings.ToUpper(objectType) {
+		return fmt.Errorf("Rejected %s create statement, it creates a %s", strings.ToLower(objectType), strings.ToLower(found))
+	}
+
+	// Only a trailing semicolon may end the statement outside of a block
+	blocks := storedProgramTypes[found]
+	var depth int
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.quoted {
+			continue
+		}
+
+		// A word after a dot is part of a qualified name such as NEW.begin
+		qualified := i > 0 && !tokens[i-1].quoted && tokens[i-1].text == "."
+
+		switch token.text {
+		case "BEGIN", "CASE":
+			if blocks && !qualified {
+				depth++
+			}
+		case "END":
+			if !blocks || qualified {
+				continue
+			}
+			if i+1 < len(tokens) && !tokens[i+1].quoted {
+				switch tokens[i+1].text {
+				// END IF, END LOOP, END WHILE and END REPEAT close blocks that are not counted
+				case "IF", "LOOP", "WHILE", "REPEAT":
+					continue
+				// END CASE closes a CASE statement, the CASE after it does not open another
+				case "CASE":
+					i++
+				}
+			}
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("Rejected %s create statement, it has an END without a BEGIN or CASE", strings.ToLower(objectType))
+			}
+		case ";":
+			if depth > 0 {
+				continue
+			}
+			for _, rest := range tokens[i+1:] {
+				if rest.quoted || rest.text != ";" {
+					return fmt.Errorf("Rejected %s create statement, it contains more than one statement", strings.ToLower(objectType))
+				}
+			}
+			return nil
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("Rejected %s create statement, it has a BEGIN or CASE block that is not closed", strings.ToLower(objectType))
+	}
+
+	return nil
+}
+
+// checkSessionValue ensures a session variable value from a trite server cannot change the set statement it is placed in
+func checkSessionValue(name string, value string) error {
+	if !sessionValue.MatchString(value) {
+		return fmt.Errorf("Rejected %s value %q", name, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestCheckCreateStatement(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectType string
+		stmt       string
+		ok         bool
+	}{
+		{"table", "table", "CREATE TABLE `t` (`id` int NOT NULL, PRIMARY KEY (`id`)) ENGINE=InnoDB", true},
+		{"table trailing semicolon", "table", "CREATE TABLE t (id int);", true},
+		{"table trailing semicolons", "table", "CREATE TABLE t (id int);;", true},
+		{"table column named begin", "table", "CREATE TABLE t (begin int, end int)", true},
+		{"table begin column injection", "table", "CREATE TABLE t (begin int); DROP DATABASE prod", false},
+		{"table case column injection", "table", "CREATE TABLE t (`a` int, case int); DROP DATABASE prod", false},
+		{"table second statement", "table", "CREATE TABLE t (id int); DROP DATABASE prod", false},
+		{"table semicolon in string", "table", "CREATE TABLE t (id int) COMMENT='a;b'", true},
+		{"table semicolon in quoted name", "table", "CREATE TABLE `a;b` (id int)", true},
+		{"table semicolon in comment", "table", "CREATE TABLE t (id int) /* a; b */", true},
+		{"table version comment statement", "table", "CREATE TABLE t (id int) /*!50100 ; DROP DATABASE prod */", false},
+		{"wrong type", "table", "CREATE VIEW v AS SELECT 1", false},
+		{"not create", "table", "DROP TABLE t", false},
+		{"view", "view", "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v` AS select case when 1 then 2 end AS `c`", true},
+		{"view case injection", "view", "CREATE VIEW v AS SELECT CASE WHEN 1 THEN 2; DROP DATABASE prod", false},
+		{"database", "database", "CREATE DATABASE `db` /*!40100 DEFAULT CHARACTER SET utf8mb4 */", true},
+		{"schema", "database", "CREATE SCHEMA db", true},
+		{"database injection", "database", "CREATE DATABASE begin; DROP DATABASE prod", false},
+		{"procedure", "procedure", "CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", true},
+		{"procedure nested blocks", "procedure", "CREATE PROCEDURE p(x int) BEGIN IF x > 0 THEN SELECT 1; END IF; WHILE x > 0 DO SET x = x - 1; END WHILE; lbl: LOOP LEAVE lbl; END LOOP; REPEAT SET x = x + 1; UNTIL x > 5 END REPEAT; END", true},
+		{"procedure case statement", "procedure", "CREATE PROCEDURE p(x int) BEGIN CASE x WHEN 1 THEN SELECT 1; ELSE SELECT 2; END CASE; SELECT CASE WHEN x THEN 1 END; END", true},
+		{"procedure labeled block", "procedure", "CREATE PROCEDURE p() lbl: BEGIN SELECT 1; END lbl", true},
+		{"procedure statement after end", "procedure", "CREATE PROCEDURE p() BEGIN SELECT 1; END; DROP DATABASE prod", false},
+		{"procedure unclosed block", "procedure", "CREATE PROCEDURE p() BEGIN SELECT 1; DROP DATABASE prod", false},
+		{"procedure extra end", "procedure", "CREATE PROCEDURE p() BEGIN SELECT 1; END END; DROP DATABASE prod", false},
+		{"function", "function", "CREATE FUNCTION f(x int) RETURNS int DETERMINISTIC BEGIN DECLARE y int; SET y = x * 2; RETURN y; END", true},
+		{"trigger", "trigger", "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END", true},
+		{"trigger single statement", "trigger", "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.a = 1", true},
+		{"trigger qualified begin injection", "trigger", "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.begin = 1; DROP DATABASE prod", false},
+		{"event", "event", "CREATE EVENT e ON SCHEDULE EVERY 1 DAY DO BEGIN DELETE FROM t; OPTIMIZE TABLE t; END", true},
+		{"unterminated quote", "table", "CREATE TABLE t (id int) COMMENT='a", false},
+	}
+
+	for _, tt := range tests {
+		err := checkCreateStatement(tt.stmt, tt.objectType)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: statement was accepted", tt.name)
+		}
+	}
+}
+
+func TestCheckSessionValue(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", true},
+		{"+00:00", true},
+		{"Europe/Berlin", true},
+		{"utf8mb4_0900_ai_ci", true},
+		{"", true},
+		{"a'; DROP DATABASE prod; --", false},
+		{"a b", false},
+	}
+
+	for _, tt := range tests {
+		err := checkSessionValue("sql_mode", tt.value)
+		if tt.ok != (err == nil) {
+			t.Errorf("checkSessionValue(%q) = %v", tt.value, err)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dedupMaxSize is the largest file kept for reuse by -dedup, identical tables in multi-tenant layouts are mostly small or empty
+const dedupMaxSize = 64 * 1048576
+
+// dedupStruct keeps pristine copies of downloaded files by checksum so identical files queued later are copied locally instead of downloaded again.
+// Copies are needed because importing a tablespace modifies the downloaded file.
+type dedupStruct struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]string
+}
+
+// dedup is the download deduplication cache. A nil cache disables deduplication.
+var dedup *dedupStruct
+
+// openDedup creates the temporary directory deduplicated files are kept in
+func openDedup() error {
+	dir, err := ioutil.TempDir("", "trite_dedup")
+	if err != nil {
+		return err
+	}
+
+	dedup = &dedupStruct{dir: dir, files: make(map[string]string)}
+	onExit(closeDedup)
+
+	return nil
+}
+
+// closeDedup removes the deduplicated file copies
+func closeDedup() {
+	if dedup == nil {
+		return
+	}
+
+	os.RemoveAll(dedup.dir)
+	dedup = nil
+}
+
+// lookup returns the path of a kept file with the checksum sum or a blank string
+func (d *dedupStruct) lookup(sum string) string {
+	if d == nil || sum == "" {
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.files[sum]
+}
+
+// add keeps a copy of a downloaded file for reuse
+func (d *dedupStruct) add(sum string, file string) {
+	if d == nil || sum == "" || d.lookup(sum) != "" {
+		return
+	}
+
+	kept := filepath.Join(d.dir, sum)
+	if copyFile(file, kept) != nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.files[sum] = kept
+	d.mu.Unlock()
+}
+
+// copyFile copies the contents of src to dst
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// fetchSum returns the sha256 checksum of a backup file from the trite server, older servers do not provide checksums and a blank sum is returned
+func fetchSum(ctx context.Context, url string) string {
+	resp, err := httpRequest(ctx, "GET", url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return ""
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 128))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// sumRequestHeader asks the server to hash a backup file while it is sent. Clients verifying downloads set it so the checksum request does not read the file a second time.
+const sumRequestHeader = "X-Trite-Sum"
+
+// sumCacheStruct holds the checksums of served backup files. The backup does not change while it is served so each file is hashed once,
+// while it is sent to a client verifying the download when possible. Checksum requests for a file being hashed wait for the hash.
+type sumCacheStruct struct {
+	mu      sync.Mutex
+	sums    map[string]string
+	hashing map[string]*sumHashingStruct
+}
+
+// sumHashingStruct counts the hashes of a file in progress, done is closed whenever one of them ends
+type sumHashingStruct struct {
+	n    int
+	done chan struct{}
+}
+
+// sumResponseWriter hashes a response body as it is written
+type sumResponseWriter struct {
+	http.ResponseWriter
+	h             hash.Hash
+	status        int
+	contentLength string
+	written       int64
+}
+
+// newSumCache returns an empty checksum cache
+func newSumCache() *sumCacheStruct {
+	return &sumCacheStruct{sums: make(map[string]string), hashing: make(map[string]*sumHashingStruct)}
+}
+
+// begin records a hash of file in progress, c.mu must be held
+func (c *sumCacheStruct) begin(file string) {
+	s, ok := c.hashing[file]
+	if !ok {
+		s = &sumHashingStruct{done: make(chan struct{})}
+		c.hashing[file] = s
+	}
+	s.n++
+}
+
+// end stores the checksum of a hash of file that read the whole file and wakes the checksum requests waiting for it
+func (c *sumCacheStruct) end(file string, sum string, complete bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if complete {
+		c.sums[file] = sum
+	}
+
+	s := c.hashing[file]
+	close(s.done)
+	s.n--
+	if s.n == 0 {
+		delete(c.hashing, file)
+	} else {
+		s.done = make(chan struct{})
+	}
+}
+
+// get returns the checksum of a file. A file being sent to a client verifying it is not read again, otherwise the file is hashed once for every request waiting.
+func (c *sumCacheStruct) get(file string) (string, error) {
+	for {
+		c.mu.Lock()
+		if sum, ok := c.sums[file]; ok {
+			c.mu.Unlock()
+			return sum, nil
+		}
+
+		// A send that is cut short leaves no checksum and the file is hashed by the next request
+		if s, ok := c.hashing[file]; ok {
+			done := s.done
+			c.mu.Unlock()
+			<-done
+			continue
+		}
+		c.begin(file)
+		c.mu.Unlock()
+
+		sum, err := fileSum(file)
+		c.end(file, sum, err == nil)
+
+		return sum, err
+	}
+}
+
+// hashHandler hashes the backup files h sends whole to clients asking for the checksum with sumRequestHeader. The hash is of the bytes sent
+// before they are compressed, so decrypted files are hashed as the client writes them.
+func (c *sumCacheStruct) hashHandler(backupPath string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.Header.Get(sumRequestHeader) == "" || r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		file := filepath.Join(backupPath, filepath.FromSlash(filepath.Clean("/"+r.URL.Path)))
+		c.mu.Lock()
+		_, ok := c.sums[file]
+		if !ok {
+			c.begin(file)
+		}
+		c.mu.Unlock()
+		if ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &sumResponseWriter{ResponseWriter: w, h: sumPool.Get().(hash.Hash)}
+		sw.h.Reset()
+		defer sumPool.Put(sw.h)
+
+		var sum string
+		var complete bool
+		defer func() { c.end(file, sum, complete) }()
+
+		h.ServeHTTP(sw, r)
+		sum = hex.EncodeToString(sw.h.Sum(nil))
+
+		// Files sent for compression have no Content-Length, the whole file was sent when its size was written
+		if sw.contentLength == "" {
+			if fi, err := os.Stat(file); err == nil {
+				sw.contentLength = strconv.FormatInt(fi.Size(), 10)
+			}
+		}
+		complete = sw.status == http.StatusOK && sw.contentLength == strconv.FormatInt(sw.written, 10)
+	})
+}
+
+// WriteHeader records the status and length of the response, compressing writers remove the length from the header
+func (w *sumResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.contentLength = w.Header().Get("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write hashes the bytes written
+func (w *sumResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.h.Write(b[:n])
+	w.written += int64(n)
+
+	return n, err
+}
+
+// sumsHandler serves the sha256 checksum of backup files from the cache
+func sumsHandler(backupPath string, sums *sumCacheStruct) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := filepath.Join(backupPath, filepath.FromSlash(filepath.Clean("/"+r.URL.Path)))
+
+		sum, err := sums.get(file)
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		io.WriteString(w, sum+"\n")
+	}
+}
+
+// fileSum returns the hex encoded sha256 checksum of a file
+func fileSum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
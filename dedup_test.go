@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSumsHashedWhileServed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte(strings.Repeat("trite", 100000))
+	want := sha256.Sum256(data)
+
+	mux := http.NewServeMux()
+	handleBackups(mux, dir, http.FileServer(http.Dir(dir)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(path string, header http.Header) (int, string) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		cached bool
+	}{
+		{"raw", "/backups/raw.ibd", sumHeader(make(http.Header), true), true},
+		{"gzip", "/gz/gzip.ibd", sumHeader(make(http.Header), true), true},
+		{"zstd", "/zstd/zstd.ibd", sumHeader(make(http.Header), true), true},
+		{"not verified", "/backups/plain.ibd", make(http.Header), false},
+		{"range", "/backups/range.ibd", rangeHeader(sumHeader(make(http.Header), true), 10), false},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(dir, path.Base(tt.path))
+		err = ioutil.WriteFile(file, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		status, _ := get(tt.path, tt.header)
+		if status != http.StatusOK && status != http.StatusPartialContent {
+			t.Fatalf("%s: %d returned downloading %s", tt.name, status, tt.path)
+		}
+
+		// The checksum of a file hashed while it was sent is answered without reading the file again
+		os.Remove(file)
+		status, sum := get("/sums/"+path.Base(tt.path), nil)
+		if tt.cached && (status != http.StatusOK || sum != hex.EncodeToString(want[:])) {
+			t.Errorf("%s: checksum %d %q, expected %x", tt.name, status, sum, want)
+		}
+		if !tt.cached && status != http.StatusNotFound {
+			t.Errorf("%s: checksum %d %q, the file was not hashed while it was sent", tt.name, status, sum)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+)
+
+// autoIncrementOption matches the AUTO_INCREMENT table option on the closing line of a create table statement, column definitions are not matched
+var autoIncrementOption = regexp.MustCompile(`(?m)^(\)[^\n]*?) AUTO_INCREMENT=[0-9]+`)
+
+// dumpDeterministic writes dump mode output to a directory without a time stamp so dumps of an unchanged server are identical
+var dumpDeterministic bool
+
+// dumpStripAutoIncrement removes the AUTO_INCREMENT counter from dumped create table statements
+var dumpStripAutoIncrement bool
+
+// stripAutoIncrement removes the AUTO_INCREMENT table option from a create table statement, the counter changes with every insert so dumps would differ
+func stripAutoIncrement(stmt string) string {
+	return autoIncrementOption.ReplaceAllString(stmt, "$1")
+}
+
+// replaceDump moves a finished dump to dumpdir replacing the previous dump there. A dumpdir that is not a finished dump is never removed.
+func replaceDump(tmpdir string, dumpdir string) error {
+	if _, err := os.Stat(dumpdir); err == nil {
+		if _, err := os.Stat(path.Join(dumpdir, dumpSumsFile)); err != nil {
+			return fmt.Errorf("%s exists and is not a finished dump, it was not replaced - %s", dumpdir, err)
+		}
+
+		err = os.RemoveAll(dumpdir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmpdir, dumpdir)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discoverTimeout limits how long each candidate trite server is tried during discovery
+const discoverTimeout = 5 * time.Second
+
+// serverCandidateStruct is a trite server that may be restored from
+type serverCandidateStruct struct {
+	server string
+	port   string
+}
+
+// isSRVName reports whether -triteServer is a DNS SRV record name such as _trite._tcp.backup.example.com
+func isSRVName(server string) bool {
+	return strings.HasPrefix(server, "_") && strings.Contains(server, "._tcp.")
+}
+
+// discoverServer picks the trite server to restore from. An SRV record name is looked up and its targets tried in priority and weight order,
+// a comma separated list is tried in order. The first server answering is used, a single server is returned without being tried.
+// The other servers answering with the same backup generation become mirrors the restore fails over to.
+func discoverServer(server string, port string) (string, string, error) {
+	var candidates []serverCandidateStruct
+	switch {
+	case isSRVName(server):
+		_, records, err := net.LookupSRV("", "", server)
+		if err != nil {
+			return "", "", fmt.Errorf("Could not look up the trite server SRV record %s - %s", server, err)
+		}
+		for _, record := range records {
+			candidates = append(candidates, serverCandidateStruct{server: strings.TrimSuffix(record.Target, "."), port: strconv.Itoa(int(record.Port))})
+		}
+	case strings.Contains(server, ","):
+		for _, s := range strings.Split(server, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				candidates = append(candidates, serverCandidateStruct{server: s, port: port})
+			}
+		}
+	default:
+		return server, port, nil
+	}
+
+	client := &http.Client{Timeout: discoverTimeout}
+	var chosen *serverCandidateStruct
+	var generation string
+	var bases []string
+	for i, c := range candidates {
+		base := serverURL(c.server, c.port)
+		gen, err := probeGeneration(client, base)
+		if err != nil {
+			fmt.Println("Trite server", c.server, "is not reachable -", err)
+			continue
+		}
+
+		if chosen == nil {
+			chosen = &candidates[i]
+			generation = gen
+			bases = append(bases, base)
+			fmt.Println("Using trite server", base)
+		} else if generation == "" {
+			// Servers without a generation cannot be told apart, appending another backups bytes to a file would corrupt it
+			fmt.Println("Trite server", base, "is not used as a mirror, only servers started with the same -generation are mirrors")
+		} else if gen == generation {
+			bases = append(bases, base)
+			fmt.Println("Mirrored by trite server", base)
+		} else {
+			fmt.Println("Trite server", base, "serves a different backup generation and is not used as a mirror")
+		}
+	}
+	if chosen == nil {
+		return "", "", fmt.Errorf("None of the trite servers in %s are reachable", server)
+	}
+
+	if len(bases) > 1 {
+		mirrors = &mirrorsStruct{bases: bases}
+	}
+
+	return chosen.server, chosen.port, nil
+}
+
+// probeGeneration returns the generation served by the trite server at base within the discovery timeout
+func probeGeneration(client *http.Client, base string) (string, error) {
+	req, err := http.NewRequest("GET", joinURL(base, "generation"), nil)
+	if err != nil {
+		return "", err
+	}
+	setAuthHeader(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", joinURL(base, "generation"), resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
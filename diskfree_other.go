@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// diskFree returns the bytes available to unprivileged users on the filesystem holding dir
+func diskFree(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
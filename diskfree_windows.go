@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+// diskFree is not supported on Windows where the disk space check is skipped
+func diskFree(dir string) (uint64, error) {
+	return 0, fmt.Errorf("free disk space is not checked on Windows")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// fetchSizes returns the table sizes of the backup served by a trite server, older servers do not serve sizes
+func fetchSizes(sizesURL string) (sizesStruct, error) {
+	var sizes sizesStruct
+
+	resp, err := httpGet(sizesURL)
+	if err != nil {
+		return sizes, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return sizes, fmt.Errorf("%d returned from: %s", resp.StatusCode, sizesURL)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&sizes)
+
+	return sizes, err
+}
+
+// restoreSize returns the bytes the selected tables will download. The sizes served by the trite server are used when available, otherwise the .ibd or .MYD & .MYI file of each table is sized with a HEAD request.
+func restoreSize(sizes sizesStruct, sizesErr error, backurl string, schemas []string, schemaTables map[string][]string) int64 {
+	var total int64
+	for _, schema := range schemas {
+		for _, table := range schemaTables[schema] {
+			table, _ = parseFileName(table)
+
+			if sizesErr == nil {
+				if schemaSize := sizes.Schemas[schema]; schemaSize != nil {
+					total += schemaSize.Tables[table]
+				}
+				continue
+			}
+
+			schemaFilename, tableFilename := schema, table
+			if mysqlUTF8.NeedsEncoding(schema) {
+				schemaFilename = mysqlUTF8.EncodeFilename(schema)
+			}
+			if mysqlUTF8.NeedsEncoding(table) {
+				tableFilename = mysqlUTF8.EncodeFilename(table)
+			}
+			for _, extensions := range [][]string{{".ibd"}, {".MYD", ".MYI"}} {
+				var found bool
+				for _, extension := range extensions {
+					resp, err := httpHead(joinURL(backurl, schemaFilename, tableFilename+extension))
+					if err == nil && resp.StatusCode == 200 && resp.ContentLength > 0 {
+						total += resp.ContentLength
+						found = true
+					}
+				}
+				if found {
+					break
+				}
+			}
+		}
+	}
+
+	return total
+}
+
+// checkDiskSpace compares the bytes a restore will download with the free space of the MySQL datadir, with -diskSpace=abort a restore that does not fit exits before anything is changed
+func checkDiskSpace(clientConfig clientConfigStruct, mysqldir string, size int64) {
+	if clientConfig.diskSpace == "skip" {
+		return
+	}
+
+	free, err := diskFree(mysqldir)
+	if err != nil {
+		warnf(levelWarn, "Unable to check the free space of %s - %s", mysqldir, err)
+		return
+	}
+	if uint64(size) <= free {
+		return
+	}
+
+	msg := fmt.Sprintf("The restore downloads %s into %s which only has %s free", formatSize(size), mysqldir, formatSize(int64(free)))
+	if clientConfig.diskSpace == "warn" {
+		warnf(levelWarn, "%s", msg)
+		return
+	}
+
+	journal.printf("ERROR", "%s", msg)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, msg)
+	fmt.Fprintln(os.Stderr, "Free up space, restore fewer tables with -schemas or -tables, or use -diskSpace=warn to restore anyway")
+	fmt.Fprintln(os.Stderr)
+	fatalExit(1)
+}
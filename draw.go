@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 )
 
+// lineDrawInterval is how often line based progress is printed
+const lineDrawInterval = 30 * time.Second
+
 // drawFunc is the callback type for drawing progress.
 type drawFunc func(string, int64, int64) error
 
@@ -40,8 +44,22 @@ func drawTerminalf(w io.Writer, f drawTextFormatFunc) drawFunc {
 	}
 }
 
+// drawLinef returns a drawFunc that prints progress as timestamped lines for
+// output that is not a terminal.
+func drawLinef(w io.Writer, f drawTextFormatFunc) drawFunc {
+	return func(prefix string, progress, total int64) error {
+		// There is no line to blank out
+		if progress == -1 && total == -1 {
+			return nil
+		}
+
+		_, err := fmt.Fprintln(w, time.Now().Format(time.RFC3339), f(prefix, progress, total))
+		return err
+	}
+}
+
 // drawTextFormatPercent is a drawTextFormatFunc that formats the progress
-// into a percentage
+// into a percentage and the sizes downloaded
 func drawTextFormatPercent(prefix string, progress, total int64) string {
-	return fmt.Sprintf("%s: %d%%", prefix, uint(float32(progress)/float32(total)*100))
+	return fmt.Sprintf("%s: %d%% (%s of %s)", prefix, uint(float32(progress)/float32(total)*100), formatSize(progress), formatSize(total))
 }
@@ -18,14 +18,19 @@ const (
 )
 
 // startDump copies creation statements for tables, procedures, functions, triggers and views to a file/directory structure at the path location that trite uses in client mode to restore tables.
-func startDump(dir string, dbi *mysqlCredentials) {
-	dumpdir := path.Join(dir, dbi.host+"_dump"+time.Now().Format(stamp))
-	fmt.Println("Dumping to:", dumpdir)
-	fmt.Println()
-
-	// Return a database connection
-	db, err := dbi.connect()
-	defer db.Close()
+func startDump(dir string, dbi *mysqlCredentials, filter tableFilterStruct, resume bool, gitCommit bool) {
+	var err error
+	if resume {
+		err = resumeDump(dir, dbi, filter)
+	} else {
+		var dumpdir string
+		dumpdir, err = runDump(dir, dbi, filter)
+
+		// Each dump is committed to git so schema changes between dumps show in the history
+		if err == nil && gitCommit {
+			err = gitCommitDump(dir, dumpdir, dbi.host)
+		}
+	}
 
 	// Problem connecting to database
 	if err != nil {
@@ -33,55 +38,155 @@ func startDump(dir string, dbi *mysqlCredentials) {
 		os.Exit(1)
 	}
 
+	warnings.exitOnWarnings()
+}
+
+// runDump performs a dump of the schemas and tables selected by filter into a new time stamped subdirectory of dir and returns the subdirectory path.
+// With -deterministic the subdirectory has no time stamp and the previous dump in it is replaced once the new dump is complete.
+func runDump(dir string, dbi *mysqlCredentials, filter tableFilterStruct) (string, error) {
+	if dumpDeterministic {
+		dumpdir := path.Join(dir, dbi.host+"_dump")
+		tmpdir := dumpdir + ".tmp"
+		fmt.Fprintln(dumpMessages(), "Dumping to:", dumpdir)
+
+		// A temporary directory left by an interrupted dump is started over
+		err := os.RemoveAll(tmpdir)
+		if err != nil {
+			return "", err
+		}
+		err = dumpInto(tmpdir, dbi, filter, false)
+		if err != nil {
+			return "", err
+		}
+		err = reportChanges(tmpdir)
+		if err != nil {
+			warnf(levelWarn, "Unable to compare the dump with -previousDump - %s", err)
+		}
+
+		return dumpdir, replaceDump(tmpdir, dumpdir)
+	}
+
+	dumpdir := path.Join(dir, dbi.host+"_dump"+time.Now().Format(stamp))
+	fmt.Fprintln(dumpMessages(), "Dumping to:", dumpdir)
+
+	err := dumpInto(dumpdir, dbi, filter, false)
+	if err != nil {
+		return "", err
+	}
+	err = reportChanges(dumpdir)
+	if err != nil {
+		warnf(levelWarn, "Unable to compare the dump with -previousDump - %s", err)
+	}
+
+	return dumpdir, nil
+}
+
+// resumeDump continues an interrupted dump in dumpdir, objects whose files were completely written are not dumped again
+func resumeDump(dumpdir string, dbi *mysqlCredentials, filter tableFilterStruct) error {
+	if _, err := os.Stat(path.Join(dumpdir, dumpSumsFile)); err == nil {
+		fmt.Fprintln(dumpMessages(), "Dump", dumpdir, "is already complete")
+		return nil
+	}
+	if _, err := os.Stat(path.Join(dumpdir, dumpProgressFile)); err != nil {
+		return fmt.Errorf("%s is not an interrupted dump, -resume takes the dump directory to continue as -dumpDir - %s", dumpdir, err)
+	}
+	fmt.Fprintln(dumpMessages(), "Resuming dump:", dumpdir)
+
+	return dumpInto(dumpdir, dbi, filter, true)
+}
+
+// dumpInto writes the create statements of the schemas and tables selected by filter to dumpdir, skipping the complete files of an interrupted dump when resuming
+func dumpInto(dumpdir string, dbi *mysqlCredentials, filter tableFilterStruct, resume bool) error {
+	out := dumpMessages()
+	fmt.Fprintln(out)
+
+	// Return a database connection
+	db, err := dbi.connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
 	// Turn off idle connections
 	db.SetMaxIdleConns(0)
 
 	// Get a list of schemas in the target database
 	db.SetMaxIdleConns(1)
-	schemas := schemaList(db)
+	var schemas []string
+	for _, schema := range schemaList(db) {
+		if filter.schema(schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	if len(schemas) == 0 {
+		warnf(levelWarn, "No schemas on %s match the -schemas and -tables filters, the dump is empty", dbi.host)
+	}
+	tsInfo := timestampInfo(db)
 
 	// Create dump directory
 	err = os.MkdirAll(dumpdir, dirPerms)
 	checkErr(err)
 
+	// Written files are recorded so the dump can be resumed if it is interrupted
+	dumpResume, err = openDumpResume(dumpdir, resume)
+	if err != nil {
+		return err
+	}
+
+	// Every dumped object is published so progress and the time left can be displayed
+	events := newEventBus()
+	events.subscribe(dumpProgress(os.Stdout, countDumpObjects(db, schemas, filter), dumpOutput))
+
 	// Schema loop
-	count := 0
 	total := 0
-	fmt.Println()
 	for _, schema := range schemas {
-		total++
 		// Dump schema create
-		fmt.Print(schema, ": ")
 		dumpSchema(db, dumpdir, schema)
+		publishDumped(events, schema, schema, "schema")
+		total++
 
 		// Dump table creation statements
-		count = dumpTables(db, dumpdir, schema)
-		total = total + count
-		fmt.Print(count, " tables, ")
+		total += dumpTables(db, dumpdir, schema, filter, events)
 
 		// Dump procedure creation statements
-		count = dumpProcs(db, dumpdir, schema)
-		total = total + count
-		fmt.Print(count, " procedures, ")
+		total += dumpProcs(db, dumpdir, schema, tsInfo, events)
 
 		// Dump function creation statements
-		count = dumpFuncs(db, dumpdir, schema)
-		total = total + count
-		fmt.Print(count, " functions, ")
+		total += dumpFuncs(db, dumpdir, schema, tsInfo, events)
 
 		// Dump trigger creation statements
-		count = dumpTriggers(db, dumpdir, schema)
-		total = total + count
-		fmt.Print(count, " triggers, ")
+		total += dumpTriggers(db, dumpdir, schema, tsInfo, events)
 
 		// Dump view creation statements
-		count = dumpViews(db, dumpdir, schema)
-		total = total + count
-		fmt.Print(count, " views\n")
+		total += dumpViews(db, dumpdir, schema, tsInfo, events)
+
+		// Dump event creation statements
+		total += dumpEvents(db, dumpdir, schema, tsInfo, events)
+
+		events.publish(tableEventStruct{Schema: schema, Status: statusSchemaDumped})
 	}
+	events.close()
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, total, "total objects dumped")
 
-	fmt.Println()
-	fmt.Println(total, "total objects dumped")
+	err = dumpResume.finish()
+	dumpResume = nil
+	if err != nil {
+		return err
+	}
+
+	// Clients verify every file they fetch against the checksums
+	return writeDumpSums(dumpdir)
+}
+
+// timestampInfo returns the time_zone and explicit_defaults_for_timestamp of the dump session. explicit_defaults_for_timestamp does not exist before MySQL 5.6.6.
+func timestampInfo(db *sql.DB) timestampInfoStruct {
+	var tsInfo timestampInfoStruct
+	db.QueryRow("select @@session.time_zone").Scan(&tsInfo.TimeZone)
+	db.QueryRow("select @@session.explicit_defaults_for_timestamp").Scan(&tsInfo.ExplicitDefaultsForTimestamp)
+
+	return tsInfo
 }
 
 // schemaList returns a string slice of schemas to process. MySQL specific schemas like mysql, information_schema and performance_schema are omitted.
@@ -109,30 +214,35 @@ func dumpSchema(db *sql.DB, dumpdir string, schema string) {
 	dir := path.Join(dumpdir, schema)
 	var err error
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
+	file := path.Join(dir, schema+sqlExtension)
+	if dumpResume.complete(file) {
+		return
+	}
+
 	var ignore string
 	var stmt string
 	err = db.QueryRow("show create schema "+addQuotes(schema)).Scan(&ignore, &stmt)
 	checkErr(err)
 
-	file := path.Join(dir, schema+sqlExtension)
 	err = ioutil.WriteFile(file, []byte(stmt+";\n"), filePerms)
 	checkErr(err)
+	dumpResume.record(file, []byte(stmt+";\n"))
 }
 
 // dumpTables creates files containing table creation statements. It processes all tables for the schema passed to it. The /tables directory is hardcoded and expected by trite client code.
-func dumpTables(db *sql.DB, dumpdir string, schema string) int {
+func dumpTables(db *sql.DB, dumpdir string, schema string, filter tableFilterStruct, events *eventBusStruct) int {
 	dir := path.Join(dumpdir, schema, "tables")
 	var err error
 	count := 0
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
 	var rows *sql.Rows
-	rows, err = db.Query("select table_name from information_schema.tables where table_schema='" + schema + "' and table_type = 'BASE TABLE'")
+	rows, err = db.Query("select table_name from information_schema.tables where table_schema='" + schema + "' and table_type = 'BASE TABLE' order by table_name")
 	checkErr(err)
 
 	var tableName string
@@ -142,13 +252,28 @@ func dumpTables(db *sql.DB, dumpdir string, schema string) int {
 		err = rows.Scan(&tableName)
 		checkErr(err)
 
+		if !filter.table(schema, tableName) {
+			continue
+		}
+
+		file := path.Join(dir, tableName+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, tableName, "table")
+			count++
+			continue
+		}
+
 		err = db.QueryRow("show create table "+addQuotes(schema)+"."+addQuotes(tableName)).Scan(&ignore, &stmt)
 		checkErr(err)
+		if dumpStripAutoIncrement {
+			stmt = stripAutoIncrement(stmt)
+		}
 
-		file := path.Join(dir, tableName+sqlExtension)
 		err = ioutil.WriteFile(file, []byte(stmt+";\n"), filePerms)
 		checkErr(err)
+		dumpResume.record(file, []byte(stmt+";\n"))
 
+		publishDumped(events, schema, tableName, "table")
 		count++
 	}
 
@@ -156,16 +281,16 @@ func dumpTables(db *sql.DB, dumpdir string, schema string) int {
 }
 
 // dumpProcs creates files containing procedure creation statements. It processes all procedures for the schema passed to it. The /procedures directory is hardcoded and expected by trite client code.
-func dumpProcs(db *sql.DB, dumpdir string, schema string) int {
+func dumpProcs(db *sql.DB, dumpdir string, schema string, tsInfo timestampInfoStruct, events *eventBusStruct) int {
 	dir := path.Join(dumpdir, schema, "procedures")
 	var err error
 	count := 0
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
 	var rows *sql.Rows
-	rows, err = db.Query("select routine_name from information_schema.routines where routine_schema='" + schema + "' and routine_type = 'PROCEDURE'")
+	rows, err = db.Query("select routine_name from information_schema.routines where routine_schema='" + schema + "' and routine_type = 'PROCEDURE' order by routine_name")
 	checkErr(err)
 
 	var procName string
@@ -173,7 +298,14 @@ func dumpProcs(db *sql.DB, dumpdir string, schema string) int {
 		err = rows.Scan(&procName)
 		checkErr(err)
 
-		var procInfo createInfoStruct
+		file := path.Join(dir, procName+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, procName, "procedure")
+			count++
+			continue
+		}
+
+		procInfo := createInfoStruct{timestampInfoStruct: tsInfo}
 		err = db.QueryRow("show create procedure "+addQuotes(schema)+"."+addQuotes(procName)).Scan(&procInfo.Name, &procInfo.SQLMode, &procInfo.Create, &procInfo.CharsetClient, &procInfo.Collation, &procInfo.DbCollation)
 		checkErr(err)
 
@@ -181,10 +313,11 @@ func dumpProcs(db *sql.DB, dumpdir string, schema string) int {
 		jbyte, err = json.MarshalIndent(procInfo, "", "  ")
 		checkErr(err)
 
-		file := path.Join(dir, procName+sqlExtension)
 		err = ioutil.WriteFile(file, jbyte, filePerms)
 		checkErr(err)
+		dumpResume.record(file, jbyte)
 
+		publishDumped(events, schema, procName, "procedure")
 		count++
 	}
 
@@ -192,16 +325,16 @@ func dumpProcs(db *sql.DB, dumpdir string, schema string) int {
 }
 
 // dumpFuncs creates files containing function creation statements. It processes all functions for the schema passed to it. The /functions directory is hardcoded and expected by trite client code.
-func dumpFuncs(db *sql.DB, dumpdir string, schema string) int {
+func dumpFuncs(db *sql.DB, dumpdir string, schema string, tsInfo timestampInfoStruct, events *eventBusStruct) int {
 	dir := path.Join(dumpdir, schema, "functions")
 	var err error
 	count := 0
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
 	var rows *sql.Rows
-	rows, err = db.Query("select routine_name from information_schema.routines where routine_schema='" + schema + "' and routine_type = 'FUNCTION'")
+	rows, err = db.Query("select routine_name from information_schema.routines where routine_schema='" + schema + "' and routine_type = 'FUNCTION' order by routine_name")
 	checkErr(err)
 
 	var funcName string
@@ -209,7 +342,14 @@ func dumpFuncs(db *sql.DB, dumpdir string, schema string) int {
 		err = rows.Scan(&funcName)
 		checkErr(err)
 
-		var funcInfo createInfoStruct
+		file := path.Join(dir, funcName+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, funcName, "function")
+			count++
+			continue
+		}
+
+		funcInfo := createInfoStruct{timestampInfoStruct: tsInfo}
 		err = db.QueryRow("show create function "+addQuotes(schema)+"."+addQuotes(funcName)).Scan(&funcInfo.Name, &funcInfo.SQLMode, &funcInfo.Create, &funcInfo.CharsetClient, &funcInfo.Collation, &funcInfo.DbCollation)
 		checkErr(err)
 
@@ -217,10 +357,11 @@ func dumpFuncs(db *sql.DB, dumpdir string, schema string) int {
 		jbyte, err = json.MarshalIndent(funcInfo, "", "  ")
 		checkErr(err)
 
-		file := path.Join(dir, funcName+sqlExtension)
 		err = ioutil.WriteFile(file, jbyte, filePerms)
 		checkErr(err)
+		dumpResume.record(file, jbyte)
 
+		publishDumped(events, schema, funcName, "function")
 		count++
 	}
 
@@ -228,16 +369,16 @@ func dumpFuncs(db *sql.DB, dumpdir string, schema string) int {
 }
 
 // dumpTriggers creates files containing trigger creation statements. It processes all triggers for the schema passed to it. The /triggers directory is hardcoded and expected by trite client code.
-func dumpTriggers(db *sql.DB, dumpdir string, schema string) int {
+func dumpTriggers(db *sql.DB, dumpdir string, schema string, tsInfo timestampInfoStruct, events *eventBusStruct) int {
 	dir := path.Join(dumpdir, schema, "triggers")
 	var err error
 	count := 0
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
 	var rows *sql.Rows
-	rows, err = db.Query("select trigger_name from information_schema.triggers where trigger_schema='" + schema + "'")
+	rows, err = db.Query("select trigger_name from information_schema.triggers where trigger_schema='" + schema + "' order by trigger_name")
 	checkErr(err)
 
 	var trigName string
@@ -245,7 +386,14 @@ func dumpTriggers(db *sql.DB, dumpdir string, schema string) int {
 		err = rows.Scan(&trigName)
 		checkErr(err)
 
-		var trigInfo createInfoStruct
+		file := path.Join(dir, trigName+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, trigName, "trigger")
+			count++
+			continue
+		}
+
+		trigInfo := createInfoStruct{timestampInfoStruct: tsInfo}
 		err = db.QueryRow("show create trigger "+addQuotes(schema)+"."+addQuotes(trigName)).Scan(&trigInfo.Name, &trigInfo.SQLMode, &trigInfo.Create, &trigInfo.CharsetClient, &trigInfo.Collation, &trigInfo.DbCollation)
 		checkErr(err)
 
@@ -253,10 +401,11 @@ func dumpTriggers(db *sql.DB, dumpdir string, schema string) int {
 		jbyte, err = json.MarshalIndent(trigInfo, "", "  ")
 		checkErr(err)
 
-		file := path.Join(dir, trigName+sqlExtension)
 		err = ioutil.WriteFile(file, jbyte, filePerms)
 		checkErr(err)
+		dumpResume.record(file, jbyte)
 
+		publishDumped(events, schema, trigName, "trigger")
 		count++
 	}
 
@@ -264,16 +413,16 @@ func dumpTriggers(db *sql.DB, dumpdir string, schema string) int {
 }
 
 // dumpViews creates files containing view creation statements. It processes all views for the schema passed to it. The /views directory is hardcoded and expected by trite client code.
-func dumpViews(db *sql.DB, dumpdir string, schema string) int {
+func dumpViews(db *sql.DB, dumpdir string, schema string, tsInfo timestampInfoStruct, events *eventBusStruct) int {
 	dir := path.Join(dumpdir, schema, "views")
 	var err error
 	count := 0
 
-	err = os.Mkdir(dir, dirPerms)
+	err = os.MkdirAll(dir, dirPerms)
 	checkErr(err)
 
 	var rows *sql.Rows
-	rows, err = db.Query("select table_name from information_schema.tables where table_schema='" + schema + "' and table_type = 'VIEW'")
+	rows, err = db.Query("select table_name from information_schema.tables where table_schema='" + schema + "' and table_type = 'VIEW' order by table_name")
 	checkErr(err)
 
 	var view string
@@ -281,7 +430,14 @@ func dumpViews(db *sql.DB, dumpdir string, schema string) int {
 		err = rows.Scan(&view)
 		checkErr(err)
 
-		var viewInfo createInfoStruct
+		file := path.Join(dir, view+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, view, "view")
+			count++
+			continue
+		}
+
+		viewInfo := createInfoStruct{timestampInfoStruct: tsInfo}
 		err = db.QueryRow("show create view "+addQuotes(schema)+"."+addQuotes(view)).Scan(&viewInfo.Name, &viewInfo.Create, &viewInfo.CharsetClient, &viewInfo.Collation)
 		checkErr(err)
 
@@ -289,10 +445,56 @@ func dumpViews(db *sql.DB, dumpdir string, schema string) int {
 		jbyte, err = json.MarshalIndent(viewInfo, "", "  ")
 		checkErr(err)
 
-		file := path.Join(dir, view+sqlExtension)
 		err = ioutil.WriteFile(file, jbyte, filePerms)
 		checkErr(err)
+		dumpResume.record(file, jbyte)
+
+		publishDumped(events, schema, view, "view")
+		count++
+	}
+
+	return count
+}
+
+// dumpEvents creates files containing event creation statements. It processes all events for the schema passed to it. The /events directory is hardcoded and expected by trite client code.
+func dumpEvents(db *sql.DB, dumpdir string, schema string, tsInfo timestampInfoStruct, events *eventBusStruct) int {
+	dir := path.Join(dumpdir, schema, "events")
+	var err error
+	count := 0
+
+	err = os.MkdirAll(dir, dirPerms)
+	checkErr(err)
+
+	var rows *sql.Rows
+	rows, err = db.Query("select event_name from information_schema.events where event_schema='" + schema + "' order by event_name")
+	checkErr(err)
+
+	var eventName string
+	for rows.Next() {
+		err = rows.Scan(&eventName)
+		checkErr(err)
+
+		file := path.Join(dir, eventName+sqlExtension)
+		if dumpResume.complete(file) {
+			publishDumped(events, schema, eventName, "event")
+			count++
+			continue
+		}
+
+		// Events are scheduled in their own time zone rather than the dump sessions
+		eventInfo := createInfoStruct{timestampInfoStruct: tsInfo}
+		err = db.QueryRow("show create event "+addQuotes(schema)+"."+addQuotes(eventName)).Scan(&eventInfo.Name, &eventInfo.SQLMode, &eventInfo.TimeZone, &eventInfo.Create, &eventInfo.CharsetClient, &eventInfo.Collation, &eventInfo.DbCollation)
+		checkErr(err)
+
+		var jbyte []byte
+		jbyte, err = json.MarshalIndent(eventInfo, "", "  ")
+		checkErr(err)
+
+		err = ioutil.WriteFile(file, jbyte, filePerms)
+		checkErr(err)
+		dumpResume.record(file, jbyte)
 
+		publishDumped(events, schema, eventName, "event")
 		count++
 	}
 
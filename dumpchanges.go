@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dumpPrevious is an earlier dump that dump mode reports the schema changes since
+var dumpPrevious string
+
+// dumpObjectTypes names the object type stored in each dump subdirectory
+var dumpObjectTypes = map[string]string{"tables": "table", "procedures": "procedure", "functions": "function", "triggers": "trigger", "views": "view", "events": "event"}
+
+// dumpObjects returns the create statement files of a dump by their slash separated path relative to the dump root
+func dumpObjects(dumpdir string) (map[string]string, error) {
+	objects := make(map[string]string)
+	err := filepath.Walk(dumpdir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(file) != sqlExtension {
+			return err
+		}
+
+		rel, err := filepath.Rel(dumpdir, file)
+		if err != nil {
+			return err
+		}
+		objects[filepath.ToSlash(rel)] = file
+
+		return nil
+	})
+
+	return objects, err
+}
+
+// dumpObjectName returns the type and schema qualified name of a dump file such as sales/tables/orders.sql
+func dumpObjectName(rel string) (string, string) {
+	parts := strings.Split(strings.TrimSuffix(rel, sqlExtension), "/")
+	if len(parts) == 3 {
+		return dumpObjectTypes[parts[1]], parts[0] + "." + parts[2]
+	}
+
+	return "schema", parts[0]
+}
+
+// dumpStatementLines returns the create statement of a dump file as trimmed lines. Stored objects are json and their create statement is used, table AUTO_INCREMENT counters are not schema changes.
+func dumpStatementLines(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := string(b)
+	var info createInfoStruct
+	if json.Unmarshal(b, &info) == nil {
+		stmt = info.Create
+	} else {
+		stmt = stripAutoIncrement(stmt)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// lineChanges returns the lines only in old and the lines only in new, column and index definitions of a table are single lines
+func lineChanges(old []string, new []string) ([]string, []string) {
+	inOld := make(map[string]bool)
+	for _, line := range old {
+		inOld[line] = true
+	}
+	inNew := make(map[string]bool)
+	for _, line := range new {
+		inNew[line] = true
+	}
+
+	var removed, added []string
+	for _, line := range old {
+		if !inNew[line] {
+			removed = append(removed, line)
+		}
+	}
+	for _, line := range new {
+		if !inOld[line] {
+			added = append(added, line)
+		}
+	}
+
+	return removed, added
+}
+
+// reportChanges prints the schema changes between -previousDump and a finished dump, the previous dump of -deterministic is compared before it is replaced
+func reportChanges(dumpdir string) error {
+	if dumpPrevious == "" {
+		return nil
+	}
+
+	err := reportDumpChanges(dumpMessages(), dumpPrevious, dumpdir)
+	if err != nil {
+		return fmt.Errorf("Unable to compare the dump with %s - %s", dumpPrevious, err)
+	}
+
+	return nil
+}
+
+// reportDumpChanges writes the schemas, tables and stored objects added, dropped and altered between two dumps to w
+func reportDumpChanges(w io.Writer, previous string, current string) error {
+	oldObjects, err := dumpObjects(previous)
+	if err != nil {
+		return err
+	}
+	newObjects, err := dumpObjects(current)
+	if err != nil {
+		return err
+	}
+
+	var rels []string
+	for rel := range oldObjects {
+		rels = append(rels, rel)
+	}
+	for rel := range newObjects {
+		if _, ok := oldObjects[rel]; !ok {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Schema changes since", previous+":")
+	var changes int
+	for _, rel := range rels {
+		objectType, name := dumpObjectName(rel)
+		if objectType == "" {
+			continue
+		}
+
+		oldFile, inOld := oldObjects[rel]
+		newFile, inNew := newObjects[rel]
+		switch {
+		case !inOld:
+			fmt.Fprintln(w, "    Added", objectType, name)
+			changes++
+		case !inNew:
+			fmt.Fprintln(w, "    Dropped", objectType, name)
+			changes++
+		default:
+			oldLines, err := dumpStatementLines(oldFile)
+			if err != nil {
+				return err
+			}
+			newLines, err := dumpStatementLines(newFile)
+			if err != nil {
+				return err
+			}
+
+			if strings.Join(oldLines, "\n") == strings.Join(newLines, "\n") {
+				continue
+			}
+			removed, added := lineChanges(oldLines, newLines)
+			fmt.Fprintln(w, "    Altered", objectType, name)
+			for _, line := range removed {
+				fmt.Fprintln(w, "        -", line)
+			}
+			for _, line := range added {
+				fmt.Fprintln(w, "        +", line)
+			}
+			changes++
+		}
+	}
+	if changes == 0 {
+		fmt.Fprintln(w, "    No changes")
+	}
+
+	return nil
+}
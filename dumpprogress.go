@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Dump statuses published on the event bus, each dumped object is followed by a schema event once the schema is complete
+const (
+	statusDumped       = "Dumped"
+	statusSchemaDumped = "SchemaDumped"
+)
+
+// dumpProgressInterval is how often progress is printed while a schema with many objects is dumped
+const dumpProgressInterval = 10 * time.Second
+
+// dumpOutput is the format dump mode prints its progress in, text or json lines on stdout
+var dumpOutput = "text"
+
+// dumpProgressStruct is a dump event with the progress of the whole dump, it is the json line printed with -output=json
+type dumpProgressStruct struct {
+	tableEventStruct
+	Done       int     `json:"done"`
+	Total      int     `json:"total"`
+	ETASeconds float64 `json:"etaSeconds"`
+}
+
+// publishDumped sends an event for an object written to the dump
+func publishDumped(events *eventBusStruct, schema string, name string, objectType string) {
+	events.publish(tableEventStruct{Schema: schema, Table: name, Type: objectType, Status: statusDumped})
+}
+
+// countDumpObjects returns the number of objects runDump will write for the schemas, used as the total progress is measured against
+func countDumpObjects(db *sql.DB, schemas []string, filter tableFilterStruct) int {
+	selected := make(map[string]bool)
+	for _, schema := range schemas {
+		selected[schema] = true
+	}
+
+	// Every schema create statement is one object
+	total := len(schemas)
+
+	rows, err := db.Query("select table_schema, table_name from information_schema.tables where table_type = 'BASE TABLE'")
+	checkErr(err)
+	var schema, name string
+	for rows.Next() {
+		err = rows.Scan(&schema, &name)
+		checkErr(err)
+
+		if selected[schema] && filter.table(schema, name) {
+			total++
+		}
+	}
+
+	for _, query := range []string{
+		"select routine_schema, count(*) from information_schema.routines where routine_type in ('PROCEDURE', 'FUNCTION') group by routine_schema",
+		"select trigger_schema, count(*) from information_schema.triggers group by trigger_schema",
+		"select table_schema, count(*) from information_schema.tables where table_type = 'VIEW' group by table_schema",
+		"select event_schema, count(*) from information_schema.events group by event_schema",
+	} {
+		rows, err := db.Query(query)
+		checkErr(err)
+
+		var count int
+		for rows.Next() {
+			err = rows.Scan(&schema, &count)
+			checkErr(err)
+
+			if selected[schema] {
+				total += count
+			}
+		}
+	}
+
+	return total
+}
+
+// dumpProgress returns an event consumer printing the progress of a dump of total objects with an estimate of the time left, as text lines or as json lines when output is json
+func dumpProgress(w io.Writer, total int, output string) func(<-chan tableEventStruct) {
+	return func(events <-chan tableEventStruct) {
+		start := time.Now()
+		lastPrint := start
+		var done int
+		counts := make(map[string]int)
+		enc := json.NewEncoder(w)
+
+		for e := range events {
+			if e.Status == statusDumped {
+				done++
+				counts[e.Type]++
+			}
+
+			// Objects created since the count was taken can make done exceed total
+			if done > total {
+				total = done
+			}
+			var eta time.Duration
+			if done > 0 {
+				eta = time.Duration(float64(time.Since(start)) / float64(done) * float64(total-done))
+			}
+
+			if output == "json" {
+				enc.Encode(dumpProgressStruct{tableEventStruct: e, Done: done, Total: total, ETASeconds: eta.Round(time.Second).Seconds()})
+				continue
+			}
+
+			if e.Status == statusSchemaDumped {
+				fmt.Fprintf(w, "%s: %d tables, %d procedures, %d functions, %d triggers, %d views, %d events - %s\n", e.Schema, counts["table"], counts["procedure"], counts["function"], counts["trigger"], counts["view"], counts["event"], dumpProgressLine(done, total, eta))
+				counts = make(map[string]int)
+				lastPrint = time.Now()
+			} else if time.Since(lastPrint) >= dumpProgressInterval {
+				fmt.Fprintf(w, "%s: dumping - %s\n", e.Schema, dumpProgressLine(done, total, eta))
+				lastPrint = time.Now()
+			}
+		}
+	}
+}
+
+// dumpProgressLine formats the objects dumped so far and the estimated time left
+func dumpProgressLine(done int, total int, eta time.Duration) string {
+	percent := 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+
+	line := fmt.Sprintf("%d of %d objects (%d%%)", done, total, percent)
+	if done < total {
+		line += fmt.Sprintf(", about %s left", eta.Round(time.Second))
+	}
+
+	return line
+}
+
+// dumpMessages returns where dump mode prints messages other than progress, stderr when stdout is json lines
+func dumpMessages() io.Writer {
+	if dumpOutput == "json" {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
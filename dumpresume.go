@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dumpProgressFile records every file written while a dump is running so an interrupted dump can be resumed, it is removed when the dump completes
+const dumpProgressFile = "dump.progress"
+
+// dumpedFileStruct is the size and sha256 checksum a dump file had when it was written
+type dumpedFileStruct struct {
+	size int64
+	sum  string
+}
+
+// dumpResumeStruct records the files of a running dump and which files of an interrupted dump are complete
+type dumpResumeStruct struct {
+	mu      sync.Mutex
+	dumpdir string
+	f       *os.File
+	written map[string]dumpedFileStruct
+}
+
+// dumpResume is the progress record of the running dump, nil when no dump is running
+var dumpResume *dumpResumeStruct
+
+// openDumpResume starts recording the files written to dumpdir, when resuming the files recorded by the interrupted dump are loaded first
+func openDumpResume(dumpdir string, resume bool) (*dumpResumeStruct, error) {
+	r := &dumpResumeStruct{dumpdir: dumpdir, written: make(map[string]dumpedFileStruct)}
+	file := filepath.Join(dumpdir, dumpProgressFile)
+
+	if resume {
+		f, err := os.Open(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			// A line cut short by the interruption is ignored and its file dumped again
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				fields := strings.SplitN(scanner.Text(), " ", 3)
+				if len(fields) != 3 {
+					continue
+				}
+				size, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				r.written[fields[2]] = dumpedFileStruct{size: size, sum: fields[0]}
+			}
+			f.Close()
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerms)
+	if err != nil {
+		return nil, err
+	}
+	r.f = f
+
+	return r, nil
+}
+
+// complete returns true when a file was recorded by the interrupted dump and its size and checksum still match, the object does not need to be dumped again
+func (r *dumpResumeStruct) complete(file string) bool {
+	if r == nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(r.dumpdir, file)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	recorded, ok := r.written[filepath.ToSlash(rel)]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	info, err := os.Stat(file)
+	if err != nil || info.Size() != recorded.size {
+		return false
+	}
+	sum, err := fileSum(file)
+
+	return err == nil && sum == recorded.sum
+}
+
+// record adds a file that was completely written to the progress file
+func (r *dumpResumeStruct) record(file string, b []byte) {
+	if r == nil {
+		return
+	}
+
+	rel, err := filepath.Rel(r.dumpdir, file)
+	checkErr(err)
+
+	h := sha256.Sum256(b)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = fmt.Fprintf(r.f, "%s %d %s\n", hex.EncodeToString(h[:]), len(b), filepath.ToSlash(rel))
+	checkErr(err)
+}
+
+// finish removes the progress file of a completed dump
+func (r *dumpResumeStruct) finish() error {
+	r.f.Close()
+
+	return os.Remove(filepath.Join(r.dumpdir, dumpProgressFile))
+}
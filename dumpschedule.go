@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// servedDirStruct is an http.FileSystem whose root directory can be swapped while serving
+type servedDirStruct struct {
+	mu   sync.RWMutex
+	path string
+}
+
+// Open opens a file relative to the current root directory
+func (d *servedDirStruct) Open(name string) (http.File, error) {
+	return http.Dir(d.get()).Open(name)
+}
+
+func (d *servedDirStruct) get() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.path
+}
+
+func (d *servedDirStruct) set(path string) {
+	d.mu.Lock()
+	d.path = path
+	d.mu.Unlock()
+}
+
+// scheduleDumps runs dump mode into dumpDir each time the cron schedule fires and switches the served create statements to the new dump once no restore is running, so a restore never mixes two dumps.
+// Only the keep newest scheduled dumps are kept.
+func scheduleDumps(sched *cronSchedule, dumpDir string, dbi *mysqlCredentials, filter tableFilterStruct, tables *servedDirStruct, keep int, activity *serverActivityStruct) {
+	for {
+		next := sched.next(time.Now())
+		fmt.Println("Next scheduled dump at", next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+
+		dumpdir, err := scheduledDump(dumpDir, dbi, filter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "ERROR: Scheduled dump failed -", err)
+			continue
+		}
+
+		for !activity.idle(restoreIdle) {
+			time.Sleep(blockingPoll)
+		}
+		tables.set(dumpdir)
+		fmt.Println(time.Now().Format(time.RFC3339), "Now serving create statements from", dumpdir)
+
+		err = pruneDumps(dumpDir, dbi.host, keep, dumpdir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "ERROR: Unable to remove old scheduled dumps -", err)
+		}
+	}
+}
+
+// pruneDumps removes the time stamped dumps of host in dumpDir except the keep newest and the served dump
+func pruneDumps(dumpDir string, host string, keep int, served string) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	dirs, err := ioutil.ReadDir(dumpDir)
+	if err != nil {
+		return err
+	}
+
+	var dumps []string
+	prefix := host + "_dump"
+	for _, dir := range dirs {
+		stamped := strings.TrimPrefix(dir.Name(), prefix)
+		if !dir.IsDir() || !strings.HasPrefix(dir.Name(), prefix) || len(stamped) != len(stamp) || strings.Trim(stamped, "0123456789") != "" {
+			continue
+		}
+		dumps = append(dumps, dir.Name())
+	}
+
+	// Time stamped names sort oldest first
+	sort.Strings(dumps)
+	for i, name := range dumps {
+		dir := path.Join(dumpDir, name)
+		if i >= len(dumps)-keep || dir == served {
+			continue
+		}
+		fmt.Println(time.Now().Format(time.RFC3339), "Removing old scheduled dump", dir)
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scheduledDump runs a dump recovering from any panic so a failed dump doesn't stop the server
+func scheduledDump(dumpDir string, dbi *mysqlCredentials, filter tableFilterStruct) (dumpdir string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return runDump(dumpDir, dbi, filter)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dumpSumsFile is written to the root of a dump with the sha256 checksum of every file in it, in the format of sha256sum
+const dumpSumsFile = "checksums.sha256"
+
+// dumpSumsMap stores the checksum of each dump file by its slash separated path relative to the dump root
+type dumpSumsMap map[string]string
+
+// dumpSums are the checksums of the dump being restored, nil when the server's dump has no checksums file
+var dumpSums dumpSumsMap
+
+// writeDumpSums writes the checksums file of a finished dump so truncated or edited create statements can be caught by clients. Walk visits files in path order.
+func writeDumpSums(dumpdir string) error {
+	var lines []string
+	err := filepath.Walk(dumpdir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dumpdir, file)
+		if err != nil {
+			return err
+		}
+		if rel == dumpSumsFile {
+			return nil
+		}
+
+		sum, err := fileSum(file)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, sum+"  "+filepath.ToSlash(rel))
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dumpdir, dumpSumsFile), []byte(strings.Join(lines, "\n")+"\n"), filePerms)
+}
+
+// loadDumpSums fetches the checksums file of the dump a trite server is serving, dumps taken before checksums were written have none and are not verified
+func loadDumpSums(taburl string) (dumpSumsMap, error) {
+	url := taburl + dumpSumsFile
+	resp, err := httpGet(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%d returned from: %s", resp.StatusCode, url)
+	}
+
+	return parseDumpSums(resp.Body, url)
+}
+
+// parseDumpSums reads the lines of a dump checksums file, name is the file or url it was read from
+func parseDumpSums(r io.Reader, name string) (dumpSumsMap, error) {
+	sums := make(dumpSumsMap)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("Malformed dump checksums file %s", name)
+		}
+		sums[fields[1]] = fields[0]
+	}
+
+	return sums, scanner.Err()
+}
+
+// checkDumpSums hashes every file of a local dump and compares it with the checksums written with the dump. The number of files checked and the problems found are returned.
+func checkDumpSums(dumpdir string) (int, []string, error) {
+	var problems []string
+
+	f, err := os.Open(filepath.Join(dumpdir, dumpSumsFile))
+	if err != nil {
+		return 0, append(problems, dumpSumsFile+" could not be read - "+err.Error()), nil
+	}
+	sums, err := parseDumpSums(f, f.Name())
+	f.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var checked int
+	err = filepath.Walk(dumpdir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dumpdir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == dumpSumsFile {
+			return nil
+		}
+
+		want, ok := sums[rel]
+		if !ok {
+			problems = append(problems, rel+" is not listed in the dump checksums")
+			return nil
+		}
+		delete(sums, rel)
+
+		sum, err := fileSum(file)
+		if err != nil {
+			return err
+		}
+		checked++
+		if sum != want {
+			problems = append(problems, rel+" does not match the dump checksum, the file was truncated or edited after the dump")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return checked, problems, err
+	}
+
+	// Files listed in the checksums but no longer in the dump were removed after it was taken
+	var missing []string
+	for rel := range sums {
+		missing = append(missing, rel)
+	}
+	sort.Strings(missing)
+	for _, rel := range missing {
+		problems = append(problems, rel+" is listed in the dump checksums but missing")
+	}
+
+	return checked, problems, nil
+}
+
+// verify checks a fetched dump file against the dump checksums, a file missing from the checksums was added to the dump after it was taken
+func (sums dumpSumsMap) verify(rel string, b []byte) error {
+	if sums == nil {
+		return nil
+	}
+
+	want, ok := sums[rel]
+	if !ok {
+		return fmt.Errorf("%s is not listed in the dump checksums", rel)
+	}
+
+	got := sha256.Sum256(b)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("%s does not match the dump checksum, the file was truncated or edited after the dump", rel)
+	}
+
+	return nil
+}
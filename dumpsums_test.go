@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDumpSums(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(dumpdir string) error
+		checked  int
+		problems []string
+	}{
+		{"unchanged dump", func(dumpdir string) error { return nil }, 2, nil},
+		{"edited file", func(dumpdir string) error {
+			return ioutil.WriteFile(filepath.Join(dumpdir, "shop", "tables", "orders.sql"), []byte("create table orders (id int)"), 0644)
+		}, 2, []string{"shop/tables/orders.sql does not match the dump checksum, the file was truncated or edited after the dump"}},
+		{"added file", func(dumpdir string) error {
+			return ioutil.WriteFile(filepath.Join(dumpdir, "shop", "tables", "items.sql"), []byte("create table items (id int)"), 0644)
+		}, 2, []string{"shop/tables/items.sql is not listed in the dump checksums"}},
+		{"removed file", func(dumpdir string) error {
+			return os.Remove(filepath.Join(dumpdir, "shop", "tables", "orders.sql"))
+		}, 1, []string{"shop/tables/orders.sql is listed in the dump checksums but missing"}},
+		{"no checksums", func(dumpdir string) error {
+			return os.Remove(filepath.Join(dumpdir, dumpSumsFile))
+		}, 0, []string{dumpSumsFile + " could not be read"}},
+	}
+
+	for _, tt := range tests {
+		dumpdir, err := ioutil.TempDir("", "trite-dumpsums")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dumpdir)
+
+		tables := filepath.Join(dumpdir, "shop", "tables")
+		err = os.MkdirAll(tables, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"orders", "customers"} {
+			err = ioutil.WriteFile(filepath.Join(tables, table+".sql"), []byte("create table "+table+" (id int primary key)"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = writeDumpSums(dumpdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = tt.change(dumpdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checked, problems, err := checkDumpSums(dumpdir)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if checked != tt.checked {
+			t.Errorf("%s: %d files checked, expected %d", tt.name, checked, tt.checked)
+		}
+		if len(problems) != len(tt.problems) {
+			t.Errorf("%s: problems %v, expected %v", tt.name, problems, tt.problems)
+			continue
+		}
+		for i, problem := range problems {
+			if !strings.HasPrefix(problem, tt.problems[i]) {
+				t.Errorf("%s: problem %s, expected %s", tt.name, problem, tt.problems[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errorLogStruct writes the error log from a single goroutine so the innodb status and processlist dumps of tables failing at the same time are never interleaved
+type errorLogStruct struct {
+	file    string
+	entries chan errorLogEntryStruct
+	done    chan struct{}
+}
+
+// errorLogEntryStruct is a framed entry queued for the error log writer, written is closed once it is in the file
+type errorLogEntryStruct struct {
+	b       []byte
+	written chan struct{}
+}
+
+// errorLog is the client error log. A nil error log discards entries.
+var errorLog *errorLogStruct
+
+// openErrorLog starts the error log writer. The file is created or appended to by the first entry so runs without errors do not touch it.
+func openErrorLog(file string) {
+	errorLog = &errorLogStruct{file: file, entries: make(chan errorLogEntryStruct), done: make(chan struct{})}
+	go errorLog.writer()
+}
+
+// closeErrorLog stops the error log writer once every entry is written
+func closeErrorLog() {
+	if errorLog == nil {
+		return
+	}
+
+	close(errorLog.entries)
+	<-errorLog.done
+	errorLog = nil
+}
+
+// writer appends the queued entries to the error log one at a time
+func (el *errorLogStruct) writer() {
+	defer close(el.done)
+
+	var f *os.File
+	for entry := range el.entries {
+		if f == nil {
+			var err error
+			f, err = os.OpenFile(el.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			checkErr(err)
+			defer f.Close()
+		}
+
+		_, err := f.Write(entry.b)
+		checkErr(err)
+		close(entry.written)
+	}
+}
+
+// write frames an entry with begin and end lines naming its kind and returns once it is in the error log, so an entry is not lost if trite exits right after
+func (el *errorLogStruct) write(kind string, entry []byte) {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "=====", "BEGIN", kind, time.Now().Format(time.RFC3339), "=====")
+	b.Write(entry)
+	if len(entry) > 0 && entry[len(entry)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	fmt.Fprintln(&b, "=====", "END", kind, "=====")
+
+	el.queue(b.Bytes())
+}
+
+// queue passes b to the writer unframed and waits until it is written
+func (el *errorLogStruct) queue(b []byte) {
+	if el == nil {
+		return
+	}
+
+	written := make(chan struct{})
+	el.entries <- errorLogEntryStruct{b: b, written: written}
+	<-written
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Table statuses published on the event bus
+const (
+	statusDownloading = "Downloading"
+	statusApplying    = "Applying"
+	statusRestored    = "Restored"
+	statusUnchanged   = "Unchanged"
+	statusSkipped     = "Skipped"
+	statusError       = "ERROR"
+)
+
+// eventBuffer is how many events each subscriber can fall behind before publishing status changes waits for it
+const eventBuffer = 256
+
+// tableEventStruct is a change in the restore status of a table
+type tableEventStruct struct {
+	Time   time.Time `json:"time"`
+	Schema string    `json:"schema"`
+	Table  string    `json:"table"`
+	Type   string    `json:"type,omitempty"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+
+	Progress *fileProgressStruct `json:"progress,omitempty"`
+}
+
+// fileProgressStruct is how much of a file has been downloaded, only published for -output=json
+type fileProgressStruct struct {
+	File    string `json:"file"`
+	Bytes   int64  `json:"bytes"`
+	Size    int64  `json:"size"`
+	Percent int    `json:"percent"`
+}
+
+// eventBusStruct delivers every published status change to each subscriber in the order it was published. Progress events are dropped for a subscriber that has fallen behind.
+type eventBusStruct struct {
+	subscribers []chan tableEventStruct
+	wg          sync.WaitGroup
+}
+
+// fqTable returns the schema qualified table name of an event or a blank string for an empty event
+func (e tableEventStruct) fqTable() string {
+	if e.Table == "" {
+		return ""
+	}
+
+	return e.Schema + "." + e.Table
+}
+
+// final returns true for the last status a table reaches
+func (e tableEventStruct) final() bool {
+	return e.Status == statusRestored || e.Status == statusUnchanged || e.Status == statusSkipped || e.Status == statusError
+}
+
+// line returns the status and table of an event as it is displayed, with the reason a table was skipped
+func (e tableEventStruct) line() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Status, e.fqTable(), e.Reason)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Status, e.fqTable())
+}
+
+// newEventBus creates an event bus without subscribers
+func newEventBus() *eventBusStruct {
+	return &eventBusStruct{}
+}
+
+// subscribe runs consumer in its own goroutine with a buffered channel receiving the events. Subscribers must be added before events are published.
+func (b *eventBusStruct) subscribe(consumer func(<-chan tableEventStruct)) {
+	ch := make(chan tableEventStruct, eventBuffer)
+	b.subscribers = append(b.subscribers, ch)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		consumer(ch)
+	}()
+}
+
+// publish sends an event to every subscriber. A progress event is only sent to subscribers with room in their buffer, so a slow consumer does not hold up
+// downloads and misses progress that the next progress event of the file includes anyway.
+func (b *eventBusStruct) publish(e tableEventStruct) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	for _, ch := range b.subscribers {
+		if e.Progress != nil {
+			select {
+			case ch <- e:
+			default:
+			}
+			continue
+		}
+
+		ch <- e
+	}
+}
+
+// close stops the subscribers once they have consumed every published event
+func (b *eventBusStruct) close() {
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+	b.wg.Wait()
+}
+
+// eventLogger writes events to a file as json lines
+func eventLogger(file string) (func(<-chan tableEventStruct), error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerms)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(events <-chan tableEventStruct) {
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		for e := range events {
+			if e.Progress == nil {
+				enc.Encode(e)
+			}
+		}
+	}, nil
+}
+
+// displayJSON returns an event consumer writing every status change and download progress event to w as a json line, for tools parsing the progress of a restore
+func displayJSON(w io.Writer) func(<-chan tableEventStruct) {
+	return func(events <-chan tableEventStruct) {
+		enc := json.NewEncoder(w)
+		for e := range events {
+			enc.Encode(e)
+		}
+	}
+}
+
+// reportEvents records the final status of each table in the restore report
+func reportEvents(events <-chan tableEventStruct) {
+	for e := range events {
+		if e.final() {
+			report.addTable(e)
+		}
+	}
+}
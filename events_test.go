@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventBusDropsProgress(t *testing.T) {
+	events := newEventBus()
+
+	// The subscriber does not read until every event is published
+	release := make(chan struct{})
+	var received []tableEventStruct
+	events.subscribe(func(ch <-chan tableEventStruct) {
+		<-release
+		for e := range ch {
+			received = append(received, e)
+		}
+	})
+
+	// Progress events beyond the buffer are dropped instead of blocking the publisher
+	for i := 0; i < eventBuffer*2; i++ {
+		events.publish(tableEventStruct{Schema: "shop", Table: "orders", Status: statusDownloading, Progress: &fileProgressStruct{File: "orders.ibd", Bytes: int64(i)}})
+	}
+
+	// Status changes wait for room in the buffer
+	done := make(chan struct{})
+	go func() {
+		events.publish(tableEventStruct{Schema: "shop", Table: "orders", Status: statusApplying})
+		events.publish(tableEventStruct{Schema: "shop", Table: "orders", Status: statusRestored})
+		close(done)
+	}()
+	close(release)
+	<-done
+	events.close()
+
+	if len(received) != eventBuffer+2 {
+		t.Fatalf("received %d events, expected %d", len(received), eventBuffer+2)
+	}
+	for i, e := range received[:eventBuffer] {
+		if e.Progress == nil || e.Progress.Bytes != int64(i) {
+			t.Fatalf("event %d is %+v, expected progress of %d bytes", i, e, i)
+		}
+	}
+	if received[eventBuffer].Status != statusApplying || received[eventBuffer+1].Status != statusRestored {
+		t.Errorf("status changes received as %s, %s, expected %s, %s", received[eventBuffer].Status, received[eventBuffer+1].Status, statusApplying, statusRestored)
+	}
+}
+
+func TestMetricsExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "trite.prom")
+
+	exporter, err := metricsExporter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := newEventBus()
+	events.subscribe(exporter)
+	for _, e := range []tableEventStruct{
+		{Schema: "shop", Table: "orders", Status: statusDownloading},
+		{Schema: "shop", Table: "orders", Status: statusDownloading, Progress: &fileProgressStruct{File: "orders.ibd"}},
+		{Schema: "shop", Table: "orders", Status: statusRestored},
+		{Schema: "shop", Table: "customers", Status: statusDownloading},
+		{Schema: "shop", Table: "customers", Status: statusError, Error: "failed"},
+		{Schema: "shop", Table: "items", Status: statusSkipped},
+		{Schema: "shop", Table: "carts", Status: statusDownloading},
+	} {
+		events.publish(e)
+	}
+	events.close()
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metric := range []string{
+		`trite_restore_tables_total{status="Restored"} 1`,
+		`trite_restore_tables_total{status="Unchanged"} 0`,
+		`trite_restore_tables_total{status="Skipped"} 1`,
+		`trite_restore_tables_total{status="ERROR"} 1`,
+		"trite_restore_tables_in_progress 1",
+		"trite_restore_done 1",
+	} {
+		if !strings.Contains(string(b), metric+"\n") {
+			t.Errorf("metrics file is missing %s:\n%s", metric, b)
+		}
+	}
+
+	if _, err := os.Stat(file + triteExtension); !os.IsNotExist(err) {
+		t.Errorf("temporary metrics file was left behind - %v", err)
+	}
+}
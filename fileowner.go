@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+)
+
+// lookupFileOwner sets the uid & gid restored files are owned by from -fileOwner and -fileGroup, names or numeric ids are accepted. Ids that are not given are left as -1 and detected from the MySQL datadir.
+func lookupFileOwner(dbi *mysqlCredentials, owner string, group string) error {
+	dbi.uid, dbi.gid = -1, -1
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			u, err = user.LookupId(owner)
+		}
+		if err != nil {
+			return fmt.Errorf("-fileOwner %s - %s", owner, err)
+		}
+		dbi.uid, _ = strconv.Atoi(u.Uid)
+
+		// A named owner brings its primary group unless a group is given
+		if group == "" {
+			dbi.gid, _ = strconv.Atoi(u.Gid)
+		}
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return fmt.Errorf("-fileGroup %s - %s", group, err)
+		}
+		dbi.gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	return nil
+}
+
+// detectFileOwner fills in a uid or gid that was not given with the owner of the MySQL datadir, falling back to the mysql user. trite exits if neither can be found.
+func detectFileOwner(dbi *mysqlCredentials, mysqldir string) {
+	if runtime.GOOS == "windows" || (dbi.uid >= 0 && dbi.gid >= 0) {
+		return
+	}
+
+	// Files already in the datadir are owned by the user the daemon runs as
+	for _, file := range []string{"ibdata1", "mysql", ""} {
+		uid, gid, ok := fileOwnerIDs(mysqldir + "/" + file)
+		if ok {
+			if dbi.uid < 0 {
+				dbi.uid = uid
+			}
+			if dbi.gid < 0 {
+				dbi.gid = gid
+			}
+			return
+		}
+	}
+
+	mysqlUser, err := user.Lookup("mysql")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to detect the owner of the MySQL datadir, use -fileOwner and -fileGroup -", err)
+		os.Exit(1)
+	}
+
+	if dbi.uid < 0 {
+		dbi.uid, _ = strconv.Atoi(mysqlUser.Uid)
+	}
+	if dbi.gid < 0 {
+		dbi.gid, _ = strconv.Atoi(mysqlUser.Gid)
+	}
+}
+
+// parseFilePerms parses an octal -filePerms value
+func parseFilePerms(perms string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(perms, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("-filePerms must be octal permissions such as 0660")
+	}
+
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwnerIDs returns the uid & gid owning a file
+func fileOwnerIDs(file string) (int, int, bool) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(st.Uid), int(st.Gid), true
+}
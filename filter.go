@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePatternStruct matches a name with a glob (e.g. orders_*) or a regular expression prefixed with re: or anchored with ^ (e.g. re:_tmp$ or ^tmp_)
+type namePatternStruct struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// tableFilterStruct selects schemas and tables by include and exclude patterns. Table globs containing a dot are matched against schema.table, otherwise against the table name.
+// Regular expressions match either. An empty include list matches everything.
+type tableFilterStruct struct {
+	schemas        []namePatternStruct
+	excludeSchemas []namePatternStruct
+	tables         []namePatternStruct
+	excludeTables  []namePatternStruct
+}
+
+// parsePatterns parses a comma separated list of globs and regular expressions. A leading ^ is not meaningful in a glob so such patterns are regular expressions without the re: prefix.
+func parsePatterns(list string) ([]namePatternStruct, error) {
+	var patterns []namePatternStruct
+	if list == "" {
+		return patterns, nil
+	}
+
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "re:") || strings.HasPrefix(p, "^") {
+			re, err := regexp.Compile(strings.TrimPrefix(p, "re:"))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid filter %s - %s", p, err)
+			}
+			patterns = append(patterns, namePatternStruct{re: re})
+		} else {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("Invalid filter %s - %s", p, err)
+			}
+			patterns = append(patterns, namePatternStruct{glob: p})
+		}
+	}
+
+	return patterns, nil
+}
+
+// parseTableFilter builds a filter from comma separated include and exclude pattern lists
+func parseTableFilter(schemas string, excludeSchemas string, tables string, excludeTables string) (tableFilterStruct, error) {
+	var filter tableFilterStruct
+	var err error
+
+	for _, p := range []struct {
+		list     string
+		patterns *[]namePatternStruct
+	}{{schemas, &filter.schemas}, {excludeSchemas, &filter.excludeSchemas}, {tables, &filter.tables}, {excludeTables, &filter.excludeTables}} {
+		*p.patterns, err = parsePatterns(p.list)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// match reports whether name matches the pattern
+func (p namePatternStruct) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// matchAny reports whether name matches any of the patterns
+func matchAny(patterns []namePatternStruct, name string) bool {
+	for _, p := range patterns {
+		if p.match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schema reports whether a schema is selected by the filter
+func (f tableFilterStruct) schema(schema string) bool {
+	if len(f.schemas) > 0 && !matchAny(f.schemas, schema) {
+		return false
+	}
+
+	return !matchAny(f.excludeSchemas, schema)
+}
+
+// table reports whether a table is selected by the filter
+func (f tableFilterStruct) table(schema string, table string) bool {
+	if !f.schema(schema) {
+		return false
+	}
+
+	matchTable := func(patterns []namePatternStruct) bool {
+		for _, p := range patterns {
+			switch {
+			case p.re != nil && (p.match(table) || p.match(schema+"."+table)):
+				return true
+			case p.re == nil && strings.Contains(p.glob, ".") && p.match(schema+"."+table):
+				return true
+			case p.re == nil && !strings.Contains(p.glob, ".") && p.match(table):
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(f.tables) > 0 && !matchTable(f.tables) {
+		return false
+	}
+
+	return !matchTable(f.excludeTables)
+}
+
+// selectTables returns the create statement files of a schema whose table is selected by the filter, in the order served
+func (f tableFilterStruct) selectTables(schema string, files []string) []string {
+	var selected []string
+	for _, file := range files {
+		if f.table(schema, strings.TrimSuffix(file, sqlExtension)) {
+			selected = append(selected, file)
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePatterns(t *testing.T) {
+	tests := []struct {
+		list string
+		n    int
+		ok   bool
+	}{
+		{"", 0, true},
+		{"orders_*", 1, true},
+		{"orders_*, re:_tmp$ ,^tmp_", 3, true},
+		{"shop.orders_*", 1, true},
+		{"orders_[", 0, false},
+		{"re:(", 0, false},
+		{"^(", 0, false},
+	}
+
+	for _, tt := range tests {
+		patterns, err := parsePatterns(tt.list)
+		if tt.ok != (err == nil) {
+			t.Errorf("parsePatterns(%q) = %v", tt.list, err)
+		}
+		if tt.ok && len(patterns) != tt.n {
+			t.Errorf("parsePatterns(%q) returned %d patterns, expected %d", tt.list, len(patterns), tt.n)
+		}
+	}
+}
+
+func TestTableFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		schemas        string
+		excludeSchemas string
+		tables         string
+		excludeTables  string
+		schema         string
+		table          string
+		selected       bool
+	}{
+		{"empty filter", "", "", "", "", "shop", "orders", true},
+		{"schema glob", "sh*", "", "", "", "shop", "orders", true},
+		{"schema glob miss", "sh*", "", "", "", "crm", "orders", false},
+		{"schema regex", "re:^(shop|crm)$", "", "", "", "crm", "orders", true},
+		{"schema regex unanchored", "re:ho", "", "", "", "shop", "orders", true},
+		{"exclude schema", "", "crm,tmp*", "", "", "tmp_1", "orders", false},
+		{"exclude schema wins", "*", "shop", "", "", "shop", "orders", false},
+		{"table glob", "", "", "orders_*", "", "shop", "orders_2020", true},
+		{"table glob miss", "", "", "orders_*", "", "shop", "customers", false},
+		{"table glob not schema qualified", "", "", "shop*", "", "shop", "orders", false},
+		{"table glob class", "", "", "orders_20[12]?", "", "shop", "orders_2019", true},
+		{"table regex", "", "", "re:_tmp$", "", "shop", "orders_tmp", true},
+		{"table regex miss", "", "", "re:_tmp$", "", "shop", "orders_tmp_1", false},
+		{"table caret shorthand", "", "", "^tmp_", "", "shop", "tmp_orders", true},
+		{"table caret shorthand miss", "", "", "^tmp_", "", "shop", "orders_tmp_", false},
+		{"table regex schema qualified", "", "", `re:^shop\.orders$`, "", "shop", "orders", true},
+		{"table regex schema qualified miss", "", "", `re:^shop\.orders$`, "", "crm", "orders", false},
+		{"dotted glob", "", "", "shop.orders_*", "", "shop", "orders_2020", true},
+		{"dotted glob other schema", "", "", "shop.orders_*", "", "crm", "orders_2020", false},
+		{"dotted glob schema wildcard", "", "", "*.orders", "", "crm", "orders", true},
+		{"dotted glob does not match table", "", "", "shop.orders", "", "x", "shop.orders", false},
+		{"exclude table caret", "", "", "", "^tmp_", "shop", "tmp_orders", false},
+		{"exclude table dotted", "", "", "", "crm.*", "crm", "orders", false},
+		{"exclude table dotted other schema", "", "", "", "crm.*", "shop", "orders", true},
+		{"exclude table wins", "", "", "orders*", "orders_old", "shop", "orders_old", false},
+		{"table in excluded schema", "", "shop", "orders", "", "shop", "orders", false},
+	}
+
+	for _, tt := range tests {
+		filter, err := parseTableFilter(tt.schemas, tt.excludeSchemas, tt.tables, tt.excludeTables)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if selected := filter.table(tt.schema, tt.table); selected != tt.selected {
+			t.Errorf("%s: table(%q, %q) = %t, expected %t", tt.name, tt.schema, tt.table, selected, tt.selected)
+		}
+	}
+}
+
+func TestSelectTables(t *testing.T) {
+	filter, err := parseTableFilter("", "", "orders_*,^tmp_,crm.customers", "orders_old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{"customers.sql", "orders_2020.sql", "orders_old.sql", "tmp_import.sql", "orders_2021.sql"}
+	expected := map[string][]string{
+		"shop": {"orders_2020.sql", "tmp_import.sql", "orders_2021.sql"},
+		"crm":  {"customers.sql", "orders_2020.sql", "tmp_import.sql", "orders_2021.sql"},
+	}
+
+	for schema, want := range expected {
+		got := filter.selectTables(schema, files)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("selectTables(%q) = %v, expected %v", schema, got, want)
+		}
+	}
+}
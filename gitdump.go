@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitCommitDump commits a finished dump to the git repository at dir, which is initialized when it is not already in one. Nothing is committed when the schema is unchanged.
+func gitCommitDump(dir string, dumpdir string, host string) error {
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		fmt.Fprintln(dumpMessages(), "Initializing git repository:", dir)
+		_, err = runGit(dir, "init", "-q")
+		if err != nil {
+			return err
+		}
+	}
+
+	rel, err := filepath.Rel(dir, dumpdir)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(dir, "add", "-A", "--", rel)
+	if err != nil {
+		return err
+	}
+	if _, err := runGit(dir, "diff", "--cached", "--quiet", "--", rel); err == nil {
+		fmt.Fprintln(dumpMessages(), "No schema changes since the last commit of", rel)
+		return nil
+	}
+
+	// Commits are made as trite when no git identity is configured
+	args := []string{"commit", "-q", "-m", "Dump of " + host + " at " + time.Now().Format("2006-01-02 15:04:05 MST"), "--", rel}
+	if _, err := runGit(dir, "config", "user.email"); err != nil {
+		hostname, _ := os.Hostname()
+		args = append([]string{"-c", "user.name=trite", "-c", "user.email=trite@" + hostname}, args...)
+	}
+	_, err = runGit(dir, args...)
+	if err != nil {
+		return err
+	}
+
+	out, err := runGit(dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(dumpMessages(), "Committed", rel, "to git as", out)
+
+	return nil
+}
+
+// runGit runs a git command in dir and returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed - %s %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// headStruct is the HEAD response of a backup file, cached when a table is planned so the download reuses it instead of asking again
+type headStruct struct {
+	size         int64
+	etag         string
+	lastModified string
+}
+
+// newHead caches the size and validators of a HEAD response
+func newHead(resp *http.Response) headStruct {
+	return headStruct{size: resp.ContentLength, etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+}
+
+// conditions returns the headers making the server refuse with 412 a file that changed since it was planned. Servers without ETags are checked against the modification time.
+func (h headStruct) conditions() http.Header {
+	header := make(http.Header)
+	if h.etag != "" {
+		header.Set("If-Match", h.etag)
+	} else if h.lastModified != "" {
+		header.Set("If-Unmodified-Since", h.lastModified)
+	}
+
+	return header
+}
+
+// etagHandler sets an ETag from the generation, modification time and size of served backup files so clients can download them with If-Match. A swapped backup or catalog generation changes the ETag.
+func etagHandler(backupPath string, generation string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := filepath.Join(backupPath, filepath.FromSlash(filepath.Clean("/"+r.URL.Path)))
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+			w.Header().Set("ETag", fmt.Sprintf(`"%s-%x-%x"`, generation, fi.ModTime().UnixNano(), fi.Size()))
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
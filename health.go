@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// healthzHandler reports the server process is up. It does no work so it is safe to call frequently as a liveness probe.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports whether the server can serve a restore, the create statement and backup directories must be readable, the backup not being prepared and a live export database reachable.
+// Startup backup verification has already passed when the listener is running.
+func readyzHandler(tables *servedDirStruct, backupPath string, db *sql.DB, quiesce *quiesceStruct) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if tables.get() != "" {
+			err = dirReadable(tables.get())
+		}
+		if err == nil && backupPath != "" {
+			err = dirReadable(backupPath)
+		}
+		if err == nil && db != nil {
+			err = db.Ping()
+		}
+		if reason := quiesce.reason(); err == nil && reason != "" {
+			err = fmt.Errorf("The backup is being modified, %s", reason)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// dirReadable returns an error if a directory cannot be opened and listed
+func dirReadable(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_, err = d.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
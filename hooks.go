@@ -0,0 +1,46 @@
+package main
+
+// progressHooksStruct are callbacks an embedding application sets in clientConfigStruct to drive its own UI instead of the terminal display. Unset callbacks are not called.
+// Callbacks run on the event bus goroutine in the order the events were published. OnProgress calls are skipped while callbacks are behind, other slow callbacks hold up the restore.
+type progressHooksStruct struct {
+	OnTableStart func(schema string, table string)
+	OnProgress   func(schema string, table string, file string, bytes int64, size int64)
+	OnTableDone  func(schema string, table string, status string)
+	OnError      func(schema string, table string, message string)
+}
+
+// progress returns true when download progress events must be published for the OnProgress callback
+func (h *progressHooksStruct) progress() bool {
+	return h != nil && h.OnProgress != nil
+}
+
+// consume calls the callbacks for every table event, OnTableStart for the first event of a table and OnTableDone or OnError for its final status
+func (h *progressHooksStruct) consume(events <-chan tableEventStruct) {
+	started := make(map[string]bool)
+	for e := range events {
+		if e.Progress != nil {
+			if h.OnProgress != nil {
+				h.OnProgress(e.Schema, e.Table, e.Progress.File, e.Progress.Bytes, e.Progress.Size)
+			}
+			continue
+		}
+
+		if fqTable := e.fqTable(); fqTable != "" && !started[fqTable] {
+			started[fqTable] = true
+			if h.OnTableStart != nil {
+				h.OnTableStart(e.Schema, e.Table)
+			}
+		}
+
+		switch {
+		case e.Status == statusError:
+			if h.OnError != nil {
+				h.OnError(e.Schema, e.Table, e.Error)
+			}
+		case e.final():
+			if h.OnTableDone != nil {
+				h.OnTableDone(e.Schema, e.Table, e.Status)
+			}
+		}
+	}
+}
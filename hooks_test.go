@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProgressHooks(t *testing.T) {
+	var calls []string
+	hooks := &progressHooksStruct{
+		OnTableStart: func(schema string, table string) {
+			calls = append(calls, "start "+schema+"."+table)
+		},
+		OnProgress: func(schema string, table string, file string, bytes int64, size int64) {
+			calls = append(calls, fmt.Sprintf("progress %s.%s %s %d/%d", schema, table, file, bytes, size))
+		},
+		OnTableDone: func(schema string, table string, status string) {
+			calls = append(calls, "done "+schema+"."+table+" "+status)
+		},
+		OnError: func(schema string, table string, message string) {
+			calls = append(calls, "error "+schema+"."+table+" "+message)
+		},
+	}
+
+	events := newEventBus()
+	events.subscribe(hooks.consume)
+	for _, e := range []tableEventStruct{
+		{Schema: "shop", Table: "orders", Status: statusDownloading},
+		{Schema: "shop", Table: "orders", Status: statusDownloading, Progress: &fileProgressStruct{File: "orders.ibd", Bytes: 512, Size: 1024}},
+		{Schema: "shop", Table: "customers", Status: statusDownloading},
+		{Schema: "shop", Table: "orders", Status: statusApplying},
+		{Schema: "shop", Table: "orders", Status: statusRestored},
+		{Schema: "shop", Table: "customers", Status: statusError, Error: "import failed"},
+		{Schema: "shop", Table: "items", Status: statusSkipped, Reason: "unchanged"},
+		{Schema: "shop", Status: statusDownloading},
+	} {
+		events.publish(e)
+	}
+	events.close()
+
+	expected := []string{
+		"start shop.orders",
+		"progress shop.orders orders.ibd 512/1024",
+		"start shop.customers",
+		"done shop.orders Restored",
+		"error shop.customers import failed",
+		"start shop.items",
+		"done shop.items Skipped",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("hooks called:\n%s\nexpected:\n%s", strings.Join(calls, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestProgressHooksUnset(t *testing.T) {
+	var nilHooks *progressHooksStruct
+	if nilHooks.progress() {
+		t.Errorf("progress() of nil hooks = true, expected false")
+	}
+
+	// Events for unset callbacks are consumed without calling anything
+	var done []string
+	hooks := &progressHooksStruct{OnTableDone: func(schema string, table string, status string) {
+		done = append(done, schema+"."+table)
+	}}
+	if hooks.progress() {
+		t.Errorf("progress() without OnProgress = true, expected false")
+	}
+
+	events := newEventBus()
+	events.subscribe(hooks.consume)
+	events.publish(tableEventStruct{Schema: "shop", Table: "orders", Status: statusDownloading, Progress: &fileProgressStruct{File: "orders.ibd"}})
+	events.publish(tableEventStruct{Schema: "shop", Table: "orders", Status: statusError, Error: "failed"})
+	events.publish(tableEventStruct{Schema: "shop", Table: "customers", Status: statusUnchanged})
+	events.close()
+
+	if strings.Join(done, ",") != "shop.customers" {
+		t.Errorf("OnTableDone called for %v, expected [shop.customers]", done)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the binary units sizes are parsed and printed with, smallest first
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"B", 1},
+	{"K", 1024},
+	{"M", 1048576},
+	{"G", 1073741824},
+	{"T", 1099511627776},
+}
+
+// parseSize converts a size such as 500M, 1.5GiB, 64KB or 1T to bytes, units are binary and a number without a unit is a count of defaultUnit bytes
+func parseSize(size string, defaultUnit int64) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+
+	// A B suffix without a larger unit is bytes
+	multiplier := defaultUnit
+	if strings.HasSuffix(s, "B") {
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I"))
+		multiplier = 1
+	}
+	for _, unit := range sizeUnits[1:] {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.bytes
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatSize prints a byte count with the largest binary unit it has at least one of, e.g. 512 B, 64.0 KiB or 1.50 GiB
+func formatSize(n int64) string {
+	unit := sizeUnits[0]
+	for _, u := range sizeUnits[1:] {
+		if n >= u.bytes || -n >= u.bytes {
+			unit = u
+		}
+	}
+
+	if unit.bytes == 1 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size := float64(n) / float64(unit.bytes)
+	if size >= 100 || size <= -100 {
+		return fmt.Sprintf("%.0f %siB", size, unit.suffix)
+	} else if size >= 10 || size <= -10 {
+		return fmt.Sprintf("%.1f %siB", size, unit.suffix)
+	}
+
+	return fmt.Sprintf("%.2f %siB", size, unit.suffix)
+}
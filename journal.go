@@ -0,0 +1,188 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// journalStruct writes a gzip compressed operation journal of every HTTP request, SQL statement and file operation performed by the client
+type journalStruct struct {
+	mu   sync.Mutex
+	file string
+	f    *os.File
+	gz   *gzip.Writer
+}
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// journal is the client operation journal. A nil journal discards entries.
+var journal *journalStruct
+
+// openJournal creates the operation journal file
+func openJournal(file string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	journal = &journalStruct{file: file, f: f, gz: gzip.NewWriter(f)}
+	journal.printf("START", "trite client %v", os.Args)
+
+	return nil
+}
+
+// closeJournal flushes and closes the operation journal
+func closeJournal() {
+	if journal == nil {
+		return
+	}
+
+	journal.printf("END", "")
+
+	journal.mu.Lock()
+	journal.gz.Close()
+	journal.f.Close()
+	journal.mu.Unlock()
+}
+
+// printf writes a timestamped journal entry. Entries are flushed immediately so the journal is readable after a crash.
+func (j *journalStruct) printf(kind string, format string, a ...interface{}) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	fmt.Fprintf(j.gz, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339Nano), kind, fmt.Sprintf(format, a...))
+	j.gz.Flush()
+}
+
+// httpGet performs a journaled HTTP GET
+func httpGet(url string) (*http.Response, error) {
+	return httpRequest(context.Background(), "GET", url)
+}
+
+// httpHead performs a journaled HTTP HEAD
+func httpHead(url string) (*http.Response, error) {
+	return httpRequest(context.Background(), "HEAD", url)
+}
+
+// httpRequest runs an HTTP request as a child span of ctx and records its status and duration in the journal
+func httpRequest(ctx context.Context, method string, url string) (*http.Response, error) {
+	return httpRequestHeader(ctx, method, url, nil)
+}
+
+// httpRequestHeader runs an HTTP request like httpRequest with extra request headers. Requests to a failed mirrored server are retried on the next mirror.
+func httpRequestHeader(ctx context.Context, method string, url string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		routed := mirrors.route(url)
+		resp, err := httpDo(ctx, method, routed, header)
+		if (err != nil || resp.StatusCode >= http.StatusInternalServerError) && ctx.Err() == nil && attempt < mirrors.count()-1 && mirrors.failover(routed) {
+			if err == nil {
+				resp.Body.Close()
+			}
+			continue
+		}
+
+		return resp, err
+	}
+}
+
+// httpDo runs a single journaled and traced HTTP request
+func httpDo(ctx context.Context, method string, url string, header http.Header) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("http.url", url)))
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	setAuthHeader(req)
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		journal.printf("HTTP", "%s %s error=%q duration=%s", method, url, err, time.Since(start))
+	} else {
+		journal.printf("HTTP", "%s %s status=%d length=%d duration=%s", method, url, resp.StatusCode, resp.ContentLength, time.Since(start))
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+	endSpan(span, err)
+
+	return resp, err
+}
+
+// execSQL runs a journaled SQL statement recording the MySQL error number on failure
+func execSQL(e sqlExecer, query string) (sql.Result, error) {
+	start := time.Now()
+	res, err := e.Exec(query)
+	if err != nil {
+		var code uint16
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+			code = mysqlErr.Number
+		}
+		journal.printf("SQL", "%q errno=%d error=%q duration=%s", query, code, err, time.Since(start))
+	} else {
+		journal.printf("SQL", "%q duration=%s", query, time.Since(start))
+	}
+
+	return res, err
+}
+
+// journalFile records a file operation and its result
+func journalFile(op string, err error, paths ...string) {
+	if err != nil {
+		journal.printf("FILE", "%s %v error=%q", op, paths, err)
+	} else {
+		journal.printf("FILE", "%s %v", op, paths)
+	}
+}
+
+// renameFile performs a journaled file rename
+func renameFile(oldpath string, newpath string) error {
+	err := os.Rename(oldpath, newpath)
+	journalFile("rename", err, oldpath, newpath)
+
+	// Keep track of which temporary files this run still owns
+	if err == nil {
+		releaseTempFile(oldpath)
+		if strings.HasSuffix(newpath, triteExtension) {
+			trackTempFile(newpath)
+		}
+	}
+
+	return err
+}
+
+// removeFile performs a journaled file removal
+func removeFile(path string) error {
+	err := os.Remove(path)
+	journalFile("remove", err, path)
+	if err == nil || os.IsNotExist(err) {
+		releaseTempFile(path)
+	}
+
+	return err
+}
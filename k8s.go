@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// k8sServiceAccountDir is where Kubernetes mounts the pods service account credentials
+const k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// k8sJobStruct holds the values used to render a restore Job manifest
+type k8sJobStruct struct {
+	Image         string
+	DatadirClaim  string
+	Datadir       string
+	Secret        string
+	Env           [][2]string
+	StatusEnabled bool
+}
+
+// k8sJobTemplate is a client restore Job. The init container runs the client preflight checks so a Job that cannot restore fails before anything is changed.
+var k8sJobTemplate = template.Must(template.New("job").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: trite-restore
+spec:
+  backoffLimit: 0
+  template:
+    spec:
+      restartPolicy: Never
+{{- if .StatusEnabled}}
+      # The service account needs get and patch access to the status ConfigMap
+      serviceAccountName: trite
+{{- end}}
+      initContainers:
+      - name: preflight
+        image: {{quote .Image}}
+        args: ["-preflight"]
+        env: &env
+        - name: MYSQL_PWD
+          valueFrom:
+            secretKeyRef:
+              name: {{quote .Secret}}
+              key: password
+{{- range .Env}}
+        - name: {{index . 0}}
+          value: {{quote (index . 1)}}
+{{- end}}
+        volumeMounts: &mounts
+        - name: mysql-data
+          mountPath: {{quote .Datadir}}
+      containers:
+      - name: restore
+        image: {{quote .Image}}
+        env: *env
+        volumeMounts: *mounts
+      volumes:
+      - name: mysql-data
+        persistentVolumeClaim:
+          claimName: {{quote .DatadirClaim}}
+`))
+
+// loadEnvFlags sets flags from TRITE_<FLAG> environment variables (e.g. TRITE_TRITESERVER) so the client can be configured without arguments in a container
+func loadEnvFlags(f *flag.FlagSet) error {
+	var err error
+	f.VisitAll(func(fl *flag.Flag) {
+		if v, ok := os.LookupEnv(envFlagName(fl.Name)); ok && err == nil {
+			err = f.Set(fl.Name, v)
+			if err != nil {
+				err = fmt.Errorf("Invalid value for %s - %s", envFlagName(fl.Name), err)
+			}
+		}
+	})
+
+	return err
+}
+
+// envFlagName returns the environment variable name for a flag
+func envFlagName(name string) string {
+	return "TRITE_" + strings.ToUpper(name)
+}
+
+// k8sManifest renders a client restore Job passing every flag set on the command line as an environment variable. Passwords are never written to the manifest, they are read from a Secret.
+func k8sManifest(f *flag.FlagSet, job k8sJobStruct) (string, error) {
+	skip := map[string]bool{"k8sManifest": true, "k8sImage": true, "k8sDatadirClaim": true, "k8sDatadir": true, "k8sSecret": true, "pass": true, "passFile": true, "preflight": true}
+
+	job.Env = append(job.Env, [2]string{envFlagName("client"), "true"})
+	f.Visit(func(fl *flag.Flag) {
+		if !skip[fl.Name] && fl.Name != "client" {
+			job.Env = append(job.Env, [2]string{envFlagName(fl.Name), fl.Value.String()})
+		}
+		if fl.Name == "k8sStatusConfigMap" {
+			job.StatusEnabled = true
+		}
+	})
+
+	var b bytes.Buffer
+	err := k8sJobTemplate.Execute(&b, job)
+
+	return b.String(), err
+}
+
+// reportK8sStatus merges the restore status into a ConfigMap using the pods service account
+func reportK8sStatus(configMap string, status string, errCount int) error {
+	token, err := ioutil.ReadFile(k8sServiceAccountDir + "token")
+	if err != nil {
+		return err
+	}
+	namespace, err := ioutil.ReadFile(k8sServiceAccountDir + "namespace")
+	if err != nil {
+		return err
+	}
+	ca, err := ioutil.ReadFile(k8sServiceAccountDir + "ca.crt")
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	data := map[string]string{"status": status, "errors": strconv.Itoa(errCount), "updated": time.Now().Format(time.RFC3339)}
+	if report != nil {
+		report.mu.Lock()
+		b, err := json.Marshal(report)
+		report.mu.Unlock()
+		if err == nil {
+			data["report"] = string(b)
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	url := "https://" + host + ":" + port + "/api/v1/namespaces/" + strings.TrimSpace(string(namespace)) + "/configmaps/" + configMap
+
+	req, err := http.NewRequest("PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%d returned updating ConfigMap %s - %s", resp.StatusCode, configMap, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
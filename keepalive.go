@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// keepAliveInterval is how often an idle connection that must stay open is pinged, well below the session wait_timeout
+const keepAliveInterval = time.Minute
+
+// keepAlive pings a connection until the returned function is called, so a session holding locks is not dropped by wait_timeout while it waits on a long transfer
+func keepAlive(conn *sql.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(keepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.PingContext(context.Background())
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
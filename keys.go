@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// backupKeyStruct is the key used to decrypt backup files. Keys from a key management service are held in memory and never written to disk.
+type backupKeyStruct struct {
+	id   string
+	file string
+	key  []byte
+}
+
+// loadBackupKey reads the backup encryption key from a key file, a HashiCorp Vault secret or an AWS KMS encrypted data key
+func loadBackupKey(keySource string, keyPath string, keyFile string) (backupKeyStruct, error) {
+	switch keySource {
+	case "", "file":
+		if keyFile == "" {
+			return backupKeyStruct{}, fmt.Errorf("-decryptKeyFile is required to decrypt backups with a key file")
+		}
+
+		return backupKeyStruct{id: "file:" + keyFile, file: keyFile}, nil
+
+	case "vault":
+		key, err := vaultSecret(keyPath, "key")
+		if err != nil {
+			return backupKeyStruct{}, err
+		}
+
+		// The key id is optional in the secret, the secret path identifies the key otherwise
+		id, err := vaultSecret(keyPath, "key_id")
+		if err != nil {
+			id = "vault:" + keyPath
+		}
+
+		return backupKeyStruct{id: id, key: []byte(key)}, nil
+
+	case "kms":
+		return kmsDataKey(keyPath)
+	}
+
+	return backupKeyStruct{}, fmt.Errorf("Unknown key source %s, use file, vault or kms", keySource)
+}
+
+// kmsDataKey decrypts a data key encrypted with AWS KMS using the aws cli and its usual credential chain
+func kmsDataKey(ciphertextFile string) (backupKeyStruct, error) {
+	out, err := exec.Command("aws", "kms", "decrypt", "--ciphertext-blob", "fileb://"+ciphertextFile, "--output", "json").Output()
+	if err != nil {
+		return backupKeyStruct{}, fmt.Errorf("Unable to decrypt the data key %s with KMS - %s", ciphertextFile, err)
+	}
+
+	var resp struct {
+		KeyID     string `json:"KeyId"`
+		Plaintext string `json:"Plaintext"`
+	}
+	err = json.Unmarshal(out, &resp)
+	if err != nil {
+		return backupKeyStruct{}, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return backupKeyStruct{}, err
+	}
+
+	return backupKeyStruct{id: resp.KeyID, key: key}, nil
+}
+
+// xbcryptKeyArgs returns the xbcrypt key argument for a key. In memory keys are passed through a pipe as file descriptor 3 so they never appear on disk or in the process list.
+func (k backupKeyStruct) xbcryptKeyArgs(cmd *exec.Cmd) (string, error) {
+	if k.file != "" {
+		return "--encrypt-key-file=" + k.file, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	go func() {
+		w.Write(k.key)
+		w.Close()
+	}()
+	cmd.ExtraFiles = []*os.File{r}
+
+	return "--encrypt-key-file=/dev/fd/3", nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// linkTree recreates the directory tree at src under dst with every file hard linked. A hard linked snapshot keeps serving the original files when
+// the backup directory is refreshed in place by tools that replace files. src and dst must be on the same filesystem.
+func linkTree(src string, dst string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+
+		return os.Link(file, target)
+	})
+}
+
+// copyTree copies the directory tree at src to dst. Unlike a hard linked snapshot the copy can be modified without changing the original files.
+func copyTree(src string, dst string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+
+		err = copyFile(file, target)
+		if err != nil {
+			return err
+		}
+
+		return os.Chmod(target, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// parseListen returns the addresses the server listens on from a comma separated -listen list. Addresses without a port use -tritePort and IPv6 addresses may be given with or without brackets. A blank list listens on every interface.
+func parseListen(list string, port string) ([]string, error) {
+	if list == "" {
+		return []string{":" + port}, nil
+	}
+
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		addr = strings.TrimSpace(addr)
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			// A bare IPv6 address such as :: is not host:port
+			host := strings.Trim(addr, "[]")
+			if strings.Contains(addr, "]:") || (host != "" && net.ParseIP(host) == nil && strings.Contains(host, ":")) {
+				return nil, fmt.Errorf("Invalid -listen address %s - %s", addr, err)
+			}
+			addr = net.JoinHostPort(host, port)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// listenNetwork returns the network addr is opened on. Go opens the IPv6 wildcard [::] dual stack, which also takes the port on every IPv4 address, so with other
+// addresses listed it is opened IPv6 only and IPv4 addresses are opened as IPv4.
+func listenNetwork(addr string, addrs []string) string {
+	if len(addrs) < 2 {
+		return "tcp"
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "tcp"
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	}
+
+	return "tcp6"
+}
+
+// serveAll listens on every address and serves handler until one of the listeners fails, HTTPS is served when a certificate and key are given
+func serveAll(addrs []string, handler http.Handler, certFile string, keyFile string) error {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		l, err := net.Listen(listenNetwork(addr, addrs), addr)
+		if err != nil {
+			for _, open := range listeners {
+				open.Close()
+			}
+			if errors.Is(err, syscall.EADDRINUSE) {
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr, "ERROR: Address", addr, "is already in use!")
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr)
+				os.Exit(1)
+			}
+
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if certFile != "" {
+				errc <- http.ServeTLS(l, handler, certFile, keyFile)
+				return
+			}
+			errc <- http.Serve(l, handler)
+		}(l)
+	}
+
+	return <-errc
+}
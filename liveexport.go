@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// exportHandler serves tables directly from a running source database using FLUSH TABLES ... FOR EXPORT. Paths mirror the /tables/ layout:
+//
+//	/export/<schema>/<schema>.sql        schema create statement
+//	/export/<schema>/tables/<table>.sql  table create statement
+//	/export/<schema>/tables/<table>.tar  tar stream of the tables .ibd, .cfg & .cfp (encrypted tables) files
+func exportHandler(db *sql.DB, datadir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+		switch {
+		case len(parts) == 2 && parts[1] == parts[0]+sqlExtension:
+			var ignore, stmt string
+			err := db.QueryRow("show create schema "+addQuotes(parts[0])).Scan(&ignore, &stmt)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			fmt.Fprintln(w, stmt+";")
+
+		case len(parts) == 3 && parts[1] == "tables" && strings.HasSuffix(parts[2], sqlExtension):
+			table := strings.TrimSuffix(parts[2], sqlExtension)
+			var ignore, stmt string
+			err := db.QueryRow("show create table "+addQuotes(parts[0])+"."+addQuotes(table)).Scan(&ignore, &stmt)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			fmt.Fprintln(w, stmt+";")
+
+		case len(parts) == 3 && parts[1] == "tables" && strings.HasSuffix(parts[2], ".tar"):
+			if r.Method == "HEAD" {
+				return
+			}
+			exportTable(w, r, db, datadir, parts[0], strings.TrimSuffix(parts[2], ".tar"))
+
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// exportTable quiesces a table with FLUSH TABLES ... FOR EXPORT and streams its tablespace files as a tar archive. The table is unlocked once the files are sent.
+func exportTable(w http.ResponseWriter, r *http.Request, db *sql.DB, datadir string, schema string, table string) {
+	// The export lock belongs to the session so a dedicated connection is used for the lock and unlock
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(r.Context(), "flush tables "+addQuotes(schema)+"."+addQuotes(table)+" for export")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.ExecContext(context.Background(), "unlock tables")
+
+	// The session is idle while the files stream, losing it to wait_timeout would release the export lock mid transfer
+	stopKeepAlive := keepAlive(conn)
+	defer stopKeepAlive()
+
+	schemaFilename := schema
+	if mysqlUTF8.NeedsEncoding(schema) {
+		schemaFilename = mysqlUTF8.EncodeFilename(schema)
+	}
+	tableFilename := table
+	if mysqlUTF8.NeedsEncoding(table) {
+		tableFilename = mysqlUTF8.EncodeFilename(table)
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := tar.NewWriter(w)
+	for _, ext := range []string{".ibd", ".cfg", cfpExtension} {
+		file := filepath.Join(datadir, schemaFilename, tableFilename+ext)
+
+		// Only encrypted tablespaces have a .cfp
+		if _, err := os.Stat(file); ext == cfpExtension && os.IsNotExist(err) {
+			continue
+		}
+
+		err = addTarFile(tw, file, tableFilename+ext)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Exporting", schema+"."+table, "-", err)
+			return
+		}
+	}
+	tw.Close()
+}
+
+// addTarFile writes a file to a tar archive under name
+func addTarFile(tw *tar.Writer, file string, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{Name: name, Mode: mysqlPerms, Size: fi.Size(), ModTime: fi.ModTime()})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// downloadLiveTable retrieves a live exported table from the trite server and extracts its files into the MySQL datadir
+func downloadLiveTable(clientConfig clientConfigStruct, downloadInfo downloadInfoStruct) {
+	downloadInfo.publish(statusDownloading, nil)
+
+	urlfile := joinURL(downloadInfo.taburl, downloadInfo.schema, "tables", downloadInfo.table+".tar")
+	resp, err := httpRequest(downloadInfo.ctx, "GET", urlfile)
+	checkErr(err)
+	checkHTTP(resp, urlfile)
+	defer resp.Body.Close()
+
+	var triteFiles []string
+	tr := tar.NewReader(rateLimit.reader(resp.Body))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errDownloadSize = fmt.Errorf("The live export did not download properly for %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+			handleDownloadError(clientConfig, &downloadInfo, errDownloadSize)
+
+			return
+		}
+
+		triteFile := filepath.Join(downloadInfo.mysqldir, localFilename(downloadInfo.schema, false), filepath.Base(hdr.Name)+triteExtension)
+		trackTempFile(triteFile)
+		fo, err := os.Create(triteFile)
+		journalFile("create", err, triteFile)
+		checkErr(err)
+
+		os.Chown(triteFile, downloadInfo.uid, downloadInfo.gid)
+		os.Chmod(triteFile, clientConfig.filePerms)
+
+		size, err := io.Copy(fo, tr)
+		fo.Close()
+		if err != nil || size != hdr.Size {
+			removeFile(triteFile)
+			errDownloadSize = fmt.Errorf("The %s file did not download properly for %s.%s", hdr.Name, downloadInfo.schema, downloadInfo.table)
+			handleDownloadError(clientConfig, &downloadInfo, errDownloadSize)
+
+			return
+		}
+
+		triteFiles = append(triteFiles, triteFile)
+	}
+
+	if len(triteFiles) == 0 {
+		errDownloadUnsupported = fmt.Errorf("No files were exported for table %s.%s", downloadInfo.schema, downloadInfo.table)
+		handleDownloadError(clientConfig, &downloadInfo, errDownloadUnsupported)
+
+		return
+	}
+
+	downloadInfo.engine = "InnoDB"
+	downloadInfo.triteFiles = triteFiles
+
+	// Call applyTables
+	go applyTables(clientConfig, &downloadInfo)
+}
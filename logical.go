@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// logicalBatchRows is the most rows sent in each insert statement in logical mode
+	logicalBatchRows = 500
+
+	// logicalMaxPlaceholders is the most placeholders MySQL accepts in a prepared statement
+	logicalMaxPlaceholders = 65535
+)
+
+var errApplyLogical error
+
+// copyTableLogical restores a table without access to the MySQL datadir, as on managed MySQL services. The table is created from the servers create statement and its rows are copied from the source database over SQL.
+func copyTableLogical(clientConfig clientConfigStruct, source *sql.DB, downloadInfo downloadInfoStruct) {
+	downloadInfo.engine = "logical"
+	downloadInfo.publish(statusDownloading, nil)
+
+	tx, err := downloadInfo.db.Begin()
+	checkErr(err)
+
+	// Never leave a partially copied table behind
+	fail := func(format string, err error) {
+		errApplyLogical = fmt.Errorf(format, downloadInfo.schema, downloadInfo.table, err)
+		handleApplyError(tx, clientConfig, &downloadInfo, errApplyLogical)
+	}
+
+	// The connection goes back to the pool afterwards so the session variables changed here are restored before the transaction ends
+	downloadInfo.session = saveVariables(tx, "session", "foreign_key_checks", "lock_wait_timeout")
+	_, err = execSQL(tx, "set session foreign_key_checks=0")
+	_, err = execSQL(tx, fmt.Sprintf("set session lock_wait_timeout=%d", int(clientConfig.mdlTimeout.Seconds())))
+	_, err = execSQL(tx, "use "+addQuotes(downloadInfo.schema))
+
+	// Get table create
+	resp, err := httpRequest(downloadInfo.ctx, "GET", joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension))
+	checkHTTP(resp, joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension))
+	checkErr(err)
+	stmt, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	err = dumpSums.verify(downloadInfo.sourceSchema+"/tables/"+downloadInfo.sourceTable+sqlExtension, stmt)
+	if downloadInfo.table != downloadInfo.sourceTable {
+		stmt = []byte(renameCreate(string(stmt), downloadInfo.table))
+	}
+
+	// Statements from the server are run as they are so only a single create table statement is accepted
+	if err == nil {
+		err = checkCreateStatement(string(stmt), "table")
+	}
+	if err != nil {
+		errApplyCreate = fmt.Errorf("There was an error creating table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+		handleApplyError(tx, clientConfig, &downloadInfo, errApplyCreate)
+		return
+	}
+
+	// The existing table is left alone until it has been replaced
+	err = waitForTable(tx, clientConfig, &downloadInfo)
+	if err != nil {
+		errApplyBlocked = fmt.Errorf("Table %s.%s was skipped, it is %s", downloadInfo.schema, downloadInfo.table, err)
+		handleApplyError(tx, clientConfig, &downloadInfo, errApplyBlocked)
+		return
+	}
+
+	err = replaceTable(tx, clientConfig, &downloadInfo)
+	if err != nil {
+		errApplyDrop = fmt.Errorf("There was an error dropping table %s.%s - %s", downloadInfo.schema, downloadInfo.table, err)
+		handleApplyError(tx, clientConfig, &downloadInfo, errApplyDrop)
+		return
+	}
+
+	_, err = execSQL(tx, string(stmt))
+	if err != nil {
+		fail("There was an error creating table %s.%s - %s", err)
+		return
+	}
+
+	// Generated columns are computed by the target
+	generated := generatedColumns(tx, downloadInfo.schema, downloadInfo.table)
+	var columns []string
+	rows, err := tx.Query("select column_name from information_schema.columns where table_schema = ? and table_name = ? order by ordinal_position", downloadInfo.schema, downloadInfo.table)
+	if err != nil {
+		fail("There was an error reading the columns of %s.%s - %s", err)
+		return
+	}
+	for rows.Next() {
+		var column string
+		checkErr(rows.Scan(&column))
+		if !generated[column] {
+			columns = append(columns, addQuotes(column))
+		}
+	}
+	rows.Close()
+	if len(columns) == 0 {
+		fail("There was an error reading the columns of %s.%s - %s", fmt.Errorf("no columns to copy"))
+		return
+	}
+
+	downloadInfo.publish(statusApplying, nil)
+
+	// Copy rows in batches of multi row inserts
+	src, err := source.Query("select " + strings.Join(columns, ", ") + " from " + addQuotes(downloadInfo.sourceSchema) + "." + addQuotes(downloadInfo.sourceTable))
+	if err != nil {
+		fail("There was an error reading rows of %s.%s from the source - %s", err)
+		return
+	}
+	defer src.Close()
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	insert := "insert into " + addQuotes(downloadInfo.table) + " (" + strings.Join(columns, ", ") + ") values "
+
+	// Wide tables send fewer rows per insert to stay within the placeholder limit
+	batchSize := logicalBatchRows
+	if logicalMaxPlaceholders/len(columns) < batchSize {
+		batchSize = logicalMaxPlaceholders / len(columns)
+	}
+
+	var batch []interface{}
+	var batchRows int
+	flush := func() error {
+		if batchRows == 0 {
+			return nil
+		}
+		_, err := tx.Exec(insert+strings.TrimSuffix(strings.Repeat(placeholders+", ", batchRows), ", "), batch...)
+		batch = batch[:0]
+		batchRows = 0
+
+		return err
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	scan := make([]interface{}, len(columns))
+	for i := range values {
+		scan[i] = &values[i]
+	}
+	for src.Next() {
+		checkErr(src.Scan(scan...))
+		for _, v := range values {
+			// RawBytes are reused by the next Scan so values are copied, nil stays NULL
+			if v == nil {
+				batch = append(batch, nil)
+			} else {
+				batch = append(batch, append([]byte{}, v...))
+			}
+		}
+		batchRows++
+
+		if batchRows == batchSize {
+			err = flush()
+			if err != nil {
+				fail("There was an error inserting rows into %s.%s - %s", err)
+				return
+			}
+		}
+	}
+	err = src.Err()
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		fail("There was an error copying rows into %s.%s - %s", err)
+		return
+	}
+
+	// Remove rows that do not match the tables row filter and mask sensitive columns
+	for _, query := range []string{clientConfig.rowFilters.filterStatement(downloadInfo.schema, downloadInfo.table), clientConfig.maskRules.maskStatement(downloadInfo.schema, downloadInfo.table, generated)} {
+		if query == "" {
+			continue
+		}
+		_, err = execSQL(tx, query)
+		if err != nil {
+			fail("There was an error filtering or masking table %s.%s - %s", err)
+			return
+		}
+	}
+
+	restoreVariables(tx, "session", downloadInfo.session)
+	err = tx.Commit()
+	checkErr(err)
+
+	downloadInfo.publish(statusRestored, nil)
+	downloadInfo.done()
+}
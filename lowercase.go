@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// checkLowerCaseNames detects schema and table names from a case sensitive source that a target with lower_case_table_names=1 would store in lower case files.
+// With mode lower the names are converted which is only possible when no two names differ by case alone, otherwise the restore is aborted with guidance.
+func checkLowerCaseNames(db *sql.DB, mode string, schemas []string, schemaTables map[string][]string) (bool, error) {
+	var ignore string
+	var lowerCaseTableNames int
+	err := db.QueryRow("show global variables like 'lower_case_table_names'").Scan(&ignore, &lowerCaseTableNames)
+	if err != nil || lowerCaseTableNames != 1 {
+		// Names are stored as given with 0 and 2 so files always match
+		return false, nil
+	}
+
+	var mixed []string
+	seen := make(map[string]string)
+	checkName := func(name string) error {
+		if strings.ToLower(name) != name {
+			mixed = append(mixed, name)
+		}
+		if other, ok := seen[strings.ToLower(name)]; ok && other != name {
+			return fmt.Errorf("%s and %s differ only by case and cannot both be restored to a target with lower_case_table_names=1", other, name)
+		}
+		seen[strings.ToLower(name)] = name
+
+		return nil
+	}
+
+	for _, schema := range schemas {
+		err = checkName(schema)
+		if err != nil {
+			return false, err
+		}
+
+		for _, table := range schemaTables[schema] {
+			table, _ = parseFileName(table)
+			err = checkName(schema + "." + table)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if len(mixed) == 0 {
+		return false, nil
+	}
+
+	if mode != "lower" {
+		return false, fmt.Errorf("The target has lower_case_table_names=1 but %d schema and table names contain upper case letters (e.g. %s), the source is case sensitive.\n"+
+			"Use -caseMismatch=lower to restore them with lower case names or set lower_case_table_names=0 on the target.", len(mixed), mixed[0])
+	}
+
+	fmt.Println("Restoring", len(mixed), "schema and table names in lower case to match lower_case_table_names=1")
+
+	return true, nil
+}
+
+// localFilename returns the name of a schema or table file in the target datadir
+func localFilename(name string, lower bool) string {
+	if lower {
+		name = strings.ToLower(name)
+	}
+	if mysqlUTF8.NeedsEncoding(name) {
+		name = mysqlUTF8.EncodeFilename(name)
+	}
+
+	return name
+}
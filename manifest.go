@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// manifestStruct lists the schemas and tables a trite server can restore. Servers without a structure dump or without backup files set DumpOnly or BackupsOnly and return 404 for the endpoints of the other.
+// Schemas and tables are sorted by name. A manifest requested with a limit is one page of tables, Next is the cursor of the following page and blank on the last page.
+type manifestStruct struct {
+	URL         string                 `json:"url,omitempty"`
+	DumpOnly    bool                   `json:"dumpOnly,omitempty"`
+	BackupsOnly bool                   `json:"backupsOnly,omitempty"`
+	Schemas     []manifestSchemaStruct `json:"schemas"`
+	Next        string                 `json:"next,omitempty"`
+}
+
+// manifestPageSize is the number of tables the client requests per manifest page
+const manifestPageSize = 1000
+
+// manifestSchemaStruct lists the tables of one schema
+type manifestSchemaStruct struct {
+	Name   string                `json:"name"`
+	Tables []manifestTableStruct `json:"tables"`
+}
+
+// manifestTableStruct describes one table, Engine is blank when the backup has no files for the table
+type manifestTableStruct struct {
+	Name   string `json:"name"`
+	Engine string `json:"engine"`
+	Size   int64  `json:"size"`
+}
+
+// buildManifest combines the tables in a structure dump with their engine and size in the backup
+func buildManifest(tablePath string, backupPath string) (manifestStruct, error) {
+	var manifest manifestStruct
+
+	var sizes sizesStruct
+	if backupPath != "" {
+		var err error
+		sizes, err = backupSizes(backupPath)
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	// Without a structure dump the tables are listed from the backup files
+	if tablePath == "" {
+		manifest.BackupsOnly = true
+		manifest.Schemas = backupManifest(backupPath, sizes)
+
+		return manifest, nil
+	}
+	manifest.DumpOnly = backupPath == ""
+
+	schemaDirs, err := ioutil.ReadDir(tablePath)
+	if err != nil {
+		return manifest, err
+	}
+
+	// ReadDir sorts by name so the manifest order is stable between requests
+	for _, schemaDir := range schemaDirs {
+		if !schemaDir.IsDir() {
+			continue
+		}
+
+		schema := manifestSchemaStruct{Name: schemaDir.Name()}
+		tableFiles, err := ioutil.ReadDir(filepath.Join(tablePath, schema.Name, "tables"))
+		if err != nil && !os.IsNotExist(err) {
+			return manifest, err
+		}
+
+		for _, tableFile := range tableFiles {
+			if !strings.HasSuffix(tableFile.Name(), sqlExtension) {
+				continue
+			}
+
+			table := manifestTableStruct{Name: strings.TrimSuffix(tableFile.Name(), sqlExtension)}
+			if backupPath != "" {
+				table.Engine = backupEngine(backupPath, schema.Name, table.Name)
+			}
+			if schemaSize := sizes.Schemas[schema.Name]; schemaSize != nil {
+				table.Size = schemaSize.Tables[table.Name]
+			}
+			schema.Tables = append(schema.Tables, table)
+		}
+
+		manifest.Schemas = append(manifest.Schemas, schema)
+	}
+
+	return manifest, nil
+}
+
+// backupManifest lists the schemas and tables with files in a backup
+func backupManifest(backupPath string, sizes sizesStruct) []manifestSchemaStruct {
+	var names []string
+	for name := range sizes.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var schemas []manifestSchemaStruct
+	for _, name := range names {
+		var tables []string
+		for table := range sizes.Schemas[name].Tables {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+
+		schema := manifestSchemaStruct{Name: name}
+		for _, table := range tables {
+			schema.Tables = append(schema.Tables, manifestTableStruct{Name: table, Engine: backupEngine(backupPath, name, table), Size: sizes.Schemas[name].Tables[table]})
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas
+}
+
+// backupEngine returns the storage engine of a table from the files in the backup
+func backupEngine(backupPath string, schema string, table string) string {
+	if mysqlUTF8.NeedsEncoding(schema) {
+		schema = mysqlUTF8.EncodeFilename(schema)
+	}
+	if mysqlUTF8.NeedsEncoding(table) {
+		table = mysqlUTF8.EncodeFilename(table)
+	}
+
+	for ext, engine := range map[string]string{".ibd": "InnoDB", ".MYD": "MyISAM"} {
+		for _, suffix := range []string{"", xbcryptExtension} {
+			if _, err := os.Stat(filepath.Join(backupPath, schema, table+ext+suffix)); err == nil {
+				return engine
+			}
+		}
+	}
+
+	return ""
+}
+
+// manifestHandler serves the manifest as json. It is rebuilt when scheduled dumps change the structure dump being served.
+func manifestHandler(tables *servedDirStruct, backupPath string, basePath string, trustedProxies []*net.IPNet) http.HandlerFunc {
+	var mu sync.Mutex
+	var built bool
+	var builtFor string
+	var manifest manifestStruct
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if tablePath := tables.get(); !built || tablePath != builtFor {
+			var err error
+			manifest, err = buildManifest(tablePath, backupPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			built = true
+			builtFor = tablePath
+		}
+
+		// The URL the server is reached at is included for tools reading the manifest through a reverse proxy
+		m := manifest
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			m = manifest.page(r.URL.Query().Get("after"), n)
+		}
+		m.URL = externalURL(r, basePath, trustedProxies)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m)
+	}
+}
+
+// manifestCursor identifies a position in the manifest, an empty schema is listed as its own entry with a blank table
+func manifestCursor(schema string, table string) string {
+	return schema + "/" + table
+}
+
+// cursorAfter reports whether cursor a comes after cursor b in manifest order. Schema names cannot contain a slash so the cursor is split at the first one.
+func cursorAfter(a string, b string) bool {
+	aSchema, aTable := splitCursor(a)
+	bSchema, bTable := splitCursor(b)
+	if aSchema != bSchema {
+		return aSchema > bSchema
+	}
+
+	return aTable > bTable
+}
+
+// splitCursor returns the schema and table of a manifest cursor
+func splitCursor(cursor string) (string, string) {
+	i := strings.Index(cursor, "/")
+	if i < 0 {
+		return cursor, ""
+	}
+
+	return cursor[:i], cursor[i+1:]
+}
+
+// page returns up to limit tables of the manifest following the after cursor. A schema whose tables span pages is repeated at the start of the next page.
+func (manifest manifestStruct) page(after string, limit int) manifestStruct {
+	page := manifest
+	page.Schemas = nil
+
+	var n int
+	for _, schema := range manifest.Schemas {
+		if n == limit {
+			break
+		}
+
+		// Schemas without tables take up one entry so they are still listed
+		if len(schema.Tables) == 0 {
+			if cursor := manifestCursor(schema.Name, ""); after == "" || cursorAfter(cursor, after) {
+				page.Schemas = append(page.Schemas, schema)
+				page.Next = cursor
+				n++
+			}
+			continue
+		}
+
+		var tables []manifestTableStruct
+		for _, table := range schema.Tables {
+			if n == limit {
+				break
+			}
+			if cursor := manifestCursor(schema.Name, table.Name); after == "" || cursorAfter(cursor, after) {
+				tables = append(tables, table)
+				page.Next = cursor
+				n++
+			}
+		}
+		if len(tables) > 0 {
+			page.Schemas = append(page.Schemas, manifestSchemaStruct{Name: schema.Name, Tables: tables})
+		}
+	}
+
+	// Only a full page can be followed by another one
+	if n < limit || page.Next == manifestCursor(lastEntry(manifest.Schemas)) {
+		page.Next = ""
+	}
+
+	return page
+}
+
+// lastEntry returns the schema and table of the last manifest entry
+func lastEntry(schemas []manifestSchemaStruct) (string, string) {
+	if len(schemas) == 0 {
+		return "", ""
+	}
+	last := schemas[len(schemas)-1]
+	if len(last.Tables) == 0 {
+		return last.Name, ""
+	}
+
+	return last.Name, last.Tables[len(last.Tables)-1].Name
+}
+
+// validate checks every name in a manifest received from a server is usable and sizes are not negative
+func (manifest manifestStruct) validate() error {
+	for _, schema := range manifest.Schemas {
+		if !validObjectName(schema.Name) {
+			return fmt.Errorf("invalid schema name %q", schema.Name)
+		}
+
+		for _, table := range schema.Tables {
+			if !validObjectName(table.Name) {
+				return fmt.Errorf("invalid table name %q in schema %s", table.Name, schema.Name)
+			}
+			if table.Size < 0 {
+				return fmt.Errorf("negative size for table %s.%s", schema.Name, table.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// startList prints the contents of a trite server as tab separated schema, table, engine and size lines or as json
+func startList(clientConfig clientConfigStruct, output string, w io.Writer) error {
+	manifest, err := fetchManifest(clientConfig.serverURL("manifest"))
+	if err != nil {
+		return err
+	}
+
+	// Only keep the schemas and tables selected by the filter flags
+	var schemas []manifestSchemaStruct
+	for _, schema := range manifest.Schemas {
+		if !clientConfig.filter.schema(schema.Name) {
+			continue
+		}
+
+		var tables []manifestTableStruct
+		for _, table := range schema.Tables {
+			if clientConfig.filter.table(schema.Name, table.Name) {
+				tables = append(tables, table)
+			}
+		}
+		schema.Tables = tables
+		schemas = append(schemas, schema)
+	}
+	manifest.Schemas = schemas
+
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(manifest)
+	}
+
+	for _, schema := range manifest.Schemas {
+		for _, table := range schema.Tables {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", schema.Name, table.Name, table.Engine, formatSize(table.Size))
+		}
+	}
+
+	return nil
+}
+
+// fetchManifest downloads and validates the manifest of a trite server a page at a time, older servers ignore the page parameters and return the whole manifest
+func fetchManifest(url string) (manifestStruct, error) {
+	var manifest manifestStruct
+
+	var after string
+	for {
+		page, err := fetchManifestPage(url, after)
+		if err != nil {
+			return manifest, err
+		}
+
+		// A schema continued from the previous page is merged
+		for _, schema := range page.Schemas {
+			if last := len(manifest.Schemas) - 1; last >= 0 && manifest.Schemas[last].Name == schema.Name {
+				manifest.Schemas[last].Tables = append(manifest.Schemas[last].Tables, schema.Tables...)
+			} else {
+				manifest.Schemas = append(manifest.Schemas, schema)
+			}
+		}
+		manifest.URL = page.URL
+		manifest.DumpOnly = page.DumpOnly
+		manifest.BackupsOnly = page.BackupsOnly
+
+		// A cursor that does not move forward would never finish
+		if page.Next == "" {
+			return manifest, nil
+		}
+		if after != "" && !cursorAfter(page.Next, after) {
+			return manifest, fmt.Errorf("Malformed manifest from %s - page cursor %q does not follow %q", url, page.Next, after)
+		}
+		after = page.Next
+	}
+}
+
+// fetchManifestPage downloads and validates one page of a manifest
+func fetchManifestPage(manifestURL string, after string) (manifestStruct, error) {
+	var manifest manifestStruct
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(manifestPageSize))
+	if after != "" {
+		query.Set("after", after)
+	}
+
+	resp, err := httpGet(manifestURL + "?" + query.Encode())
+	if err != nil {
+		return manifest, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return manifest, fmt.Errorf("%d returned from: %s", resp.StatusCode, manifestURL)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("Malformed manifest from %s - %s", manifestURL, err)
+	}
+	err = manifest.validate()
+	if err != nil {
+		return manifest, fmt.Errorf("Malformed manifest from %s - %s", manifestURL, err)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func FuzzFetchManifest(f *testing.F) {
+	f.Add([]byte(`{"schemas":[{"name":"shop","tables":[{"name":"orders","engine":"InnoDB","size":98304}]}]}`))
+	f.Add([]byte(`{"url":"https://proxy/trite","dumpOnly":true,"schemas":[{"name":"my.shop","tables":[{"name":"a#b","engine":"","size":0}]}],"next":"my.shop/a#b"}`))
+	f.Add([]byte(`{"schemas":[{"name":"..","tables":[]}]}`))
+	f.Add([]byte(`{"schemas":[{"name":"shop","tables":[{"name":"../../etc/passwd","size":1}]}]}`))
+	f.Add([]byte(`{"schemas":[{"name":"shop","tables":[{"name":"orders","size":-1}]}]}`))
+	f.Add([]byte(`{"schemas":[{"name":"shop\u0000","tables":null}]}`))
+	f.Add([]byte(`{"schemas":`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(body)
+		}))
+		defer ts.Close()
+
+		manifest, err := fetchManifest(ts.URL + "/manifest")
+		if err != nil {
+			return
+		}
+
+		for _, schema := range manifest.Schemas {
+			if !validObjectName(schema.Name) {
+				t.Errorf("invalid schema name %q accepted", schema.Name)
+			}
+			for _, table := range schema.Tables {
+				if !validObjectName(table.Name) {
+					t.Errorf("invalid table name %q accepted in schema %q", table.Name, schema.Name)
+				}
+				if table.Size < 0 {
+					t.Errorf("negative size %d accepted for %q.%q", table.Size, schema.Name, table.Name)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maskRulesMap stores masking functions by fully qualified table name and column name
+type maskRulesMap map[string]map[string]string
+
+var errApplyMask error
+
+// loadMaskRules reads a YAML masking rules file. The file maps schema.table keys to column/masking function pairs, a column left empty or set to YAML null uses the null function:
+//
+//	customers.people:
+//	  email: email
+//	  last_name: hash
+//	  ssn: null
+//	  notes: "fixed:redacted"
+func loadMaskRules(file string) (maskRulesMap, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(maskRulesMap)
+	err = yaml.Unmarshal(b, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse masking rules file %s - %s", file, err)
+	}
+
+	// Validate all masking functions up front so a bad rule doesn't surface after data has been transferred
+	for fqTable, columns := range rules {
+		if len(strings.Split(fqTable, ".")) != 2 {
+			return nil, fmt.Errorf("Masking rule key %s must be in schema.table format", fqTable)
+		}
+
+		for column, function := range columns {
+			_, err = maskExpression(column, function)
+			if err != nil {
+				return nil, fmt.Errorf("Masking rule for %s.%s - %s", fqTable, column, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// maskExpression returns the SQL expression that replaces a column value for a masking function
+func maskExpression(column string, function string) (string, error) {
+	col := addQuotes(column)
+
+	switch {
+	case function == "null" || function == "":
+		return "NULL", nil
+	case function == "blank":
+		return "''", nil
+	case function == "hash":
+		return "sha2(" + col + ", 256)", nil
+	case function == "email":
+		return "if(" + col + " is null, NULL, concat(left(sha2(" + col + ", 256), 16), '@example.invalid'))", nil
+	case strings.HasPrefix(function, "fixed:"):
+		return "'" + strings.Replace(strings.TrimPrefix(function, "fixed:"), "'", "''", -1) + "'", nil
+	}
+
+	return "", fmt.Errorf("unknown masking function %q (valid functions are null, blank, hash, email and fixed:<value>)", function)
+}
+
+// maskStatement returns an update statement masking a restored table or a blank string when there are no rules for the table. Generated columns are skipped, they are recomputed from the masked columns.
+func (rules maskRulesMap) maskStatement(schema string, table string, generated map[string]bool) string {
+	columns, ok := rules[schema+"."+table]
+	if !ok || len(columns) == 0 {
+		return ""
+	}
+
+	// Sort columns so the generated statement is stable between runs
+	var names []string
+	for column := range columns {
+		if !generated[column] {
+			names = append(names, column)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	var sets []string
+	for _, column := range names {
+		expr, _ := maskExpression(column, columns[column])
+		sets = append(sets, addQuotes(column)+" = "+expr)
+	}
+
+	return "update " + addQuotes(table) + " set " + strings.Join(sets, ", ")
+}
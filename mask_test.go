@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaskExpression(t *testing.T) {
+	tests := []struct {
+		function string
+		expected string
+	}{
+		{"null", "NULL"},
+		{"", "NULL"},
+		{"blank", "''"},
+		{"hash", "sha2(`ssn`, 256)"},
+		{"email", "if(`ssn` is null, NULL, concat(left(sha2(`ssn`, 256), 16), '@example.invalid'))"},
+		{"fixed:redacted", "'redacted'"},
+		{"fixed:it's", "'it''s'"},
+		{"fixed:", "''"},
+	}
+
+	for _, tt := range tests {
+		expr, err := maskExpression("ssn", tt.function)
+		if err != nil {
+			t.Errorf("%q: %s", tt.function, err)
+			continue
+		}
+		if expr != tt.expected {
+			t.Errorf("%q: expression %s, expected %s", tt.function, expr, tt.expected)
+		}
+	}
+
+	_, err := maskExpression("ssn", "shuffle")
+	if err == nil || !strings.Contains(err.Error(), "unknown masking function") {
+		t.Errorf("unknown function returned %v", err)
+	}
+}
+
+func TestLoadMaskRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite-mask")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		rules    string
+		expected string
+		err      string
+	}{
+		{"every function", "customers.people:\n  email: email\n  last_name: hash\n  ssn: null\n  phone:\n  city: blank\n  notes: \"fixed:redacted\"\n", "update `people` set `city` = '', `email` = if(`email` is null, NULL, concat(left(sha2(`email`, 256), 16), '@example.invalid')), `last_name` = sha2(`last_name`, 256), `notes` = 'redacted', `phone` = NULL, `ssn` = NULL", ""},
+		{"quoted null", "customers.people:\n  ssn: \"null\"\n", "update `people` set `ssn` = NULL", ""},
+		{"unknown function", "customers.people:\n  ssn: shuffle\n", "", "unknown masking function"},
+		{"key without schema", "people:\n  ssn: null\n", "", "schema.table format"},
+		{"invalid yaml", "customers.people: [ssn\n", "", "Unable to parse"},
+	}
+
+	for i, tt := range tests {
+		file := filepath.Join(dir, "rules"+strconv.Itoa(i)+".yaml")
+		err = ioutil.WriteFile(file, []byte(tt.rules), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rules, err := loadMaskRules(file)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, expected %s", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if stmt := rules.maskStatement("customers", "people", nil); stmt != tt.expected {
+			t.Errorf("%s: statement %s, expected %s", tt.name, stmt, tt.expected)
+		}
+	}
+}
+
+func TestMaskStatementGenerated(t *testing.T) {
+	rules := maskRulesMap{"customers.people": {"email": "email", "email_domain": "blank"}}
+
+	tests := []struct {
+		name      string
+		table     string
+		generated map[string]bool
+		expected  string
+	}{
+		{"generated column skipped", "people", map[string]bool{"email_domain": true}, "update `people` set `email` = if(`email` is null, NULL, concat(left(sha2(`email`, 256), 16), '@example.invalid'))"},
+		{"only generated columns", "people", map[string]bool{"email": true, "email_domain": true}, ""},
+		{"table without rules", "orders", nil, ""},
+	}
+
+	for _, tt := range tests {
+		if stmt := rules.maskStatement("customers", tt.table, tt.generated); stmt != tt.expected {
+			t.Errorf("%s: statement %s, expected %s", tt.name, stmt, tt.expected)
+		}
+	}
+}
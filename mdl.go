@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// erLockWaitTimeout is the MySQL error returned when lock_wait_timeout passes waiting for a metadata lock
+	erLockWaitTimeout = 1205
+
+	// erLockDeadlock is the MySQL error returned when a statement is chosen as the victim of a deadlock
+	erLockDeadlock = 1213
+
+	// mdlReportInterval is how long a statement waits before the metadata lock holders are looked up and displayed
+	mdlReportInterval = 5 * time.Second
+)
+
+// sqlQueryer is implemented by *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// mdlHolders describes the sessions holding metadata locks that block statements on a table, from sys.schema_table_lock_waits (5.7+) or the sessions using the table on older versions
+func mdlHolders(q sqlQueryer, schema string, table string) string {
+	rows, err := q.Query("select distinct blocking_pid, blocking_account, blocking_lock_type, ifnull(sql_kill_blocking_connection, '') from sys.schema_table_lock_waits where object_schema = ? and object_name = ?", schema, table)
+	if err != nil {
+		blockers, err := blockingSessions(q, schema, table)
+		if err != nil {
+			return ""
+		}
+
+		var described []string
+		for _, b := range blockers {
+			described = append(described, b.String())
+		}
+
+		return strings.Join(described, ", ")
+	}
+	defer rows.Close()
+
+	var holders []string
+	for rows.Next() {
+		var pid, account, lockType, kill string
+		if rows.Scan(&pid, &account, &lockType, &kill) == nil {
+			holders = append(holders, fmt.Sprintf("id %s %s %s lock (%s)", pid, account, lockType, kill))
+		}
+	}
+
+	return strings.Join(holders, ", ")
+}
+
+// execMDL runs a statement that takes an exclusive metadata lock on the table being restored. Lock wait timeouts and deadlocks are retried -applyRetries times, a lock wait timeout error that is not retried names the lock holders for the error log.
+func execMDL(tx *sql.Tx, clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct, query string) (sql.Result, error) {
+	var retries int
+	for {
+		res, err := execMDLOnce(tx, downloadInfo, query)
+		if isLockError(err) && retryApply(clientConfig, downloadInfo, &retries, query, lockHolders(downloadInfo, err)) {
+			continue
+		}
+
+		return res, lockHolders(downloadInfo, err)
+	}
+}
+
+// isLockError returns true for the lock wait timeout and deadlock errors a statement can succeed after when it is run again
+func isLockError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+
+	return ok && (mysqlErr.Number == erLockWaitTimeout || mysqlErr.Number == erLockDeadlock)
+}
+
+// execMDLOnce runs a statement taking a metadata lock, while it waits the lock holders are shown in the status display
+func execMDLOnce(tx *sql.Tx, downloadInfo *downloadInfoStruct, query string) (sql.Result, error) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(mdlReportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if holders := mdlHolders(downloadInfo.db, downloadInfo.schema, downloadInfo.table); holders != "" {
+					downloadInfo.publish("Waiting for metadata lock held by "+holders, nil)
+				}
+			}
+		}
+	}()
+
+	res, err := execSQL(tx, query)
+	close(done)
+
+	return res, err
+}
+
+// lockHolders adds the metadata lock holders to a lock wait timeout error
+func lockHolders(downloadInfo *downloadInfoStruct, err error) error {
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == erLockWaitTimeout {
+		if holders := mdlHolders(downloadInfo.db, downloadInfo.schema, downloadInfo.table); holders != "" {
+			err = fmt.Errorf("%s - metadata lock held by %s", err, holders)
+		}
+	}
+
+	return err
+}
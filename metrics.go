@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// metricsInterval is how often the metrics file is rewritten while tables change status
+const metricsInterval = time.Second
+
+// restoreMetricsStruct is the state of a restore exported as metrics
+type restoreMetricsStruct struct {
+	start    time.Time
+	done     bool
+	finished map[string]int
+	active   map[string]bool
+}
+
+// metricsExporter returns an event consumer writing table status counts to a file in the Prometheus text format read by the node_exporter textfile collector.
+// The file is written once before the consumer is returned so an unwritable path is reported before the restore starts.
+func metricsExporter(file string) (func(<-chan tableEventStruct), error) {
+	m := &restoreMetricsStruct{start: time.Now(), finished: make(map[string]int), active: make(map[string]bool)}
+	err := m.write(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(events <-chan tableEventStruct) {
+		var written time.Time
+		var failed bool
+		for e := range events {
+			fqTable := e.fqTable()
+			if e.Progress != nil || fqTable == "" {
+				continue
+			}
+
+			if e.final() {
+				delete(m.active, fqTable)
+				m.finished[e.Status]++
+			} else {
+				m.active[fqTable] = true
+			}
+
+			if time.Since(written) < metricsInterval {
+				continue
+			}
+			written = time.Now()
+
+			err := m.write(file)
+			if err != nil && !failed {
+				fmt.Fprintln(os.Stderr, "WARNING: Unable to write the metrics file -", err)
+				failed = true
+			}
+		}
+
+		m.done = true
+		err := m.write(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: Unable to write the metrics file -", err)
+		}
+	}, nil
+}
+
+// write replaces the metrics file by renaming a temporary file over it so a scrape never reads a partial file
+func (m *restoreMetricsStruct) write(file string) error {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# HELP trite_restore_tables_total Tables that reached a final status.")
+	fmt.Fprintln(&b, "# TYPE trite_restore_tables_total counter")
+	for _, status := range []string{statusRestored, statusUnchanged, statusSkipped, statusError} {
+		fmt.Fprintf(&b, "trite_restore_tables_total{status=%q} %d\n", status, m.finished[status])
+	}
+
+	fmt.Fprintln(&b, "# HELP trite_restore_tables_in_progress Tables being downloaded or applied.")
+	fmt.Fprintln(&b, "# TYPE trite_restore_tables_in_progress gauge")
+	fmt.Fprintln(&b, "trite_restore_tables_in_progress", len(m.active))
+
+	fmt.Fprintln(&b, "# HELP trite_restore_start_time_seconds Unix time the restore started.")
+	fmt.Fprintln(&b, "# TYPE trite_restore_start_time_seconds gauge")
+	fmt.Fprintln(&b, "trite_restore_start_time_seconds", m.start.Unix())
+
+	done := 0
+	if m.done {
+		done = 1
+	}
+	fmt.Fprintln(&b, "# HELP trite_restore_done 1 once every table has reached a final status.")
+	fmt.Fprintln(&b, "# TYPE trite_restore_done gauge")
+	fmt.Fprintln(&b, "trite_restore_done", done)
+
+	tmp := file + triteExtension
+	err := ioutil.WriteFile(tmp, b.Bytes(), filePerms)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// migrateListen is the only address the migrate mode server listens on, the client downloading from it runs in the same process
+const migrateListen = "127.0.0.1"
+
+// startMigrate dumps the source database, serves the dump and backup from a local trite server and restores them to the target database. The number of errors is returned.
+func startMigrate(clientConfig clientConfigStruct, source *mysqlCredentials, target *mysqlCredentials, backupPath string) int {
+	tmpDir, err := ioutil.TempDir("", "trite")
+	checkErr(err)
+	onExit(func() { os.RemoveAll(tmpDir) })
+	defer os.RemoveAll(tmpDir)
+
+	dumpdir, err := runDump(tmpDir, source, clientConfig.filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	go startServer(serverConfigStruct{tablePath: dumpdir, backupPath: backupPath, port: clientConfig.triteServerPort, listen: migrateListen, authToken: authToken})
+
+	// Wait for the server to finish verifying the backup and start listening
+	var ready bool
+	for i := 0; i < 600 && !ready; i++ {
+		_, err = fetchGeneration(clientConfig)
+		ready = err == nil
+		if !ready {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if !ready {
+		fmt.Fprintln(os.Stderr, "The local trite server did not start -", err)
+		os.Exit(1)
+	}
+
+	fmt.Println()
+	return startClient(clientConfig, target)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// mirrorsStruct is the set of equivalent trite servers a restore can fail over between, nil when only one server is used
+type mirrorsStruct struct {
+	mu      sync.Mutex
+	bases   []string
+	current int
+}
+
+// mirrors is set by discoverServer when more than one server serves the same backup generation
+var mirrors *mirrorsStruct
+
+// count returns the number of mirrors
+func (m *mirrorsStruct) count() int {
+	if m == nil {
+		return 0
+	}
+
+	return len(m.bases)
+}
+
+// base returns the index of the mirror url was built from, -1 when it is not a mirror url
+func (m *mirrorsStruct) base(url string) int {
+	for i, base := range m.bases {
+		if url == base || strings.HasPrefix(url, base+"/") {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// route rewrites a url built from any mirror to the mirror currently in use
+func (m *mirrorsStruct) route(url string) string {
+	if m == nil {
+		return url
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.base(url)
+	if i < 0 || i == m.current {
+		return url
+	}
+
+	return m.bases[m.current] + strings.TrimPrefix(url, m.bases[i])
+}
+
+// failover moves to the next mirror after a request to url failed. Requests failing on a mirror that was already left do not move again.
+func (m *mirrorsStruct) failover(url string) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.base(url)
+	if i < 0 {
+		return false
+	}
+	if i == m.current {
+		m.current = (m.current + 1) % len(m.bases)
+		fmt.Println("Trite server", m.bases[i], "failed, failing over to", m.bases[m.current])
+	}
+
+	return true
+}
+
+// etagGeneration returns the generation an ETag set by etagHandler was made from, blank when the ETag has none
+func etagGeneration(etag string) string {
+	parts := strings.Split(strings.Trim(etag, `"`), "-")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return strings.Join(parts[:len(parts)-2], "-")
+}
+
+// revalidate checks a file planned on another mirror is the same file on the current mirror and returns its validators there. Sizes alone are not trusted since InnoDB files of different backups are often the same size, the ETags must name the same generation.
+func (m *mirrorsStruct) revalidate(ctx context.Context, url string, planned headStruct) (headStruct, bool) {
+	resp, err := httpRequest(ctx, "HEAD", url)
+	if err != nil {
+		return headStruct{}, false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return headStruct{}, false
+	}
+	head := newHead(resp)
+
+	gen := etagGeneration(head.etag)
+	if gen == "" || gen != etagGeneration(planned.etag) {
+		return headStruct{}, false
+	}
+
+	return head, head.size == planned.size
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// erTableSchemaMismatch is the MySQL error returned when an imported tablespace does not match the table definition
+const erTableSchemaMismatch = 1808
+
+var (
+	// mismatchRowFormatRe extracts the row format of the .ibd file from a schema mismatch error
+	mismatchRowFormatRe = regexp.MustCompile(`\.ibd file has (ROW_TYPE_\w+) row format`)
+
+	// rowFormatRe matches a ROW_FORMAT table option in a create statement
+	rowFormatRe = regexp.MustCompile(`(?i)\bROW_FORMAT\s*=\s*\w+`)
+)
+
+// isSchemaMismatch returns true when err is MySQL error 1808
+func isSchemaMismatch(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+
+	return ok && mysqlErr.Number == erTableSchemaMismatch
+}
+
+// mismatchRowFormat returns the row format of the .ibd file from a schema mismatch error or a blank string when the mismatch is not a row format difference
+func mismatchRowFormat(err error) string {
+	m := mismatchRowFormatRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(m[1], "ROW_TYPE_")
+}
+
+// withRowFormat sets the ROW_FORMAT table option of a create table statement
+func withRowFormat(stmt string, format string) string {
+	if rowFormatRe.MatchString(stmt) {
+		return rowFormatRe.ReplaceAllString(stmt, "ROW_FORMAT="+format)
+	}
+
+	return strings.TrimRight(strings.TrimSpace(stmt), ";") + " ROW_FORMAT=" + format
+}
+
+// retryImportRowFormat recreates a table with the row format of its .ibd file and imports the tablespace again. The tablespace files are moved aside while the table is recreated so dropping it cannot remove them.
+func retryImportRowFormat(tx *sql.Tx, downloadInfo *downloadInfoStruct, stmt string, format string) error {
+	table := addQuotes(downloadInfo.table)
+
+	_, err := execSQL(tx, "unlock tables")
+	if err != nil {
+		return err
+	}
+
+	for _, triteFile := range downloadInfo.triteFiles {
+		err = renameFile(strings.TrimSuffix(triteFile, triteExtension), triteFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, query := range []string{"drop table if exists " + table, withRowFormat(stmt, format), "alter table " + table + " discard " + downloadInfo.tablespaces(), "lock table " + table + " write"} {
+		_, err = execSQL(tx, query)
+		if err != nil {
+			for _, triteFile := range downloadInfo.triteFiles {
+				removeFile(triteFile)
+			}
+
+			return err
+		}
+	}
+
+	for _, triteFile := range downloadInfo.triteFiles {
+		err = renameFile(triteFile, strings.TrimSuffix(triteFile, triteExtension))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = execSQL(tx, "alter table "+table+" import "+downloadInfo.tablespaces())
+
+	return err
+}
+
+// schemaMismatchAdvice explains how to fix a schema mismatch using the row format and column definitions of the table on the target
+func schemaMismatchAdvice(tx *sql.Tx, schema string, table string, importErr error) string {
+	var b strings.Builder
+
+	var rowFormat string
+	tx.QueryRow("select row_format from information_schema.tables where table_schema = ? and table_name = ?", schema, table).Scan(&rowFormat)
+	fmt.Fprintf(&b, "\tTarget table %s.%s has ROW_FORMAT=%s\n", schema, table, rowFormat)
+
+	rows, err := tx.Query("select column_name, column_type from information_schema.columns where table_schema = ? and table_name = ? order by ordinal_position", schema, table)
+	if err == nil {
+		var column, columnType string
+		for rows.Next() {
+			if rows.Scan(&column, &columnType) == nil {
+				fmt.Fprintf(&b, "\t\t%s %s\n", column, columnType)
+			}
+		}
+		rows.Close()
+	}
+
+	msg := importErr.Error()
+	switch {
+	case mismatchRowFormat(importErr) != "":
+		fmt.Fprintf(&b, "\tFix: recreate the table with ROW_FORMAT=%s so it matches the .ibd file, then import again", mismatchRowFormat(importErr))
+	case strings.Contains(msg, "precise type mismatch"):
+		b.WriteString("\tFix: a column type differs from the source at the storage level. Temporal columns (datetime, timestamp, time) created before MySQL 5.6.4 use the old format, run ALTER TABLE ... FORCE on the source table before taking the backup or restore to a server of the same version")
+	default:
+		b.WriteString("\tFix: recreate the table on the target with exactly the definition used on the source (column types, ROW_FORMAT and KEY_BLOCK_SIZE) and import again")
+	}
+
+	return b.String()
+}
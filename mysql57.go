@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// cfpExtension is the transfer key file written for encrypted tablespaces by MySQL 5.7 and xtrabackup 2.4
+const cfpExtension = ".cfp"
+
+var errDownloadKeyring error
+
+// keyringActive returns true when a keyring plugin is loaded, MySQL 5.7 can only import encrypted tablespaces with one
+func keyringActive(db *sql.DB) bool {
+	var count int
+	err := db.QueryRow("select count(*) from information_schema.plugins where plugin_name like 'keyring%' and plugin_status = 'ACTIVE'").Scan(&count)
+
+	return err == nil && count > 0
+}
+
+// exportMetadata returns the extensions of the .cfg and .cfp files xtrabackup --export wrote next to a 5.6+ tablespace, fileurl is the tablespace url without an extension.
+// They are downloaded and placed alongside the .ibd so IMPORT TABLESPACE validates the row format and columns against the table. A missing .cfg is imported without
+// the checks unless -allowMissingCfg=false, missingCfg makes the warning print once for the partitions of a table.
+func exportMetadata(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct, fileurl string, heads map[string]headStruct, partition string, missingCfg *bool) ([]string, error) {
+	var extensions []string
+
+	resp, err := httpRequest(downloadInfo.ctx, "HEAD", fileurl+".cfg")
+	checkErr(err)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		extensions = append(extensions, partition+".cfg")
+		heads[partition+".cfg"] = newHead(resp)
+	case clientConfig.allowMissingCfg:
+		// MySQL imports without the .cfg but skips the schema consistency checks
+		if !*missingCfg {
+			warnf(levelWarn, "The .cfg file is missing for table %s.%s - importing without metadata checks", downloadInfo.schema, downloadInfo.table)
+			report.addMissingCfg(downloadInfo.schema + "." + downloadInfo.table)
+			*missingCfg = true
+		}
+	default:
+		errDownloadCfg = fmt.Errorf("The .cfg file is missing for table %s.%s, -allowMissingCfg=false requires one", downloadInfo.schema, downloadInfo.table)
+		return nil, errDownloadCfg
+	}
+
+	// Encrypted 5.7 tablespaces are exported with a .cfp transfer key
+	resp, err = httpRequest(downloadInfo.ctx, "HEAD", fileurl+cfpExtension)
+	checkErr(err)
+
+	if resp.StatusCode == http.StatusOK {
+		if !downloadInfo.keyring {
+			errDownloadKeyring = fmt.Errorf("Table %s.%s is encrypted and the target has no keyring plugin loaded (e.g. early-plugin-load=keyring_file.so)", downloadInfo.schema, downloadInfo.table)
+			return nil, errDownloadKeyring
+		}
+		extensions = append(extensions, partition+cfpExtension)
+		heads[partition+cfpExtension] = newHead(resp)
+	}
+
+	return extensions, nil
+}
+
+// removeExportMetadata removes the .cfg and .cfp files of an imported table, they are only read during the import and the .cfp holds the tablespace key
+func removeExportMetadata(downloadInfo *downloadInfoStruct) {
+	for _, triteFile := range downloadInfo.triteFiles {
+		if strings.HasSuffix(triteFile, ".cfg"+triteExtension) || strings.HasSuffix(triteFile, cfpExtension+triteExtension) {
+			removeFile(strings.TrimSuffix(triteFile, triteExtension))
+		}
+	}
+}
+
+// generatedColumns returns the generated columns of a table. Their values are computed from other columns so they cannot be updated by masking.
+func generatedColumns(tx *sql.Tx, schema string, table string) map[string]bool {
+	columns := make(map[string]bool)
+
+	rows, err := tx.Query("select column_name from information_schema.columns where table_schema = ? and table_name = ? and extra like '%GENERATED%'", schema, table)
+	if err != nil {
+		return columns
+	}
+	defer rows.Close()
+
+	var column string
+	for rows.Next() {
+		if rows.Scan(&column) == nil {
+			columns[column] = true
+		}
+	}
+
+	return columns
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportMetadata(t *testing.T) {
+	tests := []struct {
+		name            string
+		files           []string
+		keyring         bool
+		allowMissingCfg bool
+		partition       string
+		extensions      []string
+		err             *error
+	}{
+		{"cfg", []string{"t.cfg"}, false, false, "", []string{".cfg"}, nil},
+		{"encrypted", []string{"t.cfg", "t.cfp"}, true, false, "", []string{".cfg", ".cfp"}, nil},
+		{"encrypted without keyring", []string{"t.cfg", "t.cfp"}, false, false, "", nil, &errDownloadKeyring},
+		{"missing cfg allowed", nil, false, true, "", nil, nil},
+		{"missing cfg encrypted", []string{"t.cfp"}, true, true, "", []string{".cfp"}, nil},
+		{"missing cfg strict", nil, false, false, "", nil, &errDownloadCfg},
+		{"partition", []string{"t#P#p0.cfg", "t#P#p0.cfp"}, true, false, "#P#p0", []string{"#P#p0.cfg", "#P#p0.cfp"}, nil},
+	}
+
+	for _, tt := range tests {
+		files := make(map[string]bool)
+		for _, file := range tt.files {
+			files["/backups/shop/"+file] = true
+		}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !files[r.URL.Path] {
+				http.NotFound(w, r)
+			}
+		}))
+
+		clientConfig := clientConfigStruct{allowMissingCfg: tt.allowMissingCfg}
+		downloadInfo := downloadInfoStruct{ctx: context.Background(), schema: "shop", table: "t", keyring: tt.keyring}
+		heads := make(map[string]headStruct)
+		var missingCfg bool
+
+		extensions, err := exportMetadata(clientConfig, &downloadInfo, joinURL(ts.URL, "backups", "shop", "t"+tt.partition), heads, tt.partition, &missingCfg)
+		ts.Close()
+
+		switch {
+		case tt.err == nil && err != nil:
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+		case tt.err != nil && (err == nil || err != *tt.err):
+			t.Errorf("%s: error %v, expected %v", tt.name, err, *tt.err)
+		}
+		if strings.Join(extensions, ",") != strings.Join(tt.extensions, ",") {
+			t.Errorf("%s: extensions %v, expected %v", tt.name, extensions, tt.extensions)
+		}
+		for _, extension := range extensions {
+			if _, ok := heads[extension]; !ok {
+				t.Errorf("%s: no head recorded for %s", tt.name, extension)
+			}
+		}
+		if missingCfg != (tt.allowMissingCfg && !files["/backups/shop/t"+tt.partition+".cfg"]) {
+			t.Errorf("%s: missing .cfg recorded as %t", tt.name, missingCfg)
+		}
+	}
+}
+
+func TestRemoveExportMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var downloadInfo downloadInfoStruct
+	for _, file := range []string{"t.ibd", "t.cfg", "t.cfp", "t#P#p0.cfg"} {
+		err = ioutil.WriteFile(filepath.Join(dir, file), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		downloadInfo.triteFiles = append(downloadInfo.triteFiles, filepath.Join(dir, file+triteExtension))
+	}
+
+	removeExportMetadata(&downloadInfo)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "t.ibd" {
+		t.Errorf("files left after the import %v, expected only t.ibd", files)
+	}
+}
+
+func TestMaskStatementGeneratedColumns(t *testing.T) {
+	rules := maskRulesMap{"shop.customers": {"email": "hash", "name": "blank", "email_domain": "null"}}
+
+	tests := []struct {
+		generated map[string]bool
+		expected  string
+	}{
+		{nil, "update `customers` set `email` = sha2(`email`, 256), `email_domain` = NULL, `name` = ''"},
+		{map[string]bool{"email_domain": true}, "update `customers` set `email` = sha2(`email`, 256), `name` = ''"},
+		{map[string]bool{"email": true, "name": true, "email_domain": true}, ""},
+	}
+
+	for _, tt := range tests {
+		if stmt := rules.maskStatement("shop", "customers", tt.generated); stmt != tt.expected {
+			t.Errorf("maskStatement with generated %v = %q, expected %q", tt.generated, stmt, tt.expected)
+		}
+	}
+}
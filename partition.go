@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// partitionListings caches the backup directory listing of each schema, listings are only read for tables without a .ibd file
+var partitionListings = struct {
+	mu    sync.Mutex
+	files map[string][]string
+}{files: make(map[string][]string)}
+
+// backupPartitions returns the partition suffixes such as #P#p0 or #P#p0#SP#p0sp0 of a partitioned table in the backup, nil when the table has no partition files
+func backupPartitions(ctx context.Context, schemaURL string, tableFilename string) []string {
+	partitionListings.mu.Lock()
+	files, ok := partitionListings.files[schemaURL]
+	if !ok {
+		resp, err := httpRequest(ctx, "GET", schemaURL)
+		if err == nil {
+			if resp.StatusCode == 200 {
+				files = parseAnchor(resp)
+			}
+			resp.Body.Close()
+		}
+		partitionListings.files[schemaURL] = files
+	}
+	partitionListings.mu.Unlock()
+
+	// Partition files are named table#P#partition.ibd, lower case #p# on case insensitive filesystems
+	var partitions []string
+	for _, file := range files {
+		file = strings.TrimSuffix(file, xbcryptExtension)
+		if !strings.HasSuffix(file, ".ibd") {
+			continue
+		}
+
+		name := strings.TrimSuffix(file, ".ibd")
+		if strings.HasPrefix(name, tableFilename+"#P#") || strings.HasPrefix(name, tableFilename+"#p#") {
+			partitions = append(partitions, strings.TrimPrefix(name, tableFilename))
+		}
+	}
+	sort.Strings(partitions)
+
+	return partitions
+}
+
+// tablespaces returns the tablespaces clause of the discard and import statements of a table
+func (downloadInfo *downloadInfoStruct) tablespaces() string {
+	if downloadInfo.partitioned {
+		return "partition all tablespace"
+	}
+
+	return "tablespace"
+}
+
+// localPartition returns the partition and extension part of a local file name, partition names are lower case on targets storing lower case files
+func localPartition(extension string, lower bool) string {
+	if lower && strings.HasPrefix(extension, "#") {
+		ext := filepath.Ext(extension)
+		return strings.ToLower(strings.TrimSuffix(extension, ext)) + ext
+	}
+
+	return extension
+}
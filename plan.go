@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+// planStruct is a versioned restore plan. Each phase runs its restores in parallel as separate client processes, then its hooks in order. A failed restore or hook stops the plan.
+//
+//	flags:
+//	  triteServer: server1
+//	  user: restore
+//	targets:
+//	  cluster2: "restore:secret@tcp(cluster2-db1:3306)/"
+//	phases:
+//	  - name: core
+//	    restore:
+//	      - schemas: accounts
+//	  - name: tenants
+//	    restore:
+//	      - schemas: tenant_a
+//	      - schemas: tenant_b
+//	        excludeTables: "tmp_*"
+//	        target: cluster2
+//	    hooks:
+//	      - ./notify.sh tenants
+type planStruct struct {
+	Flags   map[string]string `yaml:"flags"`
+	Targets map[string]string `yaml:"targets"`
+	Phases  []planPhaseStruct `yaml:"phases"`
+}
+
+// planPhaseStruct is one phase of a restore plan, each restore is a set of client flags and optionally the name of a target whose DSN it restores to
+type planPhaseStruct struct {
+	Name    string              `yaml:"name"`
+	Restore []map[string]string `yaml:"restore"`
+	Hooks   []string            `yaml:"hooks"`
+}
+
+// planConnectionFlags are the flags a target DSN replaces, restores to a target do not inherit them from the plan or the command line
+var planConnectionFlags = []string{"host", "port", "socket", "user", "pass", "passFile", "dsn", "credSource", "credPath"}
+
+// loadPlan reads a YAML restore plan and checks every flag it sets exists
+func loadPlan(file string, f *flag.FlagSet) (planStruct, error) {
+	var plan planStruct
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return plan, err
+	}
+
+	err = yaml.UnmarshalStrict(b, &plan)
+	if err != nil {
+		return plan, fmt.Errorf("Unable to parse restore plan %s - %s", file, err)
+	}
+
+	check := func(flags map[string]string) error {
+		for name, value := range flags {
+			if name == "target" {
+				if _, ok := plan.Targets[value]; !ok {
+					return fmt.Errorf("Restore plan %s uses undefined target %s", file, value)
+				}
+				continue
+			}
+			if f.Lookup(name) == nil || name == "plan" {
+				return fmt.Errorf("Restore plan %s sets unknown flag %s", file, name)
+			}
+		}
+		return nil
+	}
+
+	for name, dsn := range plan.Targets {
+		_, err = mysql.ParseDSN(dsn)
+		if err != nil {
+			return plan, fmt.Errorf("Restore plan %s target %s - %s", file, name, err)
+		}
+	}
+
+	err = check(plan.Flags)
+	if err != nil {
+		return plan, err
+	}
+	for i, phase := range plan.Phases {
+		if phase.Name == "" {
+			plan.Phases[i].Name = "phase" + strconv.Itoa(i+1)
+		}
+		for _, restore := range phase.Restore {
+			err = check(restore)
+			if err != nil {
+				return plan, err
+			}
+			if target, ok := restore["target"]; ok {
+				for _, name := range planConnectionFlags {
+					if _, ok := restore[name]; ok {
+						return plan, fmt.Errorf("Restore plan %s sets %s on a restore to target %s, set it in the targets DSN", file, name, target)
+					}
+				}
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// startPlan runs a restore plan. Flags set on the command line apply to every restore after the plans flags. The exit code of the first failed phase is returned.
+func startPlan(file string, f *flag.FlagSet) int {
+	plan, err := loadPlan(file, f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	base := make(map[string]string)
+	for name, value := range plan.Flags {
+		base[name] = value
+	}
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name != "plan" {
+			base[fl.Name] = fl.Value.String()
+		}
+	})
+
+	// Client processes run without stdin so they cannot prompt, a password any restore would prompt for is read once before the plan starts
+	var prompted *string
+	for _, phase := range plan.Phases {
+		for i, restore := range phase.Restore {
+			_, flags, toTarget := planStepFlags(plan, base, phase, i, restore)
+			if !toTarget && planNeedsPassword(flags) {
+				pwd, err := readPassword()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Unable to read the password -", err)
+					return 1
+				}
+				prompted = &pwd
+				break
+			}
+		}
+		if prompted != nil {
+			break
+		}
+	}
+
+	for _, phase := range plan.Phases {
+		fmt.Println("Starting phase", phase.Name)
+
+		var wg sync.WaitGroup
+		codes := make([]int, len(phase.Restore))
+		names := make([]string, len(phase.Restore))
+		for i, restore := range phase.Restore {
+			name, flags, toTarget := planStepFlags(plan, base, phase, i, restore)
+			if prompted != nil && !toTarget && planNeedsPassword(flags) {
+				flags["pass"] = *prompted
+			}
+
+			names[i] = name
+			wg.Add(1)
+			go func(i int, name string, flags map[string]string, toTarget bool) {
+				defer wg.Done()
+				codes[i] = runPlanStep(name, flags, toTarget)
+			}(i, name, flags, toTarget)
+		}
+		wg.Wait()
+
+		for i, code := range codes {
+			if code != 0 {
+				fmt.Fprintln(os.Stderr, "Restore", names[i], "exited with code", code, "- stopping the plan")
+				return code
+			}
+		}
+
+		for _, hook := range phase.Hooks {
+			fmt.Println("Running hook:", hook)
+			cmd := exec.Command("sh", "-c", hook)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			cmd.Env = append(os.Environ(), "TRITE_PLAN_PHASE="+phase.Name)
+			err = cmd.Run()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Hook", hook, "failed -", err, "- stopping the plan")
+				return 1
+			}
+		}
+	}
+
+	fmt.Println("Restore plan", file, "completed")
+
+	return 0
+}
+
+// planStepFlags returns the name of a restore in a plan phase and the flags its client process runs with, and whether it restores to a target
+func planStepFlags(plan planStruct, base map[string]string, phase planPhaseStruct, i int, restore map[string]string) (string, map[string]string, bool) {
+	// Explicit connection flags take precedence over a DSN, so a target must not inherit them
+	_, toTarget := restore["target"]
+	flags := make(map[string]string)
+	for name, value := range base {
+		flags[name] = value
+	}
+	if toTarget {
+		for _, name := range planConnectionFlags {
+			delete(flags, name)
+		}
+	}
+	for name, value := range restore {
+		flags[name] = value
+	}
+
+	// Parallel restores keep separate journals and print plain lines
+	name := phase.Name + "-" + strconv.Itoa(i+1)
+	if _, ok := flags["journal"]; !ok {
+		flags["journal"] = "trite." + name + ".journal.gz"
+	}
+	flags["noTTY"] = "true"
+	flags["client"] = "true"
+
+	// Restores to another cluster use the targets DSN
+	if target, ok := flags["target"]; ok {
+		flags["dsn"] = plan.Targets[target]
+		delete(flags, "target")
+		name += "@" + target
+	}
+
+	return name, flags, toTarget
+}
+
+// planNeedsPassword returns true when a client process started with flags would prompt for the MySQL password. Restores to a target only use its DSN.
+func planNeedsPassword(flags map[string]string) bool {
+	if pass := flags["pass"]; pass != "" && pass != "-" {
+		return false
+	}
+	if flags["passFile"] != "" || flags["credSource"] != "" {
+		return false
+	}
+	if dsn, ok := flags["dsn"]; ok {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err == nil && cfg.Passwd != "" {
+			return false
+		}
+	}
+
+	return os.Getenv("MYSQL_PWD") == ""
+}
+
+// runPlanStep runs one restore as a child trite process, prefixing its output with the step name. A restore to a target does not see the connection settings of the environment either.
+func runPlanStep(name string, flags map[string]string, toTarget bool) int {
+	// The child must not run the plan again and the password is kept off its command line
+	skip := []string{envFlagName("plan") + "="}
+	if toTarget {
+		skip = append(skip, "MYSQL_PWD=")
+		for _, flagName := range planConnectionFlags {
+			skip = append(skip, envFlagName(flagName)+"=")
+		}
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		inherit := true
+		for _, prefix := range skip {
+			if strings.HasPrefix(kv, prefix) {
+				inherit = false
+			}
+		}
+		if inherit {
+			env = append(env, kv)
+		}
+	}
+	if pass, ok := flags["pass"]; ok {
+		env = append(env, "MYSQL_PWD="+pass)
+		delete(flags, "pass")
+	}
+	if dsn, ok := flags["dsn"]; ok {
+		env = append(env, envFlagName("dsn")+"="+dsn)
+		delete(flags, "dsn")
+	}
+
+	var names []string
+	for flagName := range flags {
+		names = append(names, flagName)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, flagName := range names {
+		args = append(args, "-"+flagName+"="+flags[flagName])
+	}
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = env
+	stdout, err := cmd.StdoutPipe()
+	checkErr(err)
+	stderr, err := cmd.StderrPipe()
+	checkErr(err)
+
+	err = cmd.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, name+":", err)
+		return 1
+	}
+
+	var wg sync.WaitGroup
+	prefix := func(r io.Reader, w io.Writer) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			fmt.Fprintln(w, name+": "+scanner.Text())
+		}
+	}
+	wg.Add(2)
+	go prefix(stdout, os.Stdout)
+	go prefix(stderr, os.Stderr)
+	wg.Wait()
+
+	err = cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanNeedsPassword(t *testing.T) {
+	defer os.Setenv("MYSQL_PWD", os.Getenv("MYSQL_PWD"))
+	os.Unsetenv("MYSQL_PWD")
+
+	tests := []struct {
+		name     string
+		flags    map[string]string
+		expected bool
+	}{
+		{"no password", map[string]string{"user": "restore"}, true},
+		{"password from stdin", map[string]string{"pass": "-"}, true},
+		{"password given", map[string]string{"pass": "secret"}, false},
+		{"password file", map[string]string{"passFile": "/etc/trite.pass"}, false},
+		{"credential source", map[string]string{"credSource": "mylogin"}, false},
+		{"dsn with password", map[string]string{"dsn": "restore:secret@tcp(db1:3306)/"}, false},
+		{"dsn without password", map[string]string{"dsn": "restore@tcp(db1:3306)/"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := planNeedsPassword(tt.flags); got != tt.expected {
+			t.Errorf("%s: planNeedsPassword = %t, expected %t", tt.name, got, tt.expected)
+		}
+	}
+
+	os.Setenv("MYSQL_PWD", "secret")
+	if planNeedsPassword(map[string]string{"user": "restore"}) {
+		t.Errorf("planNeedsPassword with MYSQL_PWD set = true, expected false")
+	}
+}
+
+func TestPlanPassword(t *testing.T) {
+	defer os.Setenv("MYSQL_PWD", os.Getenv("MYSQL_PWD"))
+	os.Unsetenv("MYSQL_PWD")
+	defer os.Unsetenv(childPasswordEnv)
+	os.Setenv(childPasswordEnv, "secret")
+
+	dir, err := ioutil.TempDir("", "trite-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every restore lacks a password, it is read once and given to both phases
+	file := filepath.Join(dir, "plan.yaml")
+	plan := "flags:\n  user: restore\nphases:\n  - name: core\n    restore:\n      - schemas: accounts\n      - schemas: billing\n  - name: tenants\n    restore:\n      - schemas: tenant_a\n"
+	err = ioutil.WriteFile(file, []byte(plan), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := flag.NewFlagSet("trite", flag.ContinueOnError)
+	for _, name := range []string{"user", "pass", "schemas", "journal", "plan"} {
+		f.String(name, "", "")
+	}
+	f.Bool("noTTY", false, "")
+	f.Bool("client", false, "")
+	err = f.Parse([]string{"-plan=" + file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var code int
+	withStdin(t, "secret\n", func() {
+		code = startPlan(file, f)
+	})
+	if code != 0 {
+		t.Errorf("plan exited with code %d, expected every restore to get the password secret", code)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "syscall"
+
+const (
+	// processQueryLimitedInformation is the access right needed to read the exit code of a process
+	processQueryLimitedInformation = 0x1000
+
+	// stillActive is the exit code of a process that has not exited
+	stillActive = 259
+)
+
+// processAlive returns true if a process with the pid is running. Windows has no signal 0 so the exit code of the process is checked instead.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	err = syscall.GetExitCodeProcess(h, &code)
+
+	return err == nil && code == stillActive
+}
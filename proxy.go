@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// normalizeBasePath returns a base path with a leading slash and no trailing slash, a blank or / base path is blank
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return ""
+	}
+
+	return "/" + basePath
+}
+
+// parseTrustedProxies parses a comma separated list of addresses and CIDR networks of the reverse proxies whose forwarded headers are trusted
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var trusted []*net.IPNet
+	if list == "" {
+		return trusted, nil
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid -trustedProxies address %s", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -trustedProxies network %s - %s", entry, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return trusted, nil
+}
+
+// trustedProxy returns true if a request was received directly from one of the trusted reverse proxies
+func trustedProxy(r *http.Request, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// externalURL returns the URL clients use to reach the server. The X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix headers are only honored
+// on requests from a trusted reverse proxy, anyone else could point the URL anywhere.
+func externalURL(r *http.Request, basePath string, trusted []*net.IPNet) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !trustedProxy(r, trusted) {
+		return scheme + "://" + r.Host + basePath
+	}
+
+	if proto := strings.ToLower(forwardedValue(r, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwardedHost := forwardedValue(r, "X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+
+	// A proxy that strips the base path before forwarding says what it stripped with X-Forwarded-Prefix
+	if prefix := forwardedValue(r, "X-Forwarded-Prefix"); basePath == "" && prefix != "" {
+		basePath = normalizeBasePath(prefix)
+	}
+
+	return scheme + "://" + host + basePath
+}
+
+// forwardedValue returns the first value of a forwarded header, proxies chained in front of each other append their values
+func forwardedValue(r *http.Request, header string) string {
+	return strings.TrimSpace(strings.SplitN(r.Header.Get(header), ",", 2)[0])
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		list string
+		n    int
+		ok   bool
+	}{
+		{"", 0, true},
+		{"10.0.0.5", 1, true},
+		{"10.0.0.5, 10.1.0.0/16,::1,fd00::/8", 4, true},
+		{"proxy.example.com", 0, false},
+		{"10.0.0.0/33", 0, false},
+	}
+
+	for _, tt := range tests {
+		trusted, err := parseTrustedProxies(tt.list)
+		if tt.ok != (err == nil) {
+			t.Errorf("parseTrustedProxies(%q) = %v", tt.list, err)
+		}
+		if tt.ok && len(trusted) != tt.n {
+			t.Errorf("parseTrustedProxies(%q) returned %d networks, expected %d", tt.list, len(trusted), tt.n)
+		}
+	}
+}
+
+func TestExternalURL(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.5,10.1.0.0/16,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		host       string
+		prefix     string
+		basePath   string
+		url        string
+	}{
+		{"no headers", "10.0.0.5:40000", "", "", "", "", "http://trite:12000"},
+		{"trusted proxy", "10.0.0.5:40000", "https", "proxy.example.com", "/trite/", "", "https://proxy.example.com/trite"},
+		{"trusted network", "10.1.2.3:40000", "https", "proxy.example.com", "", "/trite", "https://proxy.example.com/trite"},
+		{"trusted ipv6", "[::1]:40000", "HTTPS", "proxy.example.com", "", "", "https://proxy.example.com"},
+		{"chained proxies", "10.0.0.5:40000", "https, http", "proxy.example.com, inner", "", "", "https://proxy.example.com"},
+		{"untrusted client", "192.168.1.9:40000", "https", "evil.example.com", "/evil", "", "http://trite:12000"},
+		{"untrusted client base path", "192.168.1.9:40000", "https", "evil.example.com", "", "/trite", "http://trite:12000/trite"},
+		{"unknown scheme", "10.0.0.5:40000", "javascript", "proxy.example.com", "", "", "http://proxy.example.com"},
+		{"prefix ignored with base path", "10.0.0.5:40000", "", "", "/other", "/trite", "http://trite:12000/trite"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://trite:12000/manifest", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for header, value := range map[string]string{"X-Forwarded-Proto": tt.proto, "X-Forwarded-Host": tt.host, "X-Forwarded-Prefix": tt.prefix} {
+			if value != "" {
+				r.Header.Set(header, value)
+			}
+		}
+
+		if url := externalURL(r, tt.basePath, trusted); url != tt.url {
+			t.Errorf("%s: externalURL = %s, expected %s", tt.name, url, tt.url)
+		}
+	}
+}
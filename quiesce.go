@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// quiescePoll is how often the backup metadata files are checked for changes
+	quiescePoll = 5 * time.Second
+
+	// quiescePeriod is how long the backup metadata must be unchanged before it is served again
+	quiescePeriod = 30 * time.Second
+)
+
+// quiesceFiles are written by xtrabackup while a backup is being prepared
+var quiesceFiles = []string{"xtrabackup_checkpoints", "xtrabackup_logfile", "ibdata1", "ib_logfile0"}
+
+// quiesceStruct tracks whether a backup directory is being modified by xtrabackup
+type quiesceStruct struct {
+	mu      sync.RWMutex
+	busy    string
+	changed time.Time
+}
+
+// watchBackup polls a backup directory for a running xtrabackup prepare or changing metadata files
+func watchBackup(backupPath string) *quiesceStruct {
+	q := &quiesceStruct{}
+
+	var last string
+	check := func() {
+		sig := metadataSignature(backupPath)
+		if last != "" && sig != last {
+			q.changed = time.Now()
+		}
+		last = sig
+
+		var busy string
+		if pid := xtrabackupPrepare(backupPath); pid != "" {
+			busy = "xtrabackup (pid " + pid + ") is preparing the backup"
+		} else if time.Since(q.changed) < quiescePeriod {
+			busy = "the backup metadata changed at " + q.changed.Format(time.RFC3339) + ", waiting for it to be unchanged for " + quiescePeriod.String()
+		}
+
+		q.mu.Lock()
+		if busy != q.busy {
+			if busy != "" {
+				fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "WARNING: Not serving backup files,", busy)
+			} else {
+				fmt.Println(time.Now().Format(time.RFC3339), "The backup is unchanged, serving backup files")
+			}
+		}
+		q.busy = busy
+		q.mu.Unlock()
+	}
+
+	// The metadata file times are the best hint of a recent change at startup
+	q.changed = latestModTime(backupPath)
+	check()
+	go func() {
+		for {
+			time.Sleep(quiescePoll)
+			check()
+		}
+	}()
+
+	return q
+}
+
+// reason returns why the backup cannot be served or a blank string when it is quiescent
+func (q *quiesceStruct) reason() string {
+	if q == nil {
+		return ""
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.busy
+}
+
+// quiesceHandler returns 503 for backup requests while the backup is being modified
+func quiesceHandler(q *quiesceStruct, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := q.reason(); reason != "" {
+			http.Error(w, "The backup is being modified, "+reason, http.StatusServiceUnavailable)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// metadataSignature returns the size and mtime of the xtrabackup metadata files
+func metadataSignature(backupPath string) string {
+	var sig string
+	for _, name := range quiesceFiles {
+		if fi, err := os.Stat(filepath.Join(backupPath, name)); err == nil {
+			sig += fmt.Sprintf("%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+
+	return sig
+}
+
+// latestModTime returns the newest mtime of the xtrabackup metadata files
+func latestModTime(backupPath string) time.Time {
+	var latest time.Time
+	for _, name := range quiesceFiles {
+		if fi, err := os.Stat(filepath.Join(backupPath, name)); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest
+}
+
+// xtrabackupPrepare returns the pid of an xtrabackup or innobackupex process preparing backupPath. Processes are found through /proc so this only works on Linux.
+func xtrabackupPrepare(backupPath string) string {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return ""
+	}
+
+	target := filepath.Clean(backupPath)
+	for _, proc := range procs {
+		b, err := ioutil.ReadFile(filepath.Join("/proc", proc.Name(), "cmdline"))
+		if err != nil || len(b) == 0 {
+			continue
+		}
+
+		args := strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+		if !strings.Contains(filepath.Base(args[0]), "xtrabackup") && !strings.Contains(filepath.Base(args[0]), "innobackupex") {
+			continue
+		}
+
+		var preparing, targeted bool
+		for _, arg := range args[1:] {
+			preparing = preparing || arg == "--prepare" || arg == "--apply-log" || arg == "--export"
+			if strings.HasPrefix(arg, "--target-dir=") {
+				arg = strings.TrimPrefix(arg, "--target-dir=")
+			}
+			targeted = targeted || filepath.Clean(arg) == target
+		}
+		if preparing && targeted {
+			return proc.Name()
+		}
+	}
+
+	return ""
+}
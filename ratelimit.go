@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiterStruct is a token bucket shared by every download so -maxRate limits the total transfer rate of a restore
+type rateLimiterStruct struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// rateLimit limits the download rate, nil when -maxRate is not set
+var rateLimit *rateLimiterStruct
+
+// parseRate converts a rate such as 500K, 50M or 1G bytes per second to bytes per second
+func parseRate(s string) (int64, error) {
+	n, err := parseSize(s, 1)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("-maxRate must be a positive number of bytes per second with an optional K, M or G suffix (e.g. 50M)")
+	}
+
+	return n, nil
+}
+
+// newRateLimiter starts a token bucket filling at rate bytes per second
+func newRateLimiter(rate int64) *rateLimiterStruct {
+	return &rateLimiterStruct{rate: float64(rate), last: time.Now()}
+}
+
+// chunk returns the most bytes a single read takes, small enough that reads are spread evenly across each second
+func (l *rateLimiterStruct) chunk() int {
+	n := int(l.rate / 20)
+	if n < 1024 {
+		n = 1024
+	}
+
+	return n
+}
+
+// wait blocks until n bytes are allowed by the rate
+func (l *rateLimiterStruct) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// reader returns r limited to the download rate, r is returned as is when there is no limit
+func (l *rateLimiterStruct) reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &rateLimitedReader{reader: r, limiter: l}
+}
+
+// rateLimitedReader reads no faster than its rate limiter allows
+type rateLimitedReader struct {
+	reader  io.Reader
+	limiter *rateLimiterStruct
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if chunk := r.limiter.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := r.reader.Read(p)
+	r.limiter.wait(n)
+
+	return n, err
+}
@@ -24,6 +24,10 @@ type reader struct {
 	drawInterval time.Duration
 	drawPrefix   string
 
+	// drawAlways draws even when another table holds the display, used
+	// for line based progress where draws cannot overwrite each other.
+	drawAlways bool
+
 	progress int64
 	lastDraw time.Time
 }
@@ -74,7 +78,7 @@ func (r *reader) drawProgress() {
 	}
 
 	// Draw
-	if getDisplayTable() == strings.TrimPrefix(r.drawPrefix, "Downloading: ") {
+	if r.drawAlways || getDisplayTable() == strings.TrimPrefix(r.drawPrefix, "Downloading: ") {
 		f := r.drawFunction()
 		f(r.drawPrefix, r.progress, r.size)
 	}
@@ -86,7 +90,7 @@ func (r *reader) drawProgress() {
 func (r *reader) finishProgress() {
 	// Only output the final draw if we drawed prior
 	if !r.lastDraw.IsZero() {
-		if getDisplayTable() == strings.TrimPrefix(r.drawPrefix, "Downloading: ") {
+		if r.drawAlways || getDisplayTable() == strings.TrimPrefix(r.drawPrefix, "Downloading: ") {
 			f := r.drawFunction()
 			f(r.drawPrefix, r.progress, r.size)
 
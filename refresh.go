@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// tableFingerprintStruct identifies what a table was restored from, the checksum of its create statement and of each backup file
+type tableFingerprintStruct struct {
+	Create string            `json:"create"`
+	Files  map[string]string `json:"files"`
+}
+
+// refreshStateStruct records the fingerprint of every table restored with -changedOnly so the next refresh can skip tables that did not change
+type refreshStateStruct struct {
+	mu     sync.Mutex
+	file   string
+	Tables map[string]tableFingerprintStruct `json:"tables"`
+}
+
+// refreshState is the state of the -changedOnly refresh, nil when every table is restored
+var refreshState *refreshStateStruct
+
+// loadRefreshState reads the state file of the previous refresh, the first refresh starts with an empty state
+func loadRefreshState(file string) (*refreshStateStruct, error) {
+	s := &refreshStateStruct{file: file, Tables: make(map[string]tableFingerprintStruct)}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, s)
+	if s.Tables == nil {
+		s.Tables = make(map[string]tableFingerprintStruct)
+	}
+
+	return s, err
+}
+
+// tableFingerprint returns the checksums of the create statement and backup files of a table being downloaded. False is returned when a checksum is not available.
+func tableFingerprint(downloadInfo *downloadInfoStruct, schemaFilename string, tableFilename string) (tableFingerprintStruct, bool) {
+	fp := tableFingerprintStruct{Files: make(map[string]string)}
+
+	// The dump checksums already have the create statement checksum, older dumps have none and the statement is fetched
+	rel := downloadInfo.sourceSchema + "/tables/" + downloadInfo.sourceTable + sqlExtension
+	if sum, ok := dumpSums[rel]; ok {
+		fp.Create = sum
+	} else {
+		resp, err := httpRequest(downloadInfo.ctx, "GET", joinURL(downloadInfo.taburl, downloadInfo.sourceSchema, "tables", downloadInfo.sourceTable+sqlExtension))
+		if err != nil {
+			return fp, false
+		}
+		stmt, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != 200 {
+			return fp, false
+		}
+		sum := sha256.Sum256(stmt)
+		fp.Create = hex.EncodeToString(sum[:])
+	}
+
+	for _, extension := range downloadInfo.extensions {
+		sum := fetchSum(downloadInfo.ctx, joinURL(downloadInfo.sumsurl, schemaFilename, tableFilename+extension))
+		if sum == "" {
+			return fp, false
+		}
+		fp.Files[extension] = sum
+	}
+
+	return fp, true
+}
+
+// unchanged returns true when a table was restored from the same create statement and backup files by the previous refresh
+func (s *refreshStateStruct) unchanged(table string, fp tableFingerprintStruct) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.Tables[table]
+	if !ok || previous.Create != fp.Create || len(previous.Files) != len(fp.Files) {
+		return false
+	}
+	for extension, sum := range fp.Files {
+		if previous.Files[extension] != sum {
+			return false
+		}
+	}
+
+	return true
+}
+
+// restored records the fingerprint of a restored table, a table restored without one is restored again by the next refresh
+func (s *refreshStateStruct) restored(downloadInfo *downloadInfoStruct) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if downloadInfo.fingerprint != nil {
+		s.Tables[downloadInfo.schema+"."+downloadInfo.table] = *downloadInfo.fingerprint
+	} else {
+		delete(s.Tables, downloadInfo.schema+"."+downloadInfo.table)
+	}
+}
+
+// failed forgets a table that could not be restored, it may have been dropped so the next refresh restores it
+func (s *refreshStateStruct) failed(downloadInfo *downloadInfoStruct) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.Tables, downloadInfo.schema+"."+downloadInfo.table)
+	s.mu.Unlock()
+}
+
+// write saves the state for the next refresh
+func (s *refreshStateStruct) write() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.file, b, filePerms)
+}
+
+// tableExists returns true when the target still has the table, a table dropped since the last refresh is restored even if it did not change
+func tableExists(db *sql.DB, schema string, table string) bool {
+	var count int
+	err := db.QueryRow("select count(*) from information_schema.tables where table_schema = ? and table_name = ?", schema, table).Scan(&count)
+
+	return err == nil && count > 0
+}
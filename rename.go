@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// renameMap stores the schema.table a table is restored as by its fully qualified name on the trite server
+type renameMap map[string][2]string
+
+// createTableName matches the table name of a create table statement
+var createTableName = regexp.MustCompile("(?is)^(.*?create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?)(`(?:[^`]|``)+`|[^\\s(]+)")
+
+// createConstraintName matches the name of a foreign key or check constraint in a create table statement
+var createConstraintName = regexp.MustCompile("(?i)(\\bconstraint\\s+)(`(?:[^`]|``)+`|[^\\s`(]+)(\\s+)(foreign\\s+key|check)\\b")
+
+// loadRenameMap reads a table rename file. Each line maps a table on the trite server to the name it is restored as, blank lines and lines starting with # are ignored:
+//
+//	shop.orders=scratch.orders_prod
+//	shop.customers=shop.customers_copy
+func loadRenameMap(file string) (renameMap, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	renames := make(renameMap)
+	targets := make(map[string]string)
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Line %d of rename file %s must be in old_schema.old_table=new_schema.new_table format", n+1, file)
+		}
+		from := strings.SplitN(strings.TrimSpace(parts[0]), ".", 2)
+		to := strings.SplitN(strings.TrimSpace(parts[1]), ".", 2)
+		if len(from) != 2 || len(to) != 2 || from[0] == "" || from[1] == "" || to[0] == "" || to[1] == "" {
+			return nil, fmt.Errorf("Line %d of rename file %s must be in old_schema.old_table=new_schema.new_table format", n+1, file)
+		}
+
+		fqFrom := from[0] + "." + from[1]
+		fqTo := to[0] + "." + to[1]
+		if _, ok := renames[fqFrom]; ok {
+			return nil, fmt.Errorf("Table %s is renamed more than once in rename file %s", fqFrom, file)
+		}
+		if other, ok := targets[fqTo]; ok {
+			return nil, fmt.Errorf("Tables %s and %s are both renamed to %s in rename file %s", other, fqFrom, fqTo, file)
+		}
+		renames[fqFrom] = [2]string{to[0], to[1]}
+		targets[fqTo] = fqFrom
+	}
+
+	return renames, nil
+}
+
+// target returns the schema and table a served table is restored as
+func (renames renameMap) target(schema string, table string) (string, string) {
+	if to, ok := renames[schema+"."+table]; ok {
+		return to[0], to[1]
+	}
+
+	return schema, table
+}
+
+// renameCreate replaces the table name of a create table statement. Foreign key and check constraint names must be unique in a schema, so they are renamed
+// to <table>_ibfk_<n> and <table>_chk_<n> as MySQL names them, otherwise a copy next to the original table fails to create.
+func renameCreate(stmt string, table string) string {
+	stmt = createTableName.ReplaceAllStringFunc(stmt, func(match string) string {
+		return createTableName.FindStringSubmatch(match)[1] + addQuotes(table)
+	})
+
+	var fks, checks int
+	return createConstraintName.ReplaceAllStringFunc(stmt, func(match string) string {
+		m := createConstraintName.FindStringSubmatch(match)
+		var name string
+		if strings.HasPrefix(strings.ToLower(m[4]), "foreign") {
+			fks++
+			name = table + "_ibfk_" + strconv.Itoa(fks)
+		} else {
+			checks++
+			name = table + "_chk_" + strconv.Itoa(checks)
+		}
+
+		return m[1] + addQuotes(name) + m[3] + m[4]
+	})
+}
+
+// createRenameSchema creates a schema tables are renamed into when it does not exist yet
+func createRenameSchema(db *sql.DB, schema string) {
+	var count int
+	err := db.QueryRow("select count(*) from information_schema.schemata where schema_name = ?", schema).Scan(&count)
+	checkErr(err)
+	if count > 0 {
+		return
+	}
+
+	_, err = execSQL(db, "create database if not exists "+addQuotes(schema))
+	checkErr(err)
+	undo.createdSchema(schema)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestRenameCreate(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		table    string
+		expected string
+	}{
+		{"CREATE TABLE `orders` (`id` int)", "orders_copy", "CREATE TABLE `orders_copy` (`id` int)"},
+		{"CREATE TABLE IF NOT EXISTS orders (id int)", "orders_copy", "CREATE TABLE IF NOT EXISTS `orders_copy` (id int)"},
+		{
+			"CREATE TABLE `customers` (\n  `id` int,\n  `region` int,\n  `parent` int,\n  CONSTRAINT `fk_region` FOREIGN KEY (`region`) REFERENCES `regions` (`id`),\n  CONSTRAINT `customers_ibfk_1` FOREIGN KEY (`parent`) REFERENCES `accounts` (`id`),\n  CONSTRAINT `customers_chk_1` CHECK ((`id` > 0))\n) ENGINE=InnoDB COMMENT='no constraint renamed here'",
+			"customers_copy",
+			"CREATE TABLE `customers_copy` (\n  `id` int,\n  `region` int,\n  `parent` int,\n  CONSTRAINT `customers_copy_ibfk_1` FOREIGN KEY (`region`) REFERENCES `regions` (`id`),\n  CONSTRAINT `customers_copy_ibfk_2` FOREIGN KEY (`parent`) REFERENCES `accounts` (`id`),\n  CONSTRAINT `customers_copy_chk_1` CHECK ((`id` > 0))\n) ENGINE=InnoDB COMMENT='no constraint renamed here'",
+		},
+		{"CREATE TABLE t (a int, constraint fk foreign key (a) references p (id))", "t2", "CREATE TABLE `t2` (a int, constraint `t2_ibfk_1` foreign key (a) references p (id))"},
+		{"CREATE TABLE `t` (`a` int, CONSTRAINT `a``b` FOREIGN KEY (`a`) REFERENCES `p` (`id`))", "t2", "CREATE TABLE `t2` (`a` int, CONSTRAINT `t2_ibfk_1` FOREIGN KEY (`a`) REFERENCES `p` (`id`))"},
+	}
+
+	for _, tt := range tests {
+		if renamed := renameCreate(tt.stmt, tt.table); renamed != tt.expected {
+			t.Errorf("renameCreate(%q, %q) = %q, expected %q", tt.stmt, tt.table, renamed, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// exitPartialFailure is the exit code used when a restore finished but some tables or objects failed
+const exitPartialFailure = 2
+
+// reportStruct is a machine readable summary of a restore, written as json when -report is given
+type reportStruct struct {
+	mu         sync.Mutex
+	Server     string                `json:"server"`
+	Start      string                `json:"start"`
+	End        string                `json:"end"`
+	Tables     []tableEventStruct    `json:"tables"`
+	Objects    []reportObjectStruct  `json:"objects"`
+	Rewrites   []reportRewriteStruct `json:"rewrites"`
+	KeyIDs     []string              `json:"keyIds,omitempty"`
+	MissingCfg []string              `json:"missingCfg,omitempty"`
+	Warnings   []warningStruct       `json:"warnings,omitempty"`
+	Errors     int                   `json:"errors"`
+}
+
+// reportObjectStruct records the outcome of applying one trigger, view, procedure, function or event
+type reportObjectStruct struct {
+	Type   string `json:"type"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// reportRewriteStruct records a create statement changed by -sanitize
+type reportRewriteStruct struct {
+	Type      string   `json:"type"`
+	Schema    string   `json:"schema"`
+	Name      string   `json:"name"`
+	Removed   []string `json:"removed"`
+	Original  string   `json:"original"`
+	Rewritten string   `json:"rewritten"`
+}
+
+// report is the restore report for the current client run. A nil report discards entries.
+var report *reportStruct
+
+// newReport starts a restore report
+func newReport(server string) *reportStruct {
+	return &reportStruct{Server: server, Start: time.Now().Format(time.RFC3339)}
+}
+
+// addObject records an applied object, err is nil when the object was created
+func (r *reportStruct) addObject(objectType string, schema string, name string, err error) {
+	if r == nil {
+		return
+	}
+
+	obj := reportObjectStruct{Type: objectType, Schema: schema, Name: name, Status: "Created"}
+	if err != nil {
+		obj.Status = "ERROR"
+		obj.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.Objects = append(r.Objects, obj)
+	r.mu.Unlock()
+}
+
+// addRewrite records a sanitized create statement
+func (r *reportStruct) addRewrite(objectType string, schema string, name string, removed []string, original string, rewritten string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.Rewrites = append(r.Rewrites, reportRewriteStruct{Type: objectType, Schema: schema, Name: name, Removed: removed, Original: original, Rewritten: rewritten})
+	r.mu.Unlock()
+}
+
+// addKeyID records the id of a key backup files were decrypted with
+func (r *reportStruct) addKeyID(id string) {
+	if r == nil || id == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, known := range r.KeyIDs {
+		if known == id {
+			return
+		}
+	}
+	r.KeyIDs = append(r.KeyIDs, id)
+}
+
+// write finishes the report and saves it to file
+func (r *reportStruct) write(file string, errors int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.End = time.Now().Format(time.RFC3339)
+	r.Errors = errors
+	r.Warnings = warnings.all()
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(b, '\n'), filePerms)
+}
+
+// addMissingCfg records a schema.table imported without its .cfg metadata file
+func (r *reportStruct) addMissingCfg(table string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.MissingCfg = append(r.MissingCfg, table)
+	r.mu.Unlock()
+}
+
+// addTable records the final status of a restored table
+func (r *reportStruct) addTable(e tableEventStruct) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.Tables = append(r.Tables, e)
+	r.mu.Unlock()
+}
+
+// summary describes how many tables and objects were restored since the report was started
+func (r *reportStruct) summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tables, unchanged, skipped, objects int
+	for _, t := range r.Tables {
+		switch t.Status {
+		case statusRestored:
+			tables++
+		case statusUnchanged:
+			unchanged++
+		case statusSkipped:
+			skipped++
+		}
+	}
+	for _, o := range r.Objects {
+		if o.Status != "ERROR" {
+			objects++
+		}
+	}
+
+	var elapsed time.Duration
+	if start, err := time.Parse(time.RFC3339, r.Start); err == nil {
+		elapsed = time.Since(start).Round(time.Second)
+	}
+
+	summary := fmt.Sprintf("Restored %d of %d tables and %d of %d objects in %s", tables, len(r.Tables), objects, len(r.Objects), elapsed)
+	if unchanged > 0 {
+		summary += fmt.Sprintf(", %d unchanged tables were skipped", unchanged)
+	}
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d tables were skipped", skipped)
+	}
+
+	return summary
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartServer replaces the server process with a fresh one started with the same arguments. Cleanup functions run first since the new process does not inherit them.
+func restartServer() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	runExitFuncs()
+	err = syscall.Exec(exe, os.Args, os.Environ())
+
+	// Exec only returns on failure, after the cleanup nothing is left to serve
+	return err
+}
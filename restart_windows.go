@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+// restartServer is not supported on Windows where the server is restarted by hand to serve a newer catalog generation
+func restartServer() error {
+	return fmt.Errorf("the server cannot restart itself on Windows")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resumePartial renames the largest partial download of a file left by a stopped trite run to triteFile and returns its size.
+// Partial files of runs that are still running are left alone and other stale partials of the file are removed.
+func resumePartial(triteFile string) int64 {
+	dir, name := filepath.Split(triteFile)
+	base := strings.TrimSuffix(name, triteExtension)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var best os.FileInfo
+	var stale []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), base) || !tempSuffix(strings.TrimPrefix(file.Name(), base)) {
+			continue
+		}
+		if file.Name() != name && partialOwnerAlive(strings.TrimPrefix(file.Name(), base)) {
+			continue
+		}
+
+		if best == nil || file.Size() > best.Size() {
+			if best != nil {
+				stale = append(stale, best.Name())
+			}
+			best = file
+		} else {
+			stale = append(stale, file.Name())
+		}
+	}
+
+	for _, file := range stale {
+		removeFile(filepath.Join(dir, file))
+	}
+	if best == nil {
+		return 0
+	}
+
+	if best.Name() != name {
+		err = renameFile(filepath.Join(dir, best.Name()), triteFile)
+		if err != nil {
+			return 0
+		}
+	}
+
+	return best.Size()
+}
+
+// partialOwnerAlive reports whether the trite process named in a .trite-<pid>-<timestamp> suffix is still running, a -tmpSuffix names no process
+func partialOwnerAlive(suffix string) bool {
+	pid := tempSuffixPID(suffix)
+	if pid == 0 || pid == os.Getpid() {
+		return false
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// resumeValid reports whether a partial download written at modTime can be continued, the server file must not have changed since
+func resumeValid(head headStruct, offset int64, modTime time.Time) bool {
+	if offset <= 0 || offset >= head.size {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(head.lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.After(modTime)
+}
+
+// rangeHeader adds a Range request for the rest of a file from offset to the download conditions
+func rangeHeader(header http.Header, offset int64) http.Header {
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	return header
+}
+
+// hashPrefix adds the first n bytes of a resumed download to the checksum
+func (s *sumReader) hashPrefix(file string, n int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(s.h, f, n)
+
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumePartial(t *testing.T) {
+	defer func(ext string) { triteExtension = ext }(triteExtension)
+
+	tests := []struct {
+		name      string
+		extension string
+		files     map[string]int
+		size      int64
+		left      []string
+	}{
+		{"own partial", ".trite-1-20200101000000", map[string]int{"t.ibd.trite-1-20200101000000": 10}, 10, []string{"t.ibd.trite-1-20200101000000"}},
+		{"earlier run", ".trite-1-20200101000000", map[string]int{"t.ibd.trite-999999999-20191231000000": 20}, 20, []string{"t.ibd.trite-1-20200101000000"}},
+		{"largest partial kept", ".trite-1-20200101000000", map[string]int{"t.ibd.trite-999999998-20191231000000": 5, "t.ibd.trite-999999999-20191231000000": 30}, 30, []string{"t.ibd.trite-1-20200101000000"}},
+		{"tmpSuffix partial", ".part", map[string]int{"t.ibd.part": 40}, 40, []string{"t.ibd.part"}},
+		{"tmpSuffix after default run", ".part", map[string]int{"t.ibd.trite-999999999-20191231000000": 50}, 50, []string{"t.ibd.part"}},
+		{"other files ignored", ".part", map[string]int{"t.ibd": 60, "t.ibd.partial": 70, "t2.ibd.part": 80}, 0, []string{"t.ibd", "t.ibd.partial", "t2.ibd.part"}},
+		{"nothing to resume", ".part", map[string]int{}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "trite")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for file, size := range tt.files {
+			err = ioutil.WriteFile(filepath.Join(dir, file), make([]byte, size), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		triteExtension = tt.extension
+		if size := resumePartial(filepath.Join(dir, "t.ibd"+triteExtension)); size != tt.size {
+			t.Errorf("%s: resumePartial returned %d, expected %d", tt.name, size, tt.size)
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []string
+		for _, file := range files {
+			left = append(left, file.Name())
+		}
+		if strings.Join(left, ",") != strings.Join(tt.left, ",") {
+			t.Errorf("%s: left %v, expected %v", tt.name, left, tt.left)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
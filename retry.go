@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// retryDownload waits before the next attempt of a failed download. The wait doubles with every retry starting at -retryBackoff, false is returned once -downloadRetries retries were made.
+func retryDownload(ctx context.Context, clientConfig clientConfigStruct, retries *int, url string, err error) bool {
+	if *retries >= clientConfig.downloadRetries {
+		return false
+	}
+
+	delay := clientConfig.retryBackoff << uint(*retries)
+	*retries++
+	journal.printf("RETRY", "%s attempt %d in %s - %s", url, *retries, delay, err)
+	fmt.Fprintln(os.Stderr, "\t*", "Retrying", url, "in", delay, "-", err)
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryApply waits before a statement that failed with a lock wait timeout or deadlock is run again, using the same backoff as downloads. False is returned once -applyRetries retries were made.
+func retryApply(clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct, retries *int, query string, err error) bool {
+	if *retries >= clientConfig.applyRetries {
+		return false
+	}
+
+	delay := clientConfig.retryBackoff << uint(*retries)
+	*retries++
+	journal.printf("RETRY", "%s.%s %s attempt %d in %s - %s", downloadInfo.schema, downloadInfo.table, query, *retries, delay, err)
+	downloadInfo.publish(fmt.Sprintf("Retrying in %s after %s", delay, err), nil)
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-downloadInfo.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// rowFiltersMap stores the where clause of rows to keep by fully qualified table name
+type rowFiltersMap map[string]string
+
+var errApplyRowFilter error
+
+// loadRowFilters reads a YAML row filter file. The file maps schema.table keys to a where clause matching the rows to keep:
+//
+//	config.settings: "tenant_id = 42"
+//	config.features: "tenant_id in (0, 42)"
+func loadRowFilters(file string) (rowFiltersMap, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make(rowFiltersMap)
+	err = yaml.Unmarshal(b, &filters)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse row filter file %s - %s", file, err)
+	}
+
+	for fqTable, where := range filters {
+		if len(strings.Split(fqTable, ".")) != 2 {
+			return nil, fmt.Errorf("Row filter key %s must be in schema.table format", fqTable)
+		}
+
+		if strings.TrimSpace(where) == "" {
+			return nil, fmt.Errorf("Row filter for %s has an empty where clause", fqTable)
+		}
+	}
+
+	return filters, nil
+}
+
+// filterStatement returns a delete statement removing rows that do not match a tables filter or a blank string when the table is not filtered
+func (filters rowFiltersMap) filterStatement(schema string, table string) string {
+	where, ok := filters[schema+"."+table]
+	if !ok {
+		return ""
+	}
+
+	// Rows where the filter evaluates to NULL are removed as well
+	return "delete from " + addQuotes(table) + " where not coalesce((" + where + "), false)"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadRowFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trite-rowfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		filters  string
+		expected string
+		err      string
+	}{
+		{"filter", "config.settings: \"tenant_id = 42\"\n", "delete from `settings` where not coalesce((tenant_id = 42), false)", ""},
+		{"empty where clause", "config.settings: \" \"\n", "", "empty where clause"},
+		{"key without schema", "settings: \"tenant_id = 42\"\n", "", "schema.table format"},
+	}
+
+	for i, tt := range tests {
+		file := filepath.Join(dir, "filters"+strconv.Itoa(i)+".yaml")
+		err = ioutil.WriteFile(file, []byte(tt.filters), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filters, err := loadRowFilters(file)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, expected %s", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if stmt := filters.filterStatement("config", "settings"); stmt != tt.expected {
+			t.Errorf("%s: statement %s, expected %s", tt.name, stmt, tt.expected)
+		}
+		if stmt := filters.filterStatement("config", "features"); stmt != "" {
+			t.Errorf("%s: unfiltered table statement %s, expected none", tt.name, stmt)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sanitizeRules are the create statement rewrites selectable with -sanitize. Definer, security and algorithm clauses only appear once in a create statement so
+// only their first occurrence is removed, version comments are all removed.
+var sanitizeRules = []struct {
+	name string
+	re   *regexp.Regexp
+	all  bool
+}{
+	{"definer", regexp.MustCompile("(?i)DEFINER\\s*=\\s*(CURRENT_USER(\\(\\))?|(`[^`]*`|'[^']*'|[^\\s@]+)@(`[^`]*`|'[^']*'|\\S+))\\s*"), false},
+	{"security", regexp.MustCompile("(?i)SQL\\s+SECURITY\\s+(DEFINER|INVOKER)\\s*"), false},
+	{"algorithm", regexp.MustCompile("(?i)ALGORITHM\\s*=\\s*(UNDEFINED|MERGE|TEMPTABLE)\\s*"), false},
+	{"comments", regexp.MustCompile("(?s)/\\*![0-9]{5,6}.*?\\*/\\s*"), true},
+}
+
+// parseSanitize validates a comma separated list of sanitize rule names, all selects every rule
+func parseSanitize(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			names = names[:0]
+			for _, rule := range sanitizeRules {
+				names = append(names, rule.name)
+			}
+
+			return names, nil
+		}
+
+		var found bool
+		for _, rule := range sanitizeRules {
+			found = found || rule.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown sanitize rule %q, use definer, security, algorithm, comments or all", name)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// sanitizeStatement applies the named rewrites to a create statement and returns the new statement and the rules which changed it
+func sanitizeStatement(stmt string, names []string) (string, []string) {
+	var applied []string
+	for _, rule := range sanitizeRules {
+		var enabled bool
+		for _, name := range names {
+			enabled = enabled || name == rule.name
+		}
+		if !enabled {
+			continue
+		}
+
+		rewritten := stmt
+		if rule.all {
+			rewritten = rule.re.ReplaceAllString(stmt, "")
+		} else if loc := rule.re.FindStringIndex(stmt); loc != nil {
+			rewritten = stmt[:loc[0]] + stmt[loc[1]:]
+		}
+
+		if rewritten != stmt {
+			stmt = rewritten
+			applied = append(applied, rule.name)
+		}
+	}
+
+	return stmt, applied
+}
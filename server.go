@@ -1,114 +1,314 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"html"
+	"net"
 	"net/http"
-	_ "net/http/pprof" // http server profiling
 	"os"
+	"path/filepath"
 	"strings"
-
-	"github.com/klauspost/pgzip"
+	"time"
 )
 
+// serverConfigStruct stores the server options
+type serverConfigStruct struct {
+	tablePath   string
+	backupPath  string
+	port        string
+	generation  string
+	catalogPath string
+
+	incrementalPaths []string
+	prepareChain     bool
+	prepareDir       string
+	otlpEndpoint     string
+
+	dumpSchedule string
+	keepDumps    int
+	dumpDir      string
+	dbi          *mysqlCredentials
+	dumpFilter   tableFilterStruct
+	liveExport   bool
+
+	decryptKeyFile string
+	decryptAlgo    string
+	keySource      string
+	keyPath        string
+
+	linkFarm string
+
+	statsInterval  time.Duration
+	basePath       string
+	trustedProxies []*net.IPNet
+	listen         string
+	tlsCert        string
+	tlsKey         string
+	authToken      string
+}
+
 // startServer receives a port number and a directory path for create definitions output by trite in dump mode and another directory path with an xtrabackup processed with the --export flag
-func startServer(tablePath string, backupPath string, port string) {
+func startServer(serverConfig serverConfigStruct) {
+	tablePath := serverConfig.tablePath
+	backupPath := serverConfig.backupPath
+	port := serverConfig.port
+	basePath := normalizeBasePath(serverConfig.basePath)
+
+	addrs, err := parseListen(serverConfig.listen, port)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fatalExit(1)
+	}
+
 	// Make sure directory passed in has trailing slash
-	if strings.HasSuffix(backupPath, "/") == false {
+	if backupPath != "" && strings.HasSuffix(backupPath, "/") == false {
 		backupPath = backupPath + "/"
 	}
 
-	// Ensure the backup has been prepared for transporting with --export
-	check := verifyBackup(backupPath, false)
-	if check == false {
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, "It appears that --export has not be run on your backups!")
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr)
-		os.Exit(1)
+	// Preparing is done in place, incrementals are merged into a copy of the full backup so the backup given is left untouched
+	if backupPath != "" && serverConfig.prepareChain && len(serverConfig.incrementalPaths) > 0 {
+		prepared := filepath.Join(serverConfig.prepareDir, "backup"+time.Now().Format(stamp))
+
+		fmt.Println("Copying full backup to", prepared)
+		err := copyTree(backupPath, prepared)
+		if err != nil {
+			os.RemoveAll(prepared)
+			fmt.Fprintln(os.Stderr, "Unable to copy the full backup to -prepareDir -", err)
+			fatalExit(1)
+		}
+		defer os.RemoveAll(prepared)
+		onExit(func() { os.RemoveAll(prepared) })
+
+		backupPath = prepared + "/"
 	}
 
-	// Start HTTP server listener
-	fmt.Println()
-	fmt.Println("Starting server listening on port", port)
-	http.HandleFunc("/", rootHandler)
-	http.Handle("/tables/", http.StripPrefix("/tables/", http.FileServer(http.Dir(tablePath))))
-	http.Handle("/backups/", http.StripPrefix("/backups/", http.FileServer(http.Dir(backupPath))))
-	http.Handle("/gz/", http.StripPrefix("/gz/", gzHandler(http.FileServer(http.Dir(backupPath)))))
-	err := http.ListenAndServe(":"+port, nil)
-
-	// Check if port is already in use
-	if err != nil {
-		if err.Error() == "listen tcp :"+port+": bind: address already in use" {
-			fmt.Fprintln(os.Stderr)
-			fmt.Fprintln(os.Stderr)
-			fmt.Fprintln(os.Stderr, "ERROR: Port", port, "is already in use!")
-			fmt.Fprintln(os.Stderr)
-			fmt.Fprintln(os.Stderr)
-			os.Exit(1)
-		} else {
-			checkErr(err)
+	// Read backup chain metadata
+	var chain chainInfoStruct
+	if backupPath != "" {
+		chain = prepareBackup(serverConfig, backupPath)
+	}
+
+	// Serve a hard linked snapshot so the backup directory can be refreshed while transfers are running
+	if backupPath != "" && serverConfig.linkFarm != "" {
+		name := serverConfig.generation
+		if name == "" {
+			name = "backup" + time.Now().Format(stamp)
 		}
+		snapshot := filepath.Join(serverConfig.linkFarm, name)
+
+		fmt.Println("Linking backup snapshot:", snapshot)
+		err := linkTree(backupPath, snapshot)
+		if err != nil {
+			os.RemoveAll(snapshot)
+			fmt.Fprintln(os.Stderr, "Unable to create the hard linked snapshot, -linkFarm must be on the same filesystem as the backup -", err)
+			fatalExit(1)
+		}
+
+		// The deferred removal covers the server returning or panicking, exit functions cover signals, fatal exits and restarts
+		defer os.RemoveAll(snapshot)
+		onExit(func() { os.RemoveAll(snapshot) })
+
+		backupPath = snapshot + "/"
 	}
-}
 
-// verifyBackup traverses the backup directory and confirms there are .exp files which is proof --export was run
-func verifyBackup(dir string, flag bool) bool {
-	files, ferr := ioutil.ReadDir(dir)
-	checkErr(ferr)
-	for _, file := range files {
-		// Check if file has a .exp extension, that means --export has been performed on the backup
-		_, ext := parseFileName(file.Name())
-
-		// Recursive function call for subdirectories
-		if file.IsDir() {
-			flag := verifyBackup(dir+file.Name()+"/", flag)
-			if flag == true {
-				return flag
+	// Create statements are served from a directory that scheduled dumps can swap between restores
+	activity := &serverActivityStruct{}
+	tables := &servedDirStruct{path: tablePath}
+	if serverConfig.dumpSchedule != "" {
+		sched, err := parseCron(serverConfig.dumpSchedule)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fatalExit(1)
+		}
+
+		// Dump immediately when there isn't an existing dump to serve, otherwise verify the credentials work before scheduling
+		if tablePath == "" {
+			tablePath, err = runDump(serverConfig.dumpDir, serverConfig.dbi, serverConfig.dumpFilter)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fatalExit(1)
 			}
+			tables.set(tablePath)
 		} else {
-			if ext == "exp" {
-				flag = true
-				break
+			db, err := serverConfig.dbi.connect()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fatalExit(1)
 			}
+			db.Close()
 		}
+
+		go scheduleDumps(sched, serverConfig.dumpDir, serverConfig.dbi, serverConfig.dumpFilter, tables, serverConfig.keepDumps, activity)
+	}
+
+	// Start HTTP server listener
+	fmt.Println()
+	fmt.Println("Starting server listening on", strings.Join(addrs, ", "))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", rootHandler(basePath, serverConfig.trustedProxies))
+	// Dump only and backups only servers return 404 for the endpoints of the other, the manifest says which is served
+	if tables.get() != "" {
+		mux.Handle("/tables/", http.StripPrefix("/tables/", http.FileServer(tables)))
+	} else {
+		mux.HandleFunc("/tables/", http.NotFound)
+	}
+	if tables.get() != "" || backupPath != "" {
+		mux.HandleFunc("/manifest", manifestHandler(tables, backupPath, basePath, serverConfig.trustedProxies))
 	}
-	return flag
+	var quiesce *quiesceStruct
+	if backupPath != "" {
+		// Encrypted backup files are decrypted as they are sent when a key is given
+		var backups http.Handler = http.FileServer(http.Dir(backupPath))
+		if serverConfig.decryptKeyFile != "" || serverConfig.keySource != "" {
+			key, err := loadBackupKey(serverConfig.keySource, serverConfig.keyPath, serverConfig.decryptKeyFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fatalExit(1)
+			}
+			fmt.Println("Decrypting backup files with key", key.id)
+
+			backups = decryptHandler(backupPath, key, serverConfig.decryptAlgo, backups)
+		}
+		// Nothing is served from a backup that xtrabackup is still preparing
+		quiesce = watchBackup(backupPath)
+		backups = quiesceHandler(quiesce, backups)
+		handleBackups(mux, backupPath, etagHandler(backupPath, serverConfig.generation, backups))
+	} else {
+		for _, endpoint := range []string{"/backups/", "/sizes", "/sums/"} {
+			mux.HandleFunc(endpoint, http.NotFound)
+		}
+		for _, endpoint := range compressEndpoints {
+			mux.HandleFunc("/"+endpoint+"/", http.NotFound)
+		}
+	}
+	mux.HandleFunc("/generation", generationHandler(serverConfig.generation))
+	mux.HandleFunc("/chain", chainHandler(chain))
+
+	mux.HandleFunc("/healthz", healthzHandler)
+
+	// Export tables directly from the source database
+	var exportDB *sql.DB
+	if serverConfig.liveExport {
+		db, err := serverConfig.dbi.connect()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fatalExit(1)
+		}
+
+		var ignore, datadir string
+		err = db.QueryRow("show variables like 'datadir'").Scan(&ignore, &datadir)
+		checkErr(err)
+
+		mux.Handle("/export/", http.StripPrefix("/export/", exportHandler(db, datadir)))
+		exportDB = db
+	}
+	mux.HandleFunc("/readyz", readyzHandler(tables, backupPath, exportDB, quiesce))
+
+	// Bytes served, endpoint latencies and disk reads are logged every -statsInterval and returned by /status
+	stats := newServerStats()
+	mux.HandleFunc("/status", statusHandler(stats, serverConfig.statsInterval <= 0))
+	if serverConfig.statsInterval > 0 {
+		go stats.logStats(serverConfig.statsInterval)
+	}
+
+	// Requests are only wrapped in spans when tracing is enabled
+	var handler http.Handler = authHandler(serverConfig.authToken, statsHandler(stats, mux))
+
+	// Newer catalog generations and scheduled dumps are only served between restores
+	handler = activityHandler(activity, handler)
+	if serverConfig.catalogPath != "" {
+		go watchCatalog(serverConfig.catalogPath, serverConfig.generation, activity)
+	}
+
+	// Behind a reverse proxy that does not strip the location prefix every endpoint is served under -basePath
+	if basePath != "" {
+		fmt.Println("Serving under base path", basePath)
+		handler = http.StripPrefix(basePath, handler)
+	}
+	if serverConfig.otlpEndpoint != "" {
+		handler = traceHandler(handler)
+	}
+
+	// Addresses already in use are reported by serveAll
+	if serverConfig.tlsCert != "" {
+		fmt.Println("Serving HTTPS with certificate", serverConfig.tlsCert)
+	}
+	err = serveAll(addrs, handler, serverConfig.tlsCert, serverConfig.tlsKey)
+	checkErr(err)
 }
 
-// rootHandler is a convenience landing page with links to the dump & backup files
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintln(w, `
+// prepareBackup reads the backup chain metadata, merging incrementals first when requested, and ensures the backup has been prepared for transporting
+func prepareBackup(serverConfig serverConfigStruct, backupPath string) chainInfoStruct {
+	// Read backup chain metadata, incrementals are merged first when requested
+	chain, err := loadChain(backupPath, serverConfig.incrementalPaths, serverConfig.prepareChain)
+	if err != nil {
+		if len(serverConfig.incrementalPaths) > 0 {
+			fmt.Fprintln(os.Stderr, err)
+			fatalExit(1)
+		}
+
+		// Single backups are served even if the xtrabackup metadata is unusable
+		fmt.Fprintln(os.Stderr, "WARNING:", err)
+	}
+	if chain.BackupTime != "" {
+		fmt.Println("Backup time:", chain.BackupTime)
+	}
+
+	// Run the verify mode checks, problems are warnings as long as the backup has been prepared for transporting with --export
+	check, err := checkBackup(backupPath)
+	checkErr(err)
+	for _, problem := range check.problems {
+		fmt.Fprintln(os.Stderr, "WARNING:", problem)
+	}
+	if check.exported == false {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "It appears that --export has not be run on your backups!")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr)
+		fatalExit(1)
+	}
+
+	return chain
+}
+
+// rootHandler is a convenience landing page with links to the dump & backup files as they are reached through any reverse proxy
+func rootHandler(basePath string, trustedProxies []*net.IPNet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := html.EscapeString(externalURL(r, basePath, trustedProxies))
+		fmt.Fprintln(w, `
 	<html>
 		<head>
 			<title>TRITE</title>
 		</head>
 		<body>
-			<a href="/tables">tables</a>
+			<a href="`+base+`/tables/">tables</a>
 			<br>
-			<a href="/backups">backups</a>
+			<a href="`+base+`/backups/">backups</a>
 		</body>
 	</html>
 	`)
+	}
 }
 
-type gzResponseWriter struct {
-	http.ResponseWriter
-	io.Writer
+// generationHandler returns the id of the catalog generation being served, the body is blank when not serving from a catalog
+func generationHandler(generation string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, generation)
+	}
 }
 
-func (w gzResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
-}
+// handleBackups registers the endpoints serving the files of a backup, raw and compressed with each -compress codec, with their sizes and checksums.
+// Files are hashed while they are sent to clients verifying them.
+func handleBackups(mux *http.ServeMux, backupPath string, backups http.Handler) {
+	sums := newSumCache()
+	backups = sums.hashHandler(backupPath, backups)
 
-func gzHandler(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Encoding", "identity")
-		gz, err := pgzip.NewWriterLevel(w, pgzip.BestCompression)
-		checkErr(err)
-		defer gz.Close()
-		h.ServeHTTP(gzResponseWriter{ResponseWriter: w, Writer: gz}, r)
-	})
+	mux.Handle("/backups/", http.StripPrefix("/backups/", backups))
+	for codec, endpoint := range compressEndpoints {
+		mux.Handle("/"+endpoint+"/", http.StripPrefix("/"+endpoint+"/", compressHandler(codec, backups)))
+	}
+	mux.HandleFunc("/sizes", sizesHandler(backupPath))
+	mux.Handle("/sums/", http.StripPrefix("/sums/", sumsHandler(backupPath, sums)))
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverStatsStruct samples bytes served, per endpoint latencies and disk reads of a trite server
+type serverStatsStruct struct {
+	mu        sync.Mutex
+	start     time.Time
+	bytes     int64
+	endpoints map[string]*endpointStatsStruct
+
+	// Rates calculated at the last sample, diskPerSec is -1 when disk stats are unavailable
+	sampled      time.Time
+	sampledBytes int64
+	sampledDisk  int64
+	sampleSecs   float64
+	bytesPerSec  float64
+	diskPerSec   float64
+}
+
+// endpointStatsStruct accumulates the requests handled by one registered endpoint
+type endpointStatsStruct struct {
+	requests int64
+	errors   int64
+	bytes    int64
+	latency  time.Duration
+	max      time.Duration
+}
+
+// serverStatusStruct is the json document returned by /status
+type serverStatusStruct struct {
+	Uptime             string                          `json:"uptime"`
+	BytesServed        int64                           `json:"bytesServed"`
+	MBPerSec           float64                         `json:"mbPerSec"`
+	DiskReadMBPerSec   *float64                        `json:"diskReadMbPerSec,omitempty"`
+	Endpoints          map[string]endpointStatusStruct `json:"endpoints"`
+	SampledAt          string                          `json:"sampledAt"`
+	SampleIntervalSecs float64                         `json:"sampleIntervalSecs"`
+}
+
+// endpointStatusStruct is the summary of one endpoint in /status
+type endpointStatusStruct struct {
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	Bytes        int64   `json:"bytes"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	MaxLatencyMs float64 `json:"maxLatencyMs"`
+}
+
+// newServerStats starts collecting server stats
+func newServerStats() *serverStatsStruct {
+	now := time.Now()
+	disk, _ := diskReadBytes()
+	return &serverStatsStruct{start: now, sampled: now, sampledDisk: disk, endpoints: make(map[string]*endpointStatsStruct)}
+}
+
+// statsResponseWriter counts the bytes and records the status code written by a handler
+type statsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statsResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statsResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the underlying writers sendfile optimization when serving files
+func (w *statsResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// statsHandler records bytes and latency of each request against the mux pattern that handled it, so unknown paths do not create new endpoints
+func statsHandler(stats *serverStatsStruct, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "/"
+		}
+
+		start := time.Now()
+		sw := &statsResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r)
+		stats.add(pattern, sw.status, sw.bytes, time.Since(start))
+	})
+}
+
+// add records a finished request
+func (s *serverStatsStruct) add(pattern string, status int, bytes int64, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.endpoints[pattern]
+	if e == nil {
+		e = &endpointStatsStruct{}
+		s.endpoints[pattern] = e
+	}
+	e.requests++
+	if status >= http.StatusInternalServerError {
+		e.errors++
+	}
+	e.bytes += bytes
+	e.latency += latency
+	if latency > e.max {
+		e.max = latency
+	}
+	s.bytes += bytes
+}
+
+// sample calculates the served and disk read rates since the previous sample
+func (s *serverStatsStruct) sample() {
+	disk, diskErr := diskReadBytes()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	secs := now.Sub(s.sampled).Seconds()
+	if secs <= 0 {
+		return
+	}
+
+	s.bytesPerSec = float64(s.bytes-s.sampledBytes) / secs
+	s.diskPerSec = -1
+	if diskErr == nil {
+		s.diskPerSec = float64(disk-s.sampledDisk) / secs
+	}
+
+	s.sampleSecs = secs
+	s.sampled = now
+	s.sampledBytes = s.bytes
+	s.sampledDisk = disk
+}
+
+// logStats samples the server stats every interval and prints a line when anything was served
+func (s *serverStatsStruct) logStats(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.mu.Lock()
+		served := s.bytes - s.sampledBytes
+		s.mu.Unlock()
+
+		s.sample()
+		if served == 0 {
+			continue
+		}
+
+		s.mu.Lock()
+		line := fmt.Sprintf("Serving %.1f MB/s", s.bytesPerSec/1048576)
+		if s.diskPerSec >= 0 {
+			line += fmt.Sprintf(", disk read %.1f MB/s", s.diskPerSec/1048576)
+		}
+		var patterns []string
+		for pattern := range s.endpoints {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			e := s.endpoints[pattern]
+			line += fmt.Sprintf(", %s %d requests avg %s", pattern, e.requests, (e.latency / time.Duration(e.requests)).Round(time.Millisecond))
+		}
+		s.mu.Unlock()
+
+		fmt.Println(time.Now().Format("2006-01-02 15:04:05"), line)
+	}
+}
+
+// status returns a snapshot of the server stats
+func (s *serverStatsStruct) status() serverStatusStruct {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := serverStatusStruct{
+		Uptime:             time.Since(s.start).Round(time.Second).String(),
+		BytesServed:        s.bytes,
+		MBPerSec:           s.bytesPerSec / 1048576,
+		Endpoints:          make(map[string]endpointStatusStruct),
+		SampledAt:          s.sampled.Format(time.RFC3339),
+		SampleIntervalSecs: s.sampleSecs,
+	}
+	if s.diskPerSec >= 0 && s.sampleSecs > 0 {
+		disk := s.diskPerSec / 1048576
+		status.DiskReadMBPerSec = &disk
+	}
+
+	for pattern, e := range s.endpoints {
+		status.Endpoints[pattern] = endpointStatusStruct{
+			Requests:     e.requests,
+			Errors:       e.errors,
+			Bytes:        e.bytes,
+			AvgLatencyMs: float64(e.latency) / float64(e.requests) / float64(time.Millisecond),
+			MaxLatencyMs: float64(e.max) / float64(time.Millisecond),
+		}
+	}
+
+	return status
+}
+
+// statusHandler returns the server stats as json. Without periodic sampling the rates cover the time since the previous /status request.
+func statusHandler(stats *serverStatsStruct, sampleOnRequest bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sampleOnRequest {
+			stats.sample()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(stats.status())
+	}
+}
+
+// diskReadBytes returns the bytes this process has caused to be read from storage, page cache hits are not included. Only available on Linux.
+func diskReadBytes() (int64, error) {
+	b, err := ioutil.ReadFile("/proc/self/io")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "read_bytes:") {
+			return strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "read_bytes:")), 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("read_bytes not found in /proc/self/io")
+}
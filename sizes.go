@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// sizesStruct is the size of a backup in bytes by schema and table
+type sizesStruct struct {
+	Total   int64                        `json:"total"`
+	Schemas map[string]*schemaSizeStruct `json:"schemas"`
+}
+
+// schemaSizeStruct is the size of one schema in bytes with the size of each of its tables
+type schemaSizeStruct struct {
+	Total  int64            `json:"total"`
+	Tables map[string]int64 `json:"tables"`
+}
+
+// backupSizes walks a backup and totals table file sizes. Files in the backup root are xtrabackup and system tablespace files and are not counted.
+func backupSizes(backupPath string) (sizesStruct, error) {
+	sizes := sizesStruct{Schemas: make(map[string]*schemaSizeStruct)}
+
+	err := filepath.Walk(backupPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(backupPath, file)
+		if err != nil {
+			return err
+		}
+		dir, name := filepath.Split(rel)
+		if dir == "" {
+			return nil
+		}
+
+		// Partitions are stored as table#P#partition files
+		schema := mysqlUTF8.DecodeFilename(strings.TrimSuffix(dir, string(filepath.Separator)))
+		table, _ := parseFileName(strings.TrimSuffix(name, xbcryptExtension))
+		table = mysqlUTF8.DecodeFilename(strings.SplitN(table, "#", 2)[0])
+
+		if sizes.Schemas[schema] == nil {
+			sizes.Schemas[schema] = &schemaSizeStruct{Tables: make(map[string]int64)}
+		}
+		sizes.Schemas[schema].Tables[table] += info.Size()
+		sizes.Schemas[schema].Total += info.Size()
+		sizes.Total += info.Size()
+
+		return nil
+	})
+
+	return sizes, err
+}
+
+// sizesHandler serves the backup sizes as json. The backup does not change while it is served so sizes are only calculated once.
+func sizesHandler(backupPath string) http.HandlerFunc {
+	var once sync.Once
+	var sizes sizesStruct
+	var err error
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { sizes, err = backupSizes(backupPath) })
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sizes)
+	}
+}
+
+// printRestorePlan displays how much data will be transferred for each schema being restored. Older servers do not provide sizes and nothing is shown.
+func printRestorePlan(sizes sizesStruct, schemas []string, schemaTables map[string][]string) {
+	sorted := append([]string(nil), schemas...)
+	sort.Strings(sorted)
+
+	var total int64
+	var count int
+	fmt.Println("Restore plan:")
+	for _, schema := range sorted {
+		var schemaTotal int64
+		if schemaSize := sizes.Schemas[schema]; schemaSize != nil {
+			for _, table := range schemaTables[schema] {
+				table, _ = parseFileName(table)
+				schemaTotal += schemaSize.Tables[table]
+			}
+		}
+
+		fmt.Printf("    %s: %d tables, %s\n", schema, len(schemaTables[schema]), formatSize(schemaTotal))
+		total += schemaTotal
+		count += len(schemaTables[schema])
+	}
+	fmt.Printf("    Total: %d tables, %s\n", count, formatSize(total))
+	fmt.Println()
+}
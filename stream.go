@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshuaprunier/mysqlUTF8"
+)
+
+// streamExtensions are the table files included in a table stream when the server has them
+var streamExtensions = []string{".ibd", ".cfg", ".exp", ".frm", ".MYD", ".MYI"}
+
+// streamTable writes a tar stream of a table's create statement and backup files to w instead of importing it, so trite can feed other tooling without intermediate files
+func streamTable(clientConfig clientConfigStruct, fqTable string, w io.Writer) error {
+	names := strings.SplitN(fqTable, ".", 2)
+	if len(names) != 2 {
+		return fmt.Errorf("%s must be in schema.table format", fqTable)
+	}
+	schema, table := names[0], names[1]
+
+	schemaFilename := schema
+	if mysqlUTF8.NeedsEncoding(schema) {
+		schemaFilename = mysqlUTF8.EncodeFilename(schema)
+	}
+	tableFilename := table
+	if mysqlUTF8.NeedsEncoding(table) {
+		tableFilename = mysqlUTF8.EncodeFilename(table)
+	}
+
+	files := []struct{ url, name string }{{clientConfig.serverURL("tables", schema, "tables", table+sqlExtension), tableFilename + sqlExtension}}
+	for _, ext := range streamExtensions {
+		files = append(files, struct{ url, name string }{clientConfig.serverURL("backups", schemaFilename, tableFilename+ext), tableFilename + ext})
+	}
+
+	tw := tar.NewWriter(w)
+	var count int
+	for _, file := range files {
+		resp, err := httpGet(file.url)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			continue
+		}
+
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: mysqlPerms, Size: resp.ContentLength, ModTime: time.Now()})
+		if err == nil {
+			_, err = io.Copy(tw, resp.Body)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(os.Stderr, "Streamed:", file.name, resp.ContentLength, "bytes")
+		count++
+	}
+
+	// Only the create statement was found
+	if count < 2 {
+		return fmt.Errorf("No backup files were found for %s", fqTable)
+	}
+
+	return tw.Close()
+}
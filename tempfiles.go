@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runID identifies the temporary files of one trite process so restores to different instances on a shared host do not collide
+var runID = strconv.Itoa(os.Getpid()) + "-" + time.Now().Format(stamp)
+
+// triteExtension is appended to files while they are downloaded into the MySQL datadir
+var triteExtension = ".trite-" + runID
+
+// runSuffixPattern matches the default run ID based suffix of downloaded files, .trite-<pid>-<timestamp>
+var runSuffixPattern = regexp.MustCompile(`^\.trite-([0-9]+)-[0-9]{14}$`)
+
+// tempFiles are the temporary files this run created which have not been renamed or removed yet
+var tempFiles = struct {
+	sync.Mutex
+	paths       map[string]bool
+	downloading map[string]bool
+}{paths: make(map[string]bool), downloading: make(map[string]bool)}
+
+// keepPartials leaves files that were still downloading when trite stopped so a later run with -resume can continue them
+var keepPartials bool
+
+// tempCleanup registers cleanTempFiles to run when trite is stopped with a signal once per process
+var tempCleanup sync.Once
+
+// setTempSuffix replaces the run ID based suffix of downloaded files
+func setTempSuffix(suffix string) error {
+	if !strings.HasPrefix(suffix, ".") || len(suffix) < 2 || strings.ContainsAny(suffix, "/\x00") {
+		return fmt.Errorf("-tmpSuffix must start with a dot and cannot contain a slash")
+	}
+	triteExtension = suffix
+
+	return nil
+}
+
+// tempSuffix reports whether suffix marks a download into the datadir, either the suffix of this run or the run ID based suffix of an earlier run
+func tempSuffix(suffix string) bool {
+	return suffix == triteExtension || runSuffixPattern.MatchString(suffix)
+}
+
+// tempSuffixPID returns the process ID named in a run ID based suffix, a -tmpSuffix names no process and returns 0
+func tempSuffixPID(suffix string) int {
+	m := runSuffixPattern.FindStringSubmatch(suffix)
+	if m == nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
+
+// trackTempFile records a temporary file owned by this run
+func trackTempFile(path string) {
+	tempFiles.Lock()
+	tempFiles.paths[path] = true
+	tempFiles.Unlock()
+}
+
+// releaseTempFile stops tracking a temporary file which was renamed or removed
+func releaseTempFile(path string) {
+	tempFiles.Lock()
+	delete(tempFiles.paths, path)
+	delete(tempFiles.downloading, path)
+	tempFiles.Unlock()
+}
+
+// downloadingTempFile records whether a temporary file is a download in progress
+func downloadingTempFile(path string, downloading bool) {
+	tempFiles.Lock()
+	if downloading {
+		tempFiles.downloading[path] = true
+	} else {
+		delete(tempFiles.downloading, path)
+	}
+	tempFiles.Unlock()
+}
+
+// cleanTempFiles removes every temporary file still owned by this run
+func cleanTempFiles() {
+	tempFiles.Lock()
+	var paths []string
+	for path := range tempFiles.paths {
+		if keepPartials && tempFiles.downloading[path] {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	tempFiles.Unlock()
+
+	for _, path := range paths {
+		removeFile(path)
+	}
+}
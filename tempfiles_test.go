@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestTempSuffix(t *testing.T) {
+	defer func(ext string) { triteExtension = ext }(triteExtension)
+
+	tests := []struct {
+		extension string
+		suffix    string
+		temp      bool
+		pid       int
+	}{
+		{".trite-1-20200101000000", ".trite-1-20200101000000", true, 1},
+		{".trite-1-20200101000000", ".trite-4242-20240102030405", true, 4242},
+		{".trite-1-20200101000000", ".trite", false, 0},
+		{".trite-1-20200101000000", ".trite-x-20200101000000", false, 0},
+		{".trite-1-20200101000000", ".trite-1-2020", false, 0},
+		{".part", ".part", true, 0},
+		{".part", ".partial", false, 0},
+		{".part", ".trite-17-20240102030405", true, 17},
+		{".trite-17-20240102030405", ".trite-17-20240102030405", true, 17},
+	}
+
+	for _, tt := range tests {
+		triteExtension = tt.extension
+		if temp := tempSuffix(tt.suffix); temp != tt.temp {
+			t.Errorf("tempSuffix(%q) with %q = %t, expected %t", tt.suffix, tt.extension, temp, tt.temp)
+		}
+		if pid := tempSuffixPID(tt.suffix); pid != tt.pid {
+			t.Errorf("tempSuffixPID(%q) = %d, expected %d", tt.suffix, pid, tt.pid)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// serverScheme is the scheme of trite server URLs given as a host name or ip, -triteServer URLs keep their own scheme
+var serverScheme = "http"
+
+// setupClientTLS sets the scheme trite servers are reached with and adds the -caCert certificates to the system roots server certificates are verified against
+func setupClientTLS(scheme string, caCert string) error {
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("-triteServerScheme must be http or https")
+	}
+	serverScheme = scheme
+
+	if caCert == "" {
+		return nil
+	}
+
+	pem, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return fmt.Errorf("Unable to read -caCert - %s", err)
+	}
+
+	// A private CA is trusted in addition to the system roots so a mirror with a public certificate still verifies
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("No PEM certificates found in -caCert %s", caCert)
+	}
+
+	// Every trite server request goes through the default transport
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	return nil
+}
@@ -5,14 +5,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/user"
-	"runtime"
 	"runtime/pprof"
-	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
-// ShowUsage prints a help screen which details all three modes command line flags
+// ShowUsage prints a help screen which details all modes command line flags
 func showUsage() {
 	fmt.Println(`
   Usage of trite:
@@ -23,39 +23,212 @@ func showUsage() {
 
     -client: Runs a trite client that downloads and applies database objects from a trite server
     -user: MySQL user name
-    -pass: MySQL password (If omitted the user is prompted)
+    -pass: MySQL password (If omitted MYSQL_PWD is used or the user is prompted, use - to read it from stdin)
+    -passFile: File containing the MySQL password
     -host: MySQL server hostname or ip
     -socket: MySQL socket file (socket is preferred over tcp if provided along with host)
     -port: MySQL server port (default 3306)
     -tls: Use TLS, also enables cleartext passwords (default false)
-    -triteServer: Server name or ip of the trite server
+    -serverPubKey: PEM file with the MySQL server RSA public key for caching_sha2_password authentication without TLS
+    -dsn: Go MySQL driver DSN (user:pass@tcp(host:3306)/?param=value), individual MySQL flags override its values and extra parameters are passed to the driver
+    -credSource: Read the MySQL password from mylogin (.mylogin.cnf), vault (VAULT_ADDR & VAULT_TOKEN) or keychain (macOS keychain or secret-tool, not on Windows), settings given by flags, -dsn, -passFile or MYSQL_PWD are kept
+    -credPath: Login path for mylogin (default client), secret path for vault or service name for keychain (default trite)
+    -triteServer: Server name or ip of the trite server, a URL with a scheme and path prefix for a server behind a reverse proxy (e.g. https://proxy.example.com/trite) which is used without -tritePort, a comma separated list of servers tried in order or a DNS SRV record name (e.g. _trite._tcp.backup.example.com)
     -tritePort: Port of trite server (default 12000)
+    -triteServerScheme: http (default) or https, the scheme of trite servers given as a host name or ip, https encrypts every transfer and verifies the server certificate
+    -caCert: PEM file of CA certificates trite server certificates are verified against in addition to the system roots, for servers with a certificate from a private CA
+    -authToken: Shared secret sent as a bearer token with every request to the trite server (default TRITE_AUTH_TOKEN)
     -triteMaxConnections: Maximum number of simultaneous database connections (default 20)
-    -errorLog: File where details of an error is written (default trite.err in current working directory)
-    -progressLimit: Limit size in GB that a file must be larger than for download progress to be displayed (default 5GB)
-    -gz: Compress xtraBackup files for downloading across slower networks (default false)
+    -downloadWorkers: Number of tables downloaded at once, more workers keep a fast network busy when restoring thousands of small tables (default 1)
+    -applyWorkers: Maximum number of tables downloaded or applied at once, download workers wait for a table to finish applying before starting another (default one per 512MB of the targets innodb_buffer_pool_size, at most -triteMaxConnections)
+    -errorLog: File where details of an error are written, each error framed by BEGIN and END lines so errors of tables failing at the same time are not mixed (default trite.err in current working directory)
+    -journal: Gzip compressed journal of every HTTP request, SQL statement and file operation (default trite.journal.gz in current working directory)
+    -report: File where a json report of the restore is written, trite exits with code 2 when some tables or objects could not be restored
+    -eventLog: File where every table status change (Downloading, Applying, Restored, Unchanged, Skipped with a reason, ERROR) is appended as a json line for log shippers
+    -metricsFile: File where counts of tables by final status, tables in progress and whether the restore is done are written in the Prometheus text format, for the node_exporter textfile collector (e.g. /var/lib/node_exporter/trite.prom)
+    -sanitize: Comma separated rewrites removing clauses that prevent triggers, views, procedures, functions & events being created: definer, security (SQL SECURITY), algorithm, comments (/*!NNNNN ... */ version comments) or all
+    -strictDDL: Only rewrite create statements that fail as written, use -strictDDL=false to always rewrite (default true)
+    -otlpEndpoint: OTLP/HTTP endpoint traces of the download & apply pipeline are exported to (e.g. http://localhost:4318)
+    -adminPort: Port for an admin listener serving pprof endpoints (default disabled)
+    -adminBind: Address the admin listener binds to (default 127.0.0.1)
+    -progressLimit: Size a file must be larger than for download progress to be displayed, with a K, M, G or T suffix (e.g. 500M) or in GB without one, which may be fractional (e.g. 0.5) (default 5G)
+    -progressInterval: How often download progress is drawn (default 1s on a terminal, 30s with -noTTY, 1s for -output=json)
+    -noTTY: Print status and progress as timestamped lines, automatic when output is not a terminal
+    -changedOnly: Only restore tables whose create statement or backup files changed since the last -changedOnly refresh, or that were dropped from the target since (default false)
+    -refreshState: File recording the create statement and backup file checksums of the tables -changedOnly restored (default trite.refresh in current working directory)
+    -targetDatadir: Path where files are restored instead of the datadir reported by MySQL, for datadirs reached through a symlink or a different mount on this host (overrides -datadirMap)
+    -diskSpace: abort (default) stops before anything is changed when the tables to download are larger than the free space of the MySQL datadir, warn prints a warning and restores anyway, skip does not check
+    -quiet: Print only errors and a summary of the tables and objects restored, no status display or download progress, for nohup and systemd logs (default false)
+    -output: text (default) or json, json prints every table status change and the download progress of each file as a json line on stdout and all other output on stderr
+    -stream: Write the create statement and backup files of one schema.table to stdout as a tar stream instead of restoring, no MySQL credentials are needed (e.g. trite -client -triteServer=server1 -stream=db.t | ssh host2 tar -x)
+    -skipAnalyze: Do not run ANALYZE TABLE on imported InnoDB tables, their index statistics are collected by MySQL later (default false)
+    -analyzeAfter: Run ANALYZE TABLE on imported InnoDB tables once all tables are imported instead of while each table is write locked for its import (default false)
+    -warmBufferPool: Comma separated schema.table list of hot tables whose indexes are read into the InnoDB buffer pool after they are restored
+    -dedup: Files up to 64MB with the same checksum as a file already downloaded are copied locally instead of downloaded again, speeds up restoring many identical tables
+    -verifySums: Verify the sha256 checksum of every downloaded backup file against the server, checksums are calculated while files stream to disk so there is no second read pass (default false)
+    -resume: Keep partial downloads when a run is interrupted and continue them with HTTP range requests on the next run with -resume, instead of downloading the whole file again (default false)
+    -caseMismatch: abort (default) stops before changing anything when names contain upper case letters and the target has lower_case_table_names=1, lower restores them with lower case names
+    -allowMissingCfg: Import InnoDB tables whose .cfg file is missing on 5.6+ targets without the metadata consistency checks, the tables are listed in the report, -allowMissingCfg=false fails them instead (default true)
+    -tmpSuffix: Suffix of files while they are downloaded into the MySQL datadir, temporary files left by this run are removed when it ends or is interrupted (default .trite-<pid>-<timestamp>)
+    -fileOwner: User (name or uid) restored files are owned by (default the owner of the MySQL datadir files, then the mysql user)
+    -fileGroup: Group (name or gid) restored files are owned by (default the group of -fileOwner or of the MySQL datadir files)
+    -filePerms: Octal permissions of restored files (default 0660)
+    -datadirMap: container:host path translation of the datadir reported by a MySQL running in a container (e.g. /var/lib/mysql:/srv/mysql-data), detected from the docker container mount with the server_uuid of the instance when the datadir does not exist on the host
+    -dataDirectories: Comma separated directories outside the datadir that tables created with DATA DIRECTORY may be restored to, as MySQL sees them, with mysql:host pairs for directories at another path on this host (e.g. /data/fast or /mnt/fast:/srv/fast)
+    -logicalSourceDsn: Go MySQL driver DSN of the source database for targets whose datadir cannot be written (managed MySQL such as RDS), tables are created from the servers create statements and their rows copied over SQL, much slower than transporting tablespaces
+    -preflight: Run the connection, version, datadir and server checks then exit without restoring
+    -plan: YAML restore plan of phases, the restores of a phase run in parallel as separate client processes followed by its hooks, flags on the command line apply to every restore (see Restore Plans)
+    -assess: Read only report of the tables a restore would drop on the target with their estimated rows, sizes, sessions using them and foreign keys or views depending on them, nothing is changed
+    -blockingTimeout: How long to wait for other sessions holding metadata locks or running statements on a table before it is skipped instead of dropped, 0 disables the check (default 1m)
+    -killBlocking: Kill sessions holding a metadata lock on a table about to be replaced instead of waiting for them, requires performance_schema and never kills server or replication threads, -blockingTimeout still applies (default false)
+    -mdlTimeout: How long dropping, discarding, locking or importing a table waits for a metadata lock before the table is skipped, the lock holders are shown while waiting and logged on timeout (default 1m)
+    -k8sStatusConfigMap: Kubernetes ConfigMap the restore status and report are written to using the pods service account
+    -compress: Codec xtraBackup files are compressed with for downloading across slower networks: gzip (maximum compression, slowest), zstd, s2 (fastest, least compression) or none (default none)
+    -gz: Same as -compress=gzip (default false)
+    -gzBlocks: Number of 1MB blocks decompressed ahead in parallel when downloading with -compress=gzip (default 16)
+    -copyBuffer: Size in KB of the pooled buffers files are downloaded through (default 1024)
+    -maxRate: Maximum total download rate in bytes per second with an optional K, M or G suffix (e.g. 50M) so restores across a WAN or into a busy host do not saturate the link (default unlimited)
+    -downloadRetries: Number of times a download that fails or is short is retried before the table is marked as errored, continuing with a range request when possible (default 3)
+    -applyRetries: Number of times a DROP, RENAME, DISCARD, LOCK or IMPORT statement failing with a lock wait timeout or deadlock is retried before the table is marked as errored (default 3)
+    -retryBackoff: Wait before the first download or apply retry, doubled for every further retry (default 1s)
+    -gogc: Garbage collector target percentage like GOGC, higher values trade memory for less GC work during fast transfers, -1 disables the garbage collector (default GOGC or 100)
+    -cpus: Comma separated CPUs and CPU ranges trite is pinned to, such as the CPUs of the NUMA node of the network card (e.g. 0-15), Linux only
+    -schemas, -excludeSchemas, -tables, -excludeTables: Only download and apply the selected schemas and tables, see DUMP MODE for the syntax
+    -liveTables: Comma separated schema.table list restored from a server running with -liveExport instead of the servers dump & backup
+    -watch: Poll a trite server serving a catalog and restore each new generation as it appears (default false)
+    -watchInterval: How often the server generation is checked in watch mode (default 5m)
+    -watchState: File recording the last generation restored in watch mode (default trite.generation in current working directory)
+    -maskRules: YAML file of schema.table column masking functions (null, blank, hash, email, fixed:<value>) applied to restored tables
+    -rowFilters: YAML file of schema.table where clauses, rows not matching are deleted after the table is imported
+    -renameTables: File of old_schema.old_table=new_schema.new_table lines, listed tables are restored under the new name (e.g. a scratch copy alongside the live table)
+    -keepOld: Rename tables that already exist to <table>_old instead of dropping them, a table whose <table>_old already exists is not restored (default false)
+    -undoDir: Directory where a <schema>.undo.sql script is appended to as each table is restored, dropping the restored tables that did not exist, renaming the -keepOld tables back and dropping schemas the restore created
+    -failOnWarn: Exit with code 3 when a warning of this level or above was printed: info (e.g. definer stripped, tables not analyzed), warn (e.g. analyze failed, missing .cfg, low disk space) or error (e.g. report or undo scripts not written), tables that failed exit with code 2 first (default never)
 
     DUMP MODE
     =========
     EXAMPLE: trite -dump -user=myuser -pass=secret -port=3306 -host=prod-db1 -dumpDir=/tmp
 
-    -dump: Dumps create statements for tables & objects (prodecures, functions, triggers, views) from a local or remote MySQL database
+    -dump: Dumps create statements for tables & objects (prodecures, functions, triggers, views, events) from a local or remote MySQL database
     -user: MySQL user name
-    -pass: MySQL password (If omitted the user is prompted)
+    -pass: MySQL password (If omitted MYSQL_PWD is used or the user is prompted, use - to read it from stdin)
+    -passFile: File containing the MySQL password
     -host: MySQL server hostname or ip
     -socket: MySQL socket file (socket is preferred over tcp if provided along with host)
     -port: MySQL server port (default 3306)
     -tls: Use TLS, also enables cleartext passwords (default false)
+    -serverPubKey: PEM file with the MySQL server RSA public key for caching_sha2_password authentication without TLS
+    -dsn: Go MySQL driver DSN (user:pass@tcp(host:3306)/?param=value), individual MySQL flags override its values and extra parameters are passed to the driver
+    -credSource: Read the MySQL password from mylogin (.mylogin.cnf), vault (VAULT_ADDR & VAULT_TOKEN) or keychain (macOS keychain or secret-tool, not on Windows), settings given by flags, -dsn, -passFile or MYSQL_PWD are kept
+    -credPath: Login path for mylogin (default client), secret path for vault or service name for keychain (default trite)
     -dumpDir: Directory where dump files will be written (default current working directory)
+    -schemas: Comma separated schemas to include, globs (e.g. sales_*) and re: prefixed regular expressions (e.g. re:^tenant[0-9]+$) are accepted
+    -excludeSchemas: Comma separated schemas to exclude, same syntax as -schemas
+    -tables: Comma separated tables to include, globs containing a dot match schema.table (e.g. sales.orders_*) otherwise the table name, regular expressions may start with ^ instead of re: (e.g. ^tmp_)
+    -excludeTables: Comma separated tables to exclude, same syntax as -tables
+    -resume: Continue an interrupted dump, -dumpDir is the dump directory it was writing instead of the directory dumps are created in, objects whose files were completely written are not dumped again (default false)
+    -deterministic: Dump to a <host>_dump subdirectory without a time stamp, the previous dump there is replaced once the new dump is complete, so dumps can be committed to version control and diffed (default false)
+    -previousDump: Earlier dump directory, the schemas, tables and stored objects added, dropped or altered since it are printed when the dump completes, with the changed lines of altered create statements
+    -gitCommit: Commit each dump to a git repository in -dumpDir, initialized when -dumpDir is not already in one, with a message naming the host and time (implies -deterministic, default false)
+    -stripAutoIncrement: Remove the AUTO_INCREMENT counter from dumped create table statements so tables receiving inserts do not change between dumps (default false)
+    -output: Progress format, text (default) prints a line per schema and the estimated time left, json prints a json line for every dumped object with done, total and etaSeconds counts
+    -failOnWarn: Exit with code 3 when a warning of this level or above was printed: info, warn (e.g. -previousDump could not be compared, no schemas matched the filters) or error (default never)
 
     SERVER MODE
     ===========
     EXAMPLE: trite -server -dumpPath=/tmp/trite_dump20130824_173000 -backupPath=/tmp/xtrabackup_location
 
     -server: Runs a HTTP server allowing a trite client to download xtrabackup and database object dump files
-    -dumpPath: Path to create statement dump files
+    -dumpPath: Path to create statement dump files, omit to serve only backup files
+    -backupPath: Path to xtraBackup files, omit to serve only the structure dump
+    -tritePort: Port of trite server (default 12000)
+    -listen: Comma separated addresses to listen on instead of every interface, addresses without a port use -tritePort, [::] alone also accepts IPv4 connections and listed with other addresses only IPv6 ones (e.g. [::]:12000,10.0.0.5:12000)
+    -tlsCert: PEM certificate file, with -tlsKey the server serves HTTPS and clients connect with -triteServerScheme=https
+    -tlsKey: PEM private key file of -tlsCert
+    -authToken: Shared secret clients must send as a bearer token, requests without it are rejected except /healthz and /readyz (default TRITE_AUTH_TOKEN)
+    -catalogPath: Path to a catalog of backup generations, the newest generation is served instead of -dumpPath & -backupPath
+    -incrementalPaths: Comma separated incremental backups in apply order, -backupPath is the full backup they are applied to
+    -prepareChain: Merge the incrementals into a copy of the full backup made in -prepareDir and export it with xtrabackup before serving (default false, the chain must already be merged)
+    -prepareDir: Directory the full backup is copied to and prepared in with -prepareChain, the copy is served and removed when the server stops
+    -otlpEndpoint: OTLP/HTTP endpoint traces of server requests are exported to (e.g. http://localhost:4318)
+    -adminPort: Port for an admin listener serving pprof endpoints (default disabled)
+    -adminBind: Address the admin listener binds to (default 127.0.0.1)
+    -dumpSchedule: Cron expression (minute hour day-of-month month day-of-week) to run dump mode from the server, the newest dump is served and -dumpPath is optional
+    -decryptKeyFile: Key file for backups encrypted with xtrabackup --encrypt or xbcrypt after preparing, files are decrypted with xbcrypt as they are sent
+    -decryptAlgo: Encryption algorithm of the backup files: AES128, AES192 or AES256 (default AES256)
+    -keySource: Read the backup key from vault (VAULT_ADDR & VAULT_TOKEN, key and optional key_id fields) or kms (AWS KMS encrypted data key decrypted with the aws cli) instead of -decryptKeyFile
+    -keyPath: Secret path for vault or encrypted data key file for kms
+    -linkFarm: Directory on the backup filesystem where a hard linked snapshot of the backup is created per serving generation and served, so the backup directory can be refreshed in place during transfers (removed when the server stops)
+    -basePath: Path prefix every endpoint is served under for a reverse proxy that forwards the location unchanged (e.g. /trite/), clients use -triteServer=https://proxy/trite
+    -trustedProxies: Comma separated addresses or CIDR networks of reverse proxies whose X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix headers are used for the landing page and /manifest url (default none, the headers are ignored)
+    -statsInterval: How often bytes/sec served, disk read throughput and per endpoint request latencies are sampled and logged, also returned as json by /status (default 1m, 0 disables logging)
+    -liveExport: Serve InnoDB tables directly from the running source database with FLUSH TABLES ... FOR EXPORT, -dumpPath & -backupPath are optional (MySQL 5.6+, run on the source database server)
+    -dumpDir: Directory where scheduled dump files will be written (default current working directory)
+    -keepDumps: Number of scheduled dumps kept in -dumpDir, older ones are removed once a new dump is served, 0 keeps every dump (default 7)
+    -user, -pass, -host, -socket, -port, -tls: MySQL connection for scheduled dumps
+    -schemas, -excludeSchemas, -tables, -excludeTables: Filter scheduled dumps
+
+    MIGRATE MODE
+    ============
+    EXAMPLE: trite -migrate -sourceDsn="myuser:secret@tcp(prod-db1:3306)/" -targetDsn="myuser:secret@unix(/var/lib/mysql/mysql.sock)/" -backupPath=/tmp/xtrabackup_location
+
+    -migrate: Dumps the source database, serves the dump and backup locally and restores them to the target database in one process
+    -sourceDsn: Go MySQL driver DSN of the database to dump create statements from
+    -targetDsn: Go MySQL driver DSN of the database to restore to, trite must run on the target database server
+    -backupPath: Path to xtraBackup files of the source database
+    -tritePort: Port the local trite server listens on (default 12000)
+    -schemas, -excludeSchemas, -tables, -excludeTables: Filter what is migrated
+    Client mode flags such as -errorLog, -maskRules and -rowFilters are also accepted
+
+    SERVE WITH DUMP MODE
+    ====================
+    EXAMPLE: trite -serveWithDump -user=myuser -pass=secret -host=prod-db1 -backupPath=/tmp/xtrabackup_location
+
+    -serveWithDump: Dumps create statements from the source database into a temporary directory and serves them with the backup files in one step
+    -user, -pass, -host, -socket, -port, -tls: MySQL connection of the source database
     -backupPath: Path to xtraBackup files
     -tritePort: Port of trite server (default 12000)
+    -schemas, -excludeSchemas, -tables, -excludeTables: Filter the dump
+
+    LIST MODE
+    =========
+    EXAMPLE: trite -list -triteServer=server1
+
+    -list: Prints the schemas, tables, engines and sizes a trite server can restore as tab separated lines
+    -triteServer: Server name or ip of the trite server, a URL with a scheme and path prefix for a server behind a reverse proxy (e.g. https://proxy.example.com/trite) which is used without -tritePort, a comma separated list of servers tried in order or a DNS SRV record name (e.g. _trite._tcp.backup.example.com)
+    -tritePort: Port of trite server (default 12000)
+    -triteServerScheme: http (default) or https, the scheme of trite servers given as a host name or ip, https encrypts every transfer and verifies the server certificate
+    -caCert: PEM file of CA certificates trite server certificates are verified against in addition to the system roots, for servers with a certificate from a private CA
+    -authToken: Shared secret sent as a bearer token with every request to the trite server (default TRITE_AUTH_TOKEN)
+    -output: text (default) with sizes in KiB, MiB, GiB or TiB, or json with sizes in bytes
+    -schemas, -excludeSchemas, -tables, -excludeTables: Filter the tables listed
+
+    PRUNE MODE
+    ==========
+    EXAMPLE: trite -prune -catalogPath=/backups -keepLast=4 -keepDays=30
+
+    -prune: Removes catalog generations outside of the retention policy, the newest generation and generations being served are always kept
+    -catalogPath: Path to a catalog of backup generations
+    -keepLast: Number of newest generations to keep
+    -keepDays: Keep generations younger than this many days
+
+    VERIFY MODE
+    ===========
+    EXAMPLE: trite -verifyBackup -backupPath=/tmp/xtrabackup_location -dumpPath=/tmp/trite_dump20130824_173000
+
+    -verifyBackup: Checks a backup is prepared and every table has the files needed for transport without starting a server
+    -backupPath: Path to xtraBackup files
+    -dumpPath: Path to a dump whose files are checked against its checksums.sha256 (optional)
+
+    KUBERNETES
+    ==========
+    EXAMPLE: trite -k8sManifest -user=myuser -host=mysql -triteServer=server1 -k8sStatusConfigMap=trite-status
+
+    -k8sManifest: Prints a Job manifest running the client with the client flags given, a preflight init container checks the restore can start
+    -k8sImage: Container image with trite as the entrypoint (default trite)
+    -k8sDatadirClaim: PersistentVolumeClaim holding the MySQL datadir (default mysql-data)
+    -k8sDatadir: Path the MySQL datadir is mounted at (default /var/lib/mysql)
+    -k8sSecret: Secret containing the MySQL password in the password key (default trite-mysql)
   `)
 }
 
@@ -75,22 +248,89 @@ func main() {
 	// Profiling flags
 	var cpuprofile = f.String("cpuprofile", "", "write cpu profile to file")
 	var memprofile = f.String("memprofile", "", "write memory profile to this file")
+	flagAdminPort := f.String("adminPort", "", "Port for the admin listener serving pprof endpoints")
+	flagAdminBind := f.String("adminBind", "127.0.0.1", "Address the admin listener binds to")
 
 	// MySQL flags
 	flagDbUser := f.String("user", "", "MySQL username")
 	flagDbPass := f.String("pass", "", "MySQL password")
+	flagDbPassFile := f.String("passFile", "", "File containing the MySQL password")
 	flagDbHost := f.String("host", "", "MySQL host")
 	flagDbPort := f.String("port", "3306", "MySQL port")
 	flagDbSock := f.String("socket", "", "MySQL socket")
 	flagDbTLS := f.Bool("tls", false, "Enable TLS & cleartext passwords")
+	flagDbPubKey := f.String("serverPubKey", "", "MySQL server RSA public key file")
+	flagDbDSN := f.String("dsn", "", "MySQL DSN, merged with the individual MySQL flags")
+	flagCredSource := f.String("credSource", "", "Credential store for the MySQL password (mylogin, vault or keychain)")
+	flagCredPath := f.String("credPath", "", "Login path, vault secret path or keychain service name")
 
 	// Client flags
 	flagClient := f.Bool("client", false, "Run client")
 	flagTriteServer := f.String("triteServer", "", "Hostname of the trite server")
+	flagTriteServerScheme := f.String("triteServerScheme", "http", "Scheme trite servers given as a host name are reached with")
+	flagAuthToken := f.String("authToken", "", "Shared secret the server requires and the client sends as a bearer token")
+	flagCaCert := f.String("caCert", "", "PEM file of CA certificates trite server certificates are verified against")
 	flagTriteMaxConnections := f.Int("triteMaxConnections", 20, "Max concurrent trite db connections")
+	flagDownloadWorkers := f.Int("downloadWorkers", 1, "Number of tables downloaded at once")
+	flagApplyWorkers := f.Int("applyWorkers", 0, "Maximum number of tables downloaded or applied at once")
 	flagErrorLog := f.String("errorLog", wd+"/trite.err", "Error log file path")
-	flagProgressLimit := f.Int64("progressLimit", 5, "Progress will not be displayed for files smaller than progressLimit")
+	flagJournal := f.String("journal", wd+"/trite.journal.gz", "Operation journal file path")
+	flagOtlpEndpoint := f.String("otlpEndpoint", "", "OTLP/HTTP endpoint to export traces to")
+	flagProgressLimit := f.String("progressLimit", "5G", "Progress will not be displayed for files smaller than progressLimit")
+	flagProgressInterval := f.Duration("progressInterval", 0, "How often download progress is drawn")
 	flagGz := f.Bool("gz", false, "Use the servers gz endpoint to download compressed files")
+	flagCompress := f.String("compress", "none", "Codec backup files are compressed with for downloading: gzip, zstd, s2 or none")
+	flagGogc := f.Int("gogc", 0, "Garbage collector target percentage, -1 disables the garbage collector")
+	flagCPUs := f.String("cpus", "", "CPUs trite is pinned to")
+	flagGzBlocks := f.Int("gzBlocks", 16, "Blocks decompressed ahead in parallel when downloading with -gz")
+	flagCopyBuffer := f.Int("copyBuffer", 1024, "Size in KB of the pooled buffers files are downloaded through")
+	flagSanitize := f.String("sanitize", "", "Comma separated create statement rewrites for stored objects: definer, security, algorithm, comments or all")
+	flagStrictDDL := f.Bool("strictDDL", true, "Only sanitize create statements which fail as written")
+	flagReport := f.String("report", "", "File where a json restore report is written")
+	flagEventLog := f.String("eventLog", "", "File where table status events are appended as json lines")
+	flagMetricsFile := f.String("metricsFile", "", "File where restore metrics are written in the Prometheus text format")
+	flagLiveTables := f.String("liveTables", "", "Comma separated schema.table list to restore from a live export server")
+	flagStream := f.String("stream", "", "schema.table whose files are written to stdout as a tar stream instead of being restored")
+	flagWarmBufferPool := f.String("warmBufferPool", "", "Comma separated schema.table list read into the buffer pool after restoring")
+	flagDedup := f.Bool("dedup", false, "Copy identical table files locally instead of downloading them again")
+	flagVerifySums := f.Bool("verifySums", false, "Verify the checksum of each downloaded backup file")
+	flagResume := f.Bool("resume", false, "Continue partial downloads left by an interrupted run")
+	flagCaseMismatch := f.String("caseMismatch", "abort", "Handling of upper case names when the target has lower_case_table_names=1: abort or lower")
+	flagFileOwner := f.String("fileOwner", "", "User restored files are owned by")
+	flagFileGroup := f.String("fileGroup", "", "Group restored files are owned by")
+	flagFilePerms := f.String("filePerms", "0660", "Octal permissions of restored files")
+	flagLogicalSourceDsn := f.String("logicalSourceDsn", "", "DSN of the source database rows are copied from when the datadir cannot be written")
+	flagDatadirMap := f.String("datadirMap", "", "container:host translation of the MySQL datadir path")
+	flagDataDirectories := f.String("dataDirectories", "", "Comma separated directories tables may be restored to with DATA DIRECTORY, mysql:host pairs translate the path")
+	flagTmpSuffix := f.String("tmpSuffix", "", "Suffix of files while they are downloaded into the datadir")
+	flagAllowMissingCfg := f.Bool("allowMissingCfg", true, "Import InnoDB tables without their .cfg file, false fails them")
+	flagBlockingTimeout := f.Duration("blockingTimeout", time.Minute, "How long to wait for other sessions to stop using a table before skipping it")
+	flagMdlTimeout := f.Duration("mdlTimeout", time.Minute, "lock_wait_timeout for the statements replacing a table")
+	flagKillBlocking := f.Bool("killBlocking", false, "Kill sessions using a table about to be replaced")
+	flagPlan := f.String("plan", "", "YAML restore plan of phases of parallel client restores and hooks")
+	flagAssess := f.Bool("assess", false, "Report what a restore would replace on the target without changing it")
+	flagPreflight := f.Bool("preflight", false, "Run the client checks and exit without restoring")
+	flagK8sStatusConfigMap := f.String("k8sStatusConfigMap", "", "Kubernetes ConfigMap the restore status is written to")
+	flagNoTTY := f.Bool("noTTY", false, "Print progress as plain lines")
+	flagQuiet := f.Bool("quiet", false, "Only print a summary and errors")
+	flagSkipAnalyze := f.Bool("skipAnalyze", false, "Do not analyze InnoDB tables after they are imported")
+	flagAnalyzeAfter := f.Bool("analyzeAfter", false, "Analyze InnoDB tables after all tables are imported")
+	flagChangedOnly := f.Bool("changedOnly", false, "Only restore tables changed since the last -changedOnly refresh")
+	flagRefreshState := f.String("refreshState", wd+"/trite.refresh", "File recording what -changedOnly restored")
+	flagTargetDatadir := f.String("targetDatadir", "", "Path of the MySQL datadir used instead of the datadir variable")
+	flagDiskSpace := f.String("diskSpace", "abort", "abort, warn or skip when the restore does not fit in the datadir")
+	flagWatch := f.Bool("watch", false, "Restore new catalog generations as they appear")
+	flagWatchInterval := f.Duration("watchInterval", 5*time.Minute, "How often the server generation is checked in watch mode")
+	flagWatchState := f.String("watchState", wd+"/trite.generation", "File recording the last generation restored in watch mode")
+	flagMaskRules := f.String("maskRules", "", "YAML file of column masking rules")
+	flagRowFilters := f.String("rowFilters", "", "YAML file of table row filters")
+	flagRenameTables := f.String("renameTables", "", "File of old_schema.old_table=new_schema.new_table renames")
+	flagDownloadRetries := f.Int("downloadRetries", 3, "Number of times a failed download is retried")
+	flagApplyRetries := f.Int("applyRetries", 3, "Number of times a statement failing with a lock wait timeout or deadlock is retried")
+	flagRetryBackoff := f.Duration("retryBackoff", time.Second, "Wait before the first download or apply retry, doubled for every retry")
+	flagMaxRate := f.String("maxRate", "", "Maximum download rate in bytes per second with an optional K, M or G suffix")
+	flagKeepOld := f.Bool("keepOld", false, "Rename existing tables to <table>_old instead of dropping them")
+	flagUndoDir := f.String("undoDir", "", "Directory where a per schema undo script is written")
 
 	// Dump flags
 	flagDump := f.Bool("dump", false, "Run dump")
@@ -98,15 +338,76 @@ func main() {
 
 	// Server flags
 	flagServer := f.Bool("server", false, "Run server")
+	flagServeWithDump := f.Bool("serveWithDump", false, "Dump the source database to a temporary directory and serve it with the backup")
 	flagDumpPath := f.String("dumpPath", "", "Path to create statement dump files")
 	flagBackupPath := f.String("backupPath", "", "Path to database backup files")
 	flagTritePort := f.String("tritePort", "12000", "Trite server port number")
+	flagCatalogPath := f.String("catalogPath", "", "Path to a catalog of backup generations")
+	flagIncrementalPaths := f.String("incrementalPaths", "", "Comma separated incremental backup paths in apply order")
+	flagPrepareChain := f.Bool("prepareChain", false, "Merge incrementals into a copy of the full backup before serving")
+	flagPrepareDir := f.String("prepareDir", "", "Directory the full backup is copied to and prepared in with -prepareChain")
+	flagDecryptKeyFile := f.String("decryptKeyFile", "", "Key file used to decrypt xbcrypt encrypted backup files")
+	flagDecryptAlgo := f.String("decryptAlgo", "AES256", "Encryption algorithm of the backup files")
+	flagKeySource := f.String("keySource", "", "Key management service holding the backup key (vault or kms)")
+	flagKeyPath := f.String("keyPath", "", "Vault secret path or KMS encrypted data key file")
+	flagLinkFarm := f.String("linkFarm", "", "Directory a hard linked snapshot of the backup is served from")
+	flagListen := f.String("listen", "", "Comma separated addresses the server listens on")
+	flagTLSCert := f.String("tlsCert", "", "PEM certificate file the server serves HTTPS with")
+	flagTLSKey := f.String("tlsKey", "", "PEM private key file of -tlsCert")
+	flagBasePath := f.String("basePath", "", "Path prefix every server endpoint is served under")
+	flagTrustedProxies := f.String("trustedProxies", "", "Comma separated reverse proxy addresses or networks whose X-Forwarded headers are trusted")
+	flagStatsInterval := f.Duration("statsInterval", time.Minute, "How often server throughput and latency stats are sampled and logged")
+	flagLiveExport := f.Bool("liveExport", false, "Export tables from the running source database")
+	flagDumpSchedule := f.String("dumpSchedule", "", "Cron expression for running dumps from the server")
+	flagKeepDumps := f.Int("keepDumps", 7, "Number of scheduled dumps kept in -dumpDir")
+
+	// Migrate flags
+	flagMigrate := f.Bool("migrate", false, "Dump, serve and restore in one process")
+	flagSourceDsn := f.String("sourceDsn", "", "DSN of the database to migrate from")
+	flagTargetDsn := f.String("targetDsn", "", "DSN of the database to migrate to")
+
+	// Filter flags
+	flagSchemas := f.String("schemas", "", "Comma separated schema globs or re: regular expressions to include")
+	flagExcludeSchemas := f.String("excludeSchemas", "", "Comma separated schema globs or re: regular expressions to exclude")
+	flagTables := f.String("tables", "", "Comma separated table globs or re: regular expressions to include")
+	flagExcludeTables := f.String("excludeTables", "", "Comma separated table globs or re: regular expressions to exclude")
+
+	// List flags
+	flagList := f.Bool("list", false, "List the schemas and tables a trite server can restore")
+	flagOutput := f.String("output", "text", "Output format: text or json")
+	flagDeterministic := f.Bool("deterministic", false, "Dump to a directory without a time stamp, replacing the previous dump")
+	flagPreviousDump := f.String("previousDump", "", "Earlier dump directory to report schema changes since")
+	flagGitCommit := f.Bool("gitCommit", false, "Commit each dump to a git repository in -dumpDir")
+	flagStripAutoIncrement := f.Bool("stripAutoIncrement", false, "Remove the AUTO_INCREMENT counter from dumped create table statements")
+	flagFailOnWarn := f.String("failOnWarn", "", "Lowest warning level that fails the run: info, warn or error")
+
+	// Prune flags
+	flagPrune := f.Bool("prune", false, "Remove old catalog generations")
+	flagKeepLast := f.Int("keepLast", 0, "Number of newest generations to keep")
+	flagKeepDays := f.Int("keepDays", 0, "Keep generations younger than this many days")
+
+	// Kubernetes flags
+	flagK8sManifest := f.Bool("k8sManifest", false, "Print a Kubernetes Job manifest running the client")
+	flagK8sImage := f.String("k8sImage", "trite", "Container image for the Job")
+	flagK8sDatadirClaim := f.String("k8sDatadirClaim", "mysql-data", "PersistentVolumeClaim of the MySQL datadir")
+	flagK8sDatadir := f.String("k8sDatadir", "/var/lib/mysql", "Path the MySQL datadir is mounted at")
+	flagK8sSecret := f.String("k8sSecret", "trite-mysql", "Secret with the MySQL password in the password key")
+
+	// Verify flags
+	flagVerifyBackup := f.Bool("verifyBackup", false, "Verify a backup without starting a server")
 
 	// Intercept -help and show usage screen
 	flagHelp := f.Bool("help", false, "Command Usage")
 
 	f.SetOutput(ioutil.Discard)
 
+	// Environment variables set flags before the command line is parsed so arguments take precedence
+	err = loadEnvFlags(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	err = f.Parse(os.Args[1:])
 	if err != nil {
 		fmt.Println(err)
@@ -114,6 +415,35 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Runtime tuning for high throughput restores
+	err = applyTuning(tuningStruct{gogc: *flagGogc, cpus: *flagCPUs, gzBlocks: *flagGzBlocks, copyBuffer: *flagCopyBuffer})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// A restore plan runs client processes for each of its phases
+	if *flagPlan != "" {
+		os.Exit(startPlan(*flagPlan, f))
+	}
+
+	// Print a Kubernetes Job manifest for the client options given
+	if *flagK8sManifest {
+		manifest, err := k8sManifest(f, k8sJobStruct{Image: *flagK8sImage, DatadirClaim: *flagK8sDatadirClaim, Datadir: *flagK8sDatadir, Secret: *flagK8sSecret})
+		checkErr(err)
+		fmt.Print(manifest)
+		os.Exit(0)
+	}
+
+	// Client and server spans are exported to -otlpEndpoint. They are flushed when main returns, fatal exits and signals flush them through the exit functions.
+	service := "trite-client"
+	if *flagServer || *flagServeWithDump {
+		service = "trite-server"
+	}
+	shutdownTracing := initTracing(*flagOtlpEndpoint, service)
+	defer shutdownTracing()
+	onExit(shutdownTracing)
+
 	// CPU Profiling
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -122,46 +452,457 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	dbi := mysqlCredentials{user: *flagDbUser, pass: *flagDbPass, host: *flagDbHost, port: *flagDbPort, sock: *flagDbSock, tls: *flagDbTLS, pubKey: *flagDbPubKey}
+
+	// Flags given on the command line or in the environment take precedence over a DSN and credential stores
+	setFlags := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+
+	// Merge a DSN with the individual MySQL flags
+	if *flagDbDSN != "" {
+		err = dbi.mergeDSN(*flagDbDSN, setFlags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// The shared secret may also come from the environment so it is not shown in the process list
+	authToken = *flagAuthToken
+	if authToken == "" {
+		authToken = os.Getenv("TRITE_AUTH_TOKEN")
+	}
+
+	err = warnings.setFailOnWarn(*flagFailOnWarn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Read the password from the environment, convenient for container secrets
+	if dbi.pass == "" && os.Getenv("MYSQL_PWD") != "" {
+		dbi.pass = os.Getenv("MYSQL_PWD")
+	}
+
+	// Read the password from a file
+	if *flagDbPassFile != "" {
+		dbi.pass, err = readPasswordFile(*flagDbPassFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// Read the password from an external credential store
+	if *flagCredSource != "" {
+		err = dbi.lookupCredentials(*flagCredSource, *flagCredPath, setFlags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// Schema and table filters are shared by every mode that accepts them
+	filter, err := parseTableFilter(*flagSchemas, *flagExcludeSchemas, *flagTables, *flagExcludeTables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Optional admin listener for runtime profiling
+	if *flagClient || *flagServer || *flagServeWithDump || *flagMigrate {
+		startAdmin(*flagAdminBind, *flagAdminPort)
+	}
+
 	// Default to localhost if no host or socket provided
-	if *flagDbSock == "" && *flagDbHost == "" {
-		*flagDbHost = "localhost"
+	if dbi.sock == "" && dbi.host == "" {
+		dbi.host = "localhost"
 	}
 
-	dbi := mysqlCredentials{user: *flagDbUser, pass: *flagDbPass, host: *flagDbHost, port: *flagDbPort, sock: *flagDbSock, tls: *flagDbTLS}
+	// clientConfig builds the client options shared by client and migrate mode
+	clientConfig := func() clientConfigStruct {
+		cliConfig := clientConfigStruct{triteServerURL: *flagTriteServer, triteServerPort: *flagTritePort, triteMaxConnections: *flagTriteMaxConnections, errorLogFile: *flagErrorLog, journalFile: *flagJournal, reportFile: *flagReport, eventLog: *flagEventLog, metricsFile: *flagMetricsFile, filter: filter}
+
+		// Encrypted transfers are verified against the system roots and -caCert
+		err = setupClientTLS(*flagTriteServerScheme, *flagCaCert)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// SRV records and server lists are resolved to the first trite server answering
+		cliConfig.triteServerURL, cliConfig.triteServerPort, err = discoverServer(cliConfig.triteServerURL, cliConfig.triteServerPort)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// A -progressLimit without a unit is in GB as it was before units were accepted
+		cliConfig.minDownloadProgressSize, err = parseSize(*flagProgressLimit, 1073741824)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-progressLimit must be a size with an optional K, M, G or T suffix (e.g. 500M) -", err)
+			os.Exit(1)
+		}
+		if *flagProgressInterval < 0 {
+			fmt.Fprintln(os.Stderr, "-progressInterval must not be negative")
+			os.Exit(1)
+		}
+		cliConfig.progressInterval = *flagProgressInterval
+
+		// -gz is the gzip codec of -compress
+		cliConfig.compress, err = parseCompress(*flagCompress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *flagGz {
+			if cliConfig.compress != "" && cliConfig.compress != "gzip" {
+				fmt.Fprintln(os.Stderr, "-gz cannot be used with -compress", cliConfig.compress)
+				os.Exit(1)
+			}
+			cliConfig.compress = "gzip"
+		}
+
+		// Carriage return based progress only works on a terminal
+		cliConfig.lineOutput = *flagNoTTY || !terminal.IsTerminal(int(os.Stdout.Fd()))
+		cliConfig.quiet = *flagQuiet
+		cliConfig.diskSpace = *flagDiskSpace
+		cliConfig.targetDatadir = *flagTargetDatadir
+		cliConfig.changedOnly = *flagChangedOnly
+		if *flagSkipAnalyze && *flagAnalyzeAfter {
+			fmt.Fprintln(os.Stderr, "-skipAnalyze and -analyzeAfter cannot be used together")
+			os.Exit(1)
+		}
+		cliConfig.skipAnalyze = *flagSkipAnalyze
+		cliConfig.analyzeAfter = *flagAnalyzeAfter
+		cliConfig.refreshStateFile = *flagRefreshState
+		if cliConfig.diskSpace != "abort" && cliConfig.diskSpace != "warn" && cliConfig.diskSpace != "skip" {
+			fmt.Fprintln(os.Stderr, "-diskSpace must be abort, warn or skip")
+			os.Exit(1)
+		}
+
+		cliConfig.sanitize, err = parseSanitize(*flagSanitize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cliConfig.strictDDL = *flagStrictDDL
+		cliConfig.preflight = *flagPreflight
+		cliConfig.dedup = *flagDedup
+		cliConfig.verifySums = *flagVerifySums
+		cliConfig.resume = *flagResume
+		cliConfig.keepOld = *flagKeepOld
+		cliConfig.downloadRetries = *flagDownloadRetries
+		cliConfig.applyRetries = *flagApplyRetries
+		cliConfig.retryBackoff = *flagRetryBackoff
+
+		// Downloads share one rate limit across every download worker
+		rateLimit = nil
+		if *flagMaxRate != "" {
+			rate, err := parseRate(*flagMaxRate)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			rateLimit = newRateLimiter(rate)
+		}
+		cliConfig.undoDir = *flagUndoDir
+
+		// Tables in flight are bounded by the targets buffer pool size unless given
+		cliConfig.downloadWorkers = *flagDownloadWorkers
+		cliConfig.applyWorkers = *flagApplyWorkers
+		if cliConfig.applyWorkers < 0 {
+			cliConfig.applyWorkers = 0
+		}
+		if cliConfig.downloadWorkers < 1 || (cliConfig.applyWorkers > 0 && cliConfig.applyWorkers < cliConfig.downloadWorkers) {
+			fmt.Fprintln(os.Stderr, "-downloadWorkers must be at least 1 and no more than -applyWorkers")
+			os.Exit(1)
+		}
+		cliConfig.allowMissingCfg = *flagAllowMissingCfg
+		cliConfig.blockingTimeout = *flagBlockingTimeout
+		cliConfig.killBlocking = *flagKillBlocking
+		cliConfig.mdlTimeout = *flagMdlTimeout
+		if cliConfig.mdlTimeout < time.Second {
+			fmt.Fprintln(os.Stderr, "-mdlTimeout must be at least 1s")
+			os.Exit(1)
+		}
+
+		if *flagLogicalSourceDsn != "" {
+			cliConfig.logicalSource = &mysqlCredentials{}
+			err = cliConfig.logicalSource.mergeDSN(*flagLogicalSourceDsn, nil)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if *flagDatadirMap != "" {
+			cliConfig.datadirMap, err = parseDatadirMap(*flagDatadirMap)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		cliConfig.dataDirectories, err = parseDataDirectories(*flagDataDirectories)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		cliConfig.filePerms, err = parseFilePerms(*flagFilePerms)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if *flagTmpSuffix != "" {
+			err = setTempSuffix(*flagTmpSuffix)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if *flagWarmBufferPool != "" {
+			cliConfig.warmTables = strings.Split(*flagWarmBufferPool, ",")
+		}
+
+		if *flagCaseMismatch != "abort" && *flagCaseMismatch != "lower" {
+			fmt.Fprintln(os.Stderr, "-caseMismatch must be abort or lower")
+			os.Exit(1)
+		}
+		cliConfig.caseMismatch = *flagCaseMismatch
+
+		if *flagLiveTables != "" {
+			cliConfig.liveTables = strings.Split(*flagLiveTables, ",")
+		}
+
+		// Load masking rules and row filters before anything is transferred
+		if *flagMaskRules != "" {
+			cliConfig.maskRules, err = loadMaskRules(*flagMaskRules)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if *flagRowFilters != "" {
+			cliConfig.rowFilters, err = loadRowFilters(*flagRowFilters)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if *flagRenameTables != "" {
+			cliConfig.renames, err = loadRenameMap(*flagRenameTables)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		return cliConfig
+	}
 
 	// Detect what functionality is being requested
-	if *flagClient {
-		if *flagTriteServer == "" || *flagDbUser == "" {
+	if *flagList {
+		if *flagTriteServer == "" || (*flagOutput != "text" && *flagOutput != "json") {
 			showUsage()
 		} else {
-			if runtime.GOOS != "windows" {
-				// Confirm mysql user exists
-				mysqlUser, err := user.Lookup("mysql")
+			err = startList(clientConfig(), *flagOutput, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	} else if *flagClient && *flagStream != "" {
+		// Streaming does not touch a database so no MySQL credentials are needed
+		if *flagTriteServer == "" {
+			showUsage()
+		} else {
+			err = streamTable(clientConfig(), *flagStream, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	} else if *flagClient {
+		if *flagTriteServer == "" || dbi.user == "" || (*flagOutput != "text" && *flagOutput != "json") {
+			showUsage()
+		} else {
+			err = lookupFileOwner(&dbi, *flagFileOwner, *flagFileGroup)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			cliConfig := clientConfig()
+
+			// Json events are the only output on stdout, everything else the restore prints goes to stderr
+			if *flagOutput == "json" && !*flagAssess {
+				cliConfig.jsonOutput = os.Stdout
+				os.Stdout = os.Stderr
+			}
+
+			if *flagAssess {
+				err = startAssess(cliConfig, &dbi, os.Stdout)
 				if err != nil {
 					fmt.Fprintln(os.Stderr, err)
 					os.Exit(1)
 				}
+			} else if *flagWatch {
+				startWatch(cliConfig, &dbi, f, *flagWatchInterval, *flagWatchState)
+			} else {
+				k8sStatus := func(status string, errCount int) {
+					if *flagK8sStatusConfigMap != "" {
+						err := reportK8sStatus(*flagK8sStatusConfigMap, status, errCount)
+						if err != nil {
+							warnf(levelWarn, "Unable to update the status ConfigMap - %s", err)
+						}
+					}
+				}
+
+				if !cliConfig.preflight {
+					k8sStatus("Running", 0)
+
+					// Fatal errors, panics and signals leave through the cleanup functions, the status would otherwise stay Running
+					onExit(func() {
+						k8sStatus("Failed", getErrCount())
+					})
+				}
+				errCount := startClient(cliConfig, &dbi)
 
-				// Get mysql uid & gid
-				dbi.uid, _ = strconv.Atoi(mysqlUser.Uid)
-				dbi.gid, _ = strconv.Atoi(mysqlUser.Gid)
+				// The exit status is set with os.Exit which skips deferred functions, spans are flushed first
+				shutdownTracing()
+				if errCount > 0 {
+					k8sStatus("PartialFailure", errCount)
+					os.Exit(exitPartialFailure)
+				}
+				if !cliConfig.preflight {
+					k8sStatus("Succeeded", 0)
+				}
+				warnings.exitOnWarnings()
 			}
+		}
+	} else if *flagMigrate {
+		if *flagSourceDsn == "" || *flagTargetDsn == "" || *flagBackupPath == "" {
+			showUsage()
+		} else {
+			var source, target mysqlCredentials
+			for _, c := range []struct {
+				dbi *mysqlCredentials
+				dsn string
+			}{{&source, *flagSourceDsn}, {&target, *flagTargetDsn}} {
+				err = c.dbi.mergeDSN(c.dsn, nil)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+			err = lookupFileOwner(&target, *flagFileOwner, *flagFileGroup)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			cliConfig := clientConfig()
+			cliConfig.triteServerURL = migrateListen
 
-			cliConfig := clientConfigStruct{triteServerURL: *flagTriteServer, triteServerPort: *flagTritePort, triteMaxConnections: *flagTriteMaxConnections, errorLogFile: *flagErrorLog, minDownloadProgressSize: *flagProgressLimit, gz: *flagGz}
+			errCount := startMigrate(cliConfig, &source, &target, *flagBackupPath)
 
-			startClient(cliConfig, &dbi)
+			// The exit status is set with os.Exit which skips deferred functions, spans are flushed first
+			shutdownTracing()
+			if errCount > 0 {
+				os.Exit(exitPartialFailure)
+			}
+			warnings.exitOnWarnings()
 		}
 	} else if *flagDump {
-		if *flagDbUser == "" {
+		if dbi.user == "" || (*flagOutput != "text" && *flagOutput != "json") {
+			showUsage()
+		} else {
+			dumpOutput = *flagOutput
+			dumpDeterministic = *flagDeterministic || *flagGitCommit
+			dumpStripAutoIncrement = *flagStripAutoIncrement
+			dumpPrevious = *flagPreviousDump
+			startDump(*flagDumpDir, &dbi, filter, *flagResume, *flagGitCommit)
+		}
+	} else if *flagServer || *flagServeWithDump {
+		srvConfig := serverConfigStruct{tablePath: *flagDumpPath, backupPath: *flagBackupPath, port: *flagTritePort, prepareChain: *flagPrepareChain, prepareDir: *flagPrepareDir, otlpEndpoint: *flagOtlpEndpoint, dumpSchedule: *flagDumpSchedule, keepDumps: *flagKeepDumps, dumpDir: *flagDumpDir, dbi: &dbi, liveExport: *flagLiveExport, decryptKeyFile: *flagDecryptKeyFile, decryptAlgo: *flagDecryptAlgo, keySource: *flagKeySource, keyPath: *flagKeyPath, dumpFilter: filter, linkFarm: *flagLinkFarm, statsInterval: *flagStatsInterval, basePath: *flagBasePath, listen: *flagListen, tlsCert: *flagTLSCert, tlsKey: *flagTLSKey, authToken: authToken}
+		if (*flagTLSCert == "") != (*flagTLSKey == "") {
+			fmt.Fprintln(os.Stderr, "-tlsCert and -tlsKey must be used together")
+			os.Exit(1)
+		}
+		srvConfig.trustedProxies, err = parseTrustedProxies(*flagTrustedProxies)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *flagPrepareChain && *flagPrepareDir == "" {
+			fmt.Fprintln(os.Stderr, "-prepareChain requires -prepareDir, the full backup is copied there and prepared so the original is not modified")
+			os.Exit(1)
+		}
+		if *flagIncrementalPaths != "" {
+			srvConfig.incrementalPaths = strings.Split(*flagIncrementalPaths, ",")
+		}
+
+		// Serve the newest generation when a catalog is used
+		if *flagCatalogPath != "" {
+			g, err := latestGeneration(*flagCatalogPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = markServing(g)
+			checkErr(err)
+
+			fmt.Println("Serving generation", g.id)
+			srvConfig.tablePath = g.dumpPath()
+			srvConfig.backupPath = g.backupPath()
+			srvConfig.generation = g.id
+			srvConfig.catalogPath = *flagCatalogPath
+		}
+
+		// Dump the source database to a temporary directory and serve it
+		if *flagServeWithDump && dbi.user != "" && srvConfig.backupPath != "" {
+			tmpDir, err := ioutil.TempDir("", "trite")
+			checkErr(err)
+
+			// The deferred removal covers the server returning or panicking, exit functions cover signals and fatal exits
+			defer os.RemoveAll(tmpDir)
+			onExit(func() { os.RemoveAll(tmpDir) })
+
+			srvConfig.tablePath, err = runDump(tmpDir, &dbi, filter)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fatalExit(1)
+			}
+		}
+
+		if srvConfig.liveExport {
+			if dbi.user == "" {
+				showUsage()
+			} else {
+				startServer(srvConfig)
+			}
+		} else if (srvConfig.tablePath == "" && srvConfig.dumpSchedule == "" && srvConfig.backupPath == "") || (srvConfig.dumpSchedule != "" && dbi.user == "") {
+			showUsage()
+		} else {
+			startServer(srvConfig)
+		}
+	} else if *flagPrune {
+		if *flagCatalogPath == "" || (*flagKeepLast <= 0 && *flagKeepDays <= 0) {
 			showUsage()
 		} else {
-			startDump(*flagDumpDir, &dbi)
+			startPrune(*flagCatalogPath, *flagKeepLast, *flagKeepDays)
 		}
-	} else if *flagServer {
-		if *flagDumpPath == "" || *flagBackupPath == "" {
+	} else if *flagVerifyBackup {
+		if *flagBackupPath == "" {
 			showUsage()
 		} else {
-			startServer(*flagDumpPath, *flagBackupPath, *flagTritePort)
+			startVerify(*flagBackupPath, *flagDumpPath)
 		}
 	} else if *flagHelp {
 		showUsage()
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/pgzip"
+)
+
+// tuningStruct holds the runtime tuning options for high throughput restores
+type tuningStruct struct {
+	gogc       int
+	cpus       string
+	gzBlocks   int
+	copyBuffer int
+}
+
+// gzBlocks is the number of blocks pgzip decompresses ahead of the reader, each block is decompressed by its own goroutine
+var gzBlocks = 16
+
+// gzBlockSize is the size of each block pgzip decompresses ahead
+const gzBlockSize = 1 << 20
+
+// copyBufferPool holds the buffers files are downloaded through so a restore of many tables does not allocate a buffer per file
+var copyBufferPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, copyBufferSize)
+	return &b
+}}
+
+// copyBufferSize is the size of the pooled download buffers
+var copyBufferSize = 1 << 20
+
+// applyTuning sets the garbage collector target, CPU affinity and download buffer sizes
+func applyTuning(t tuningStruct) error {
+	if t.gogc != 0 {
+		debug.SetGCPercent(t.gogc)
+	}
+
+	if t.gzBlocks < 1 {
+		return fmt.Errorf("-gzBlocks must be at least 1")
+	}
+	gzBlocks = t.gzBlocks
+
+	if t.copyBuffer < 4 {
+		return fmt.Errorf("-copyBuffer must be at least 4 KB")
+	}
+	copyBufferSize = t.copyBuffer * 1024
+
+	if t.cpus != "" {
+		cpus, err := parseCPUList(t.cpus)
+		if err != nil {
+			return err
+		}
+
+		err = setAffinity(cpus)
+		if err != nil {
+			return fmt.Errorf("Could not pin trite to CPUs %s - %s", t.cpus, err)
+		}
+
+		// The Go scheduler only reads the affinity mask at startup
+		runtime.GOMAXPROCS(len(cpus))
+	}
+
+	return nil
+}
+
+// parseCPUList parses a comma separated list of CPUs and CPU ranges such as 0-7,16-23 as used by taskset and numactl
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("Invalid CPU %q in -cpus", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("Invalid CPU range %q in -cpus", part)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	return cpus, nil
+}
+
+// gzipReader returns a parallel gzip reader decompressing -gzBlocks blocks ahead
+func gzipReader(r io.Reader) (io.Reader, error) {
+	return pgzip.NewReaderN(r, gzBlockSize, gzBlocks)
+}
+
+// downloadCopy copies a download to a file through a pooled buffer
+func downloadCopy(fo *os.File, r io.Reader) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+
+	// Hiding ReadFrom & WriteTo makes io.CopyBuffer use the pooled buffer instead of allocating its own
+	return io.CopyBuffer(struct{ io.Writer }{fo}, struct{ io.Reader }{r}, *buf)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// oldSuffix is appended to the name of an existing table kept with -keepOld
+const oldSuffix = "_old"
+
+// undoStruct records what a restore changed in each schema in an undo script, appended to as each change is made so a restore that stops midway still leaves a script. A nil undo records nothing.
+type undoStruct struct {
+	mu      sync.Mutex
+	dir     string
+	start   time.Time
+	schemas map[string]*undoSchemaStruct
+}
+
+// undoSchemaStruct is what a restore changed in one schema
+type undoSchemaStruct struct {
+	created  bool
+	replaced int
+	kept     int
+	dropped  int
+}
+
+// undo is the undo recorder of the current client run
+var undo *undoStruct
+
+// newUndo starts recording the changes of a restore, the undo scripts are written to dir
+func newUndo(dir string) *undoStruct {
+	return &undoStruct{dir: dir, start: time.Now(), schemas: make(map[string]*undoSchemaStruct)}
+}
+
+// file returns the undo script of a schema
+func (u *undoStruct) file(schema string) string {
+	return filepath.Join(u.dir, schema+".undo.sql")
+}
+
+// schema returns the changes recorded for a schema, its undo script is started over with a header by the first change of the run. The lock must be held.
+func (u *undoStruct) schema(name string) (*undoSchemaStruct, error) {
+	s := u.schemas[name]
+	if s != nil {
+		return s, nil
+	}
+
+	err := os.MkdirAll(u.dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("-- Undo the trite restore of %s started %s\nset session foreign_key_checks=0;\n", addQuotes(name), u.start.Format(time.RFC3339))
+	err = ioutil.WriteFile(u.file(name), []byte(header), filePerms)
+	if err != nil {
+		return nil, err
+	}
+
+	s = &undoSchemaStruct{}
+	u.schemas[name] = s
+
+	return s, nil
+}
+
+// append adds statements to the undo script of a schema and syncs it so they survive a crash. The lock must be held.
+func (u *undoStruct) append(schema string, statements string) error {
+	f, err := os.OpenFile(u.file(schema), os.O_WRONLY|os.O_APPEND, filePerms)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(statements)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// createdSchema records a schema that did not exist before the restore, everything restored into it goes with it
+func (u *undoStruct) createdSchema(schema string) error {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s, err := u.schema(schema)
+	if err != nil {
+		return err
+	}
+	s.created = true
+
+	return u.append(schema, fmt.Sprintf("drop database if exists %s;\n", addQuotes(schema)))
+}
+
+// replacedTable records a restored table. A table kept as <table>_old is dropped and renamed back by the undo script and a table that did not exist is dropped.
+// A table that was dropped cannot be brought back, the script only notes it.
+func (u *undoStruct) replacedTable(schema string, table string, existed bool, kept bool) error {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s, err := u.schema(schema)
+	if err != nil {
+		return err
+	}
+	s.replaced++
+
+	// The schema is dropped as a whole when the restore created it
+	if s.created {
+		return nil
+	}
+
+	fqTable := addQuotes(schema) + "." + addQuotes(table)
+	switch {
+	case kept:
+		s.kept++
+		return u.append(schema, fmt.Sprintf("drop table if exists %s;\nrename table %s to %s;\n", fqTable, addQuotes(schema)+"."+addQuotes(table+oldSuffix), fqTable))
+	case existed:
+		s.dropped++
+		return u.append(schema, fmt.Sprintf("-- %s was dropped by the restore and cannot be brought back, restore with -keepOld to keep it\n", fqTable))
+	}
+
+	return u.append(schema, fmt.Sprintf("drop table if exists %s;\n", fqTable))
+}
+
+// summary prints the changes made to each schema, the undo scripts are already complete
+func (u *undoStruct) summary() {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var names []string
+	for name := range u.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	for _, name := range names {
+		s := u.schemas[name]
+		summary := fmt.Sprintf("%d tables replaced, %d kept as *%s, %d dropped without a copy", s.replaced, s.kept, oldSuffix, s.dropped)
+		if s.created {
+			summary = fmt.Sprintf("created with %d tables", s.replaced)
+		}
+		fmt.Println("Schema", name+":", summary+", undo script", u.file(name))
+	}
+}
+
+// replaceTable removes the table about to be restored. With -keepOld an existing table is renamed to <table>_old instead of being dropped, a table that already has an _old table is refused since it may be a table of its own.
+func replaceTable(tx *sql.Tx, clientConfig clientConfigStruct, downloadInfo *downloadInfoStruct) error {
+	var existed, kept bool
+	if clientConfig.keepOld || undo != nil {
+		var count int
+		err := tx.QueryRow("select count(*) from information_schema.tables where table_schema = ? and table_name = ?", downloadInfo.schema, downloadInfo.table).Scan(&count)
+		if err != nil {
+			return err
+		}
+		existed = count > 0
+	}
+
+	if clientConfig.keepOld && existed {
+		var count int
+		err := tx.QueryRow("select count(*) from information_schema.tables where table_schema = ? and table_name = ?", downloadInfo.schema, downloadInfo.table+oldSuffix).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%s already exists, drop or rename it to restore the table with -keepOld", downloadInfo.schema+"."+downloadInfo.table+oldSuffix)
+		}
+
+		_, err = execMDL(tx, clientConfig, downloadInfo, "rename table "+addQuotes(downloadInfo.table)+" to "+addQuotes(downloadInfo.table+oldSuffix))
+		if err != nil {
+			return err
+		}
+		kept = true
+	}
+
+	_, err := execMDL(tx, clientConfig, downloadInfo, "drop table if exists "+addQuotes(downloadInfo.table))
+	if err != nil {
+		return err
+	}
+
+	err = undo.replacedTable(downloadInfo.schema, downloadInfo.table, existed, kept)
+	if err != nil {
+		return fmt.Errorf("Unable to add %s.%s to the undo script - %s", downloadInfo.schema, downloadInfo.table, err)
+	}
+
+	return nil
+}
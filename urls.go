@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// serverURL returns the base URL of a trite server without a trailing slash. -triteServer may be a host name or ip reached with -triteServerScheme, or a URL with a scheme and path prefix for servers behind a reverse proxy which is used as given without -tritePort.
+func serverURL(server string, port string) string {
+	if !strings.Contains(server, "://") {
+		// A port given with the server, such as host:12001 or [fd00::5]:12001, overrides -tritePort
+		if host, serverPort, err := net.SplitHostPort(server); err == nil {
+			return serverScheme + "://" + net.JoinHostPort(host, serverPort)
+		}
+
+		return serverScheme + "://" + net.JoinHostPort(strings.Trim(server, "[]"), port)
+	}
+
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(server, "/")
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// joinURL appends path segments to a base URL. Each segment is escaped so schema and table names containing characters such as # ? % or spaces are requested as they are named.
+func joinURL(base string, segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	return strings.TrimRight(base, "/") + "/" + strings.Join(escaped, "/")
+}
+
+// dirURL returns the URL of a directory listing, http.FileServer redirects directories without a trailing slash
+func dirURL(base string, segments ...string) string {
+	return joinURL(base, segments...) + "/"
+}
+
+// serverURL returns the URL of a trite server endpoint
+func (clientConfig clientConfigStruct) serverURL(segments ...string) string {
+	return joinURL(serverURL(clientConfig.triteServerURL, clientConfig.triteServerPort), segments...)
+}
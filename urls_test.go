@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestServerURL(t *testing.T) {
+	defer func(scheme string) { serverScheme = scheme }(serverScheme)
+	serverScheme = "http"
+
+	tests := []struct {
+		server   string
+		port     string
+		expected string
+	}{
+		{"server1", "12000", "http://server1:12000"},
+		{"server1.example.com", "12000", "http://server1.example.com:12000"},
+		{"10.0.0.5", "12000", "http://10.0.0.5:12000"},
+		{"server1:12001", "12000", "http://server1:12001"},
+		{"10.0.0.5:12001", "12000", "http://10.0.0.5:12001"},
+		{"fd00::5", "12000", "http://[fd00::5]:12000"},
+		{"::1", "12000", "http://[::1]:12000"},
+		{"[fd00::5]", "12000", "http://[fd00::5]:12000"},
+		{"[fd00::5]:12001", "12000", "http://[fd00::5]:12001"},
+		{"https://proxy.example.com", "12000", "https://proxy.example.com"},
+		{"https://proxy.example.com/", "12000", "https://proxy.example.com"},
+		{"https://proxy.example.com/trite/", "12000", "https://proxy.example.com/trite"},
+		{"https://proxy.example.com:8443/a/trite", "12000", "https://proxy.example.com:8443/a/trite"},
+		{"https://[fd00::5]:8443/trite/", "12000", "https://[fd00::5]:8443/trite"},
+		{"https://proxy.example.com/my%20trite/", "12000", "https://proxy.example.com/my%20trite"},
+	}
+
+	for _, tt := range tests {
+		if u := serverURL(tt.server, tt.port); u != tt.expected {
+			t.Errorf("serverURL(%q, %q) = %q, expected %q", tt.server, tt.port, u, tt.expected)
+		}
+	}
+
+	serverScheme = "https"
+	if u := serverURL("server1", "12000"); u != "https://server1:12000" {
+		t.Errorf("serverURL with -triteServerScheme=https = %q", u)
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base     string
+		segments []string
+		expected string
+	}{
+		{"http://server1:12000", []string{"tables", "shop", "orders.sql"}, "http://server1:12000/tables/shop/orders.sql"},
+		{"https://proxy.example.com/trite/", []string{"backups", "shop", "orders.ibd"}, "https://proxy.example.com/trite/backups/shop/orders.ibd"},
+		{"http://[fd00::5]:12000", []string{"sums"}, "http://[fd00::5]:12000/sums"},
+		{"http://server1:12000", []string{"tables", "shop", "a#b.sql"}, "http://server1:12000/tables/shop/a%23b.sql"},
+		{"http://server1:12000", []string{"tables", "shop", "a?b.sql"}, "http://server1:12000/tables/shop/a%3Fb.sql"},
+		{"http://server1:12000", []string{"tables", "shop", "50%.sql"}, "http://server1:12000/tables/shop/50%25.sql"},
+		{"http://server1:12000", []string{"tables", "my shop", "order items.sql"}, "http://server1:12000/tables/my%20shop/order%20items.sql"},
+		{"http://server1:12000", []string{"tables", "a/b"}, "http://server1:12000/tables/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		if u := joinURL(tt.base, tt.segments...); u != tt.expected {
+			t.Errorf("joinURL(%q, %q) = %q, expected %q", tt.base, tt.segments, u, tt.expected)
+		}
+	}
+
+	if u := dirURL("http://server1:12000", "tables", "my shop"); u != "http://server1:12000/tables/my%20shop/" {
+		t.Errorf("dirURL = %q", u)
+	}
+}
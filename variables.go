@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// saveVariables returns the current values of session or global variables before they are changed. Variables the server does not have are skipped.
+func saveVariables(q sqlQueryer, scope string, names ...string) map[string]string {
+	saved := make(map[string]string)
+	for _, name := range names {
+		rows, err := q.Query("select @@" + scope + "." + name)
+		if err != nil {
+			continue
+		}
+
+		var value sql.NullString
+		if rows.Next() {
+			err = rows.Scan(&value)
+		}
+		rows.Close()
+		if err == nil && value.Valid {
+			saved[name] = value.String
+		}
+	}
+
+	return saved
+}
+
+// restoreVariables sets variables back to the values saveVariables returned, every variable is restored even when one fails and the first error is returned
+func restoreVariables(e sqlExecer, scope string, saved map[string]string) error {
+	var firstErr error
+	for name, value := range saved {
+		_, err := execSQL(e, "set "+scope+" "+name+" = "+variableValue(value))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// variableValue returns a saved value as a SQL literal, numbers are not quoted as boolean variables only accept ON, OFF, 1 or 0
+func variableValue(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
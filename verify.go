@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// backupCheckStruct stores the result of checking a backup directory
+type backupCheckStruct struct {
+	backupType string
+	tables     int
+	exported   bool
+	problems   []string
+}
+
+// startVerify checks a backup directory is complete and prepared for transporting without starting a server. With a dump path the dump files are also checked against the dump checksums. The process exits 1 when problems are found.
+func startVerify(backupPath string, dumpPath string) {
+	fmt.Println("Verifying backup:", backupPath)
+	fmt.Println()
+
+	check, err := checkBackup(backupPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Xtrabackup records no checksums of the backup files, only the dump has them
+	var dumpFiles int
+	if dumpPath != "" {
+		var problems []string
+		dumpFiles, problems, err = checkDumpSums(dumpPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		check.problems = append(check.problems, problems...)
+	}
+
+	for _, problem := range check.problems {
+		fmt.Println("PROBLEM:", problem)
+	}
+
+	fmt.Println()
+	fmt.Println("Backup type:", check.backupType)
+	if dumpPath != "" {
+		fmt.Println(dumpFiles, "dump files checked against", dumpSumsFile)
+	}
+	fmt.Println(check.tables, "tables checked,", len(check.problems), "problems found")
+
+	if len(check.problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkBackup verifies xtrabackup metadata and the presence of every file needed to transport each table in a backup directory. It is run by verify mode and at server startup.
+func checkBackup(backupPath string) (backupCheckStruct, error) {
+	var check backupCheckStruct
+
+	// The backup must be fully prepared, otherwise tablespaces are inconsistent
+	backupType, err := xtrabackupValue(filepath.Join(backupPath, "xtrabackup_checkpoints"), "backup_type")
+	if err != nil {
+		check.problems = append(check.problems, "xtrabackup_checkpoints could not be read - "+err.Error())
+	} else if backupType != "full-prepared" {
+		check.problems = append(check.problems, "backup_type is "+backupType+", the backup has not been fully prepared with --apply-log --export")
+	}
+	check.backupType = backupType
+
+	results, err := checkSchemaDirs(backupPath)
+	if err != nil {
+		return check, err
+	}
+
+	var names []string
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		check.tables += results[name].Tables
+		check.exported = check.exported || results[name].Exported
+		for _, problem := range results[name].Problems {
+			check.problems = append(check.problems, name+"."+problem)
+		}
+	}
+
+	return check, nil
+}
+
+// checkSchemaFiles confirms each table in a schema directory has the files trite needs to transport it
+func checkSchemaFiles(dir string) (schemaCheckStruct, error) {
+	var check schemaCheckStruct
+
+	d, err := os.Stat(dir)
+	if err != nil {
+		return check, err
+	}
+	check.ModTime = d.ModTime().UnixNano()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return check, err
+	}
+
+	// Group file extensions by table
+	tables := make(map[string]map[string]bool)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		// Encrypted backups have .xbcrypt appended to each file
+		name, ext := parseFileName(strings.TrimSuffix(file.Name(), xbcryptExtension))
+		if tables[name] == nil {
+			tables[name] = make(map[string]bool)
+		}
+		tables[name][ext] = true
+	}
+
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		exts := tables[name]
+		check.Exported = check.Exported || exts["exp"]
+		switch {
+		case exts["ibd"]:
+			check.Tables++
+			if !exts["exp"] && !exts["cfg"] {
+				check.Problems = append(check.Problems, name+" is missing the .exp/.cfg file created by --export")
+			}
+		case exts["MYD"]:
+			check.Tables++
+			if !exts["MYI"] {
+				check.Problems = append(check.Problems, name+" is missing its .MYI file")
+			}
+			if !exts["frm"] {
+				check.Problems = append(check.Problems, name+" is missing its .frm file")
+			}
+		}
+	}
+
+	return check, nil
+}
+
+// xtrabackupValue returns the value of a key from an xtrabackup metadata file such as xtrabackup_checkpoints
+func xtrabackupValue(file string, key string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == key {
+			return strings.TrimSpace(kv[1]), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s not found in %s", key, file)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// schemaCheckStruct is the result of checking one schema directory of a backup. ModTime is the directory mtime the result is valid for,
+// adding, removing or renaming files changes it.
+type schemaCheckStruct struct {
+	ModTime  int64    `json:"modTime"`
+	Tables   int      `json:"tables"`
+	Problems []string `json:"problems"`
+	Exported bool     `json:"exported"`
+}
+
+// verifyCacheFile returns where schema check results for a backup are cached. The backup itself may be read only so the user cache directory is used.
+func verifyCacheFile(backupPath string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	abs, _ := filepath.Abs(backupPath)
+	sum := sha256.Sum256([]byte(abs))
+
+	return filepath.Join(dir, "trite", "verify-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// checkSchemaDirs checks every schema directory of a backup in parallel. Directories whose mtime has not changed since the last check reuse the cached result.
+func checkSchemaDirs(backupPath string) (map[string]schemaCheckStruct, error) {
+	dirs, err := ioutil.ReadDir(backupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheFile := verifyCacheFile(backupPath)
+	cached := make(map[string]schemaCheckStruct)
+	if b, err := ioutil.ReadFile(cacheFile); err == nil {
+		json.Unmarshal(b, &cached)
+	}
+
+	var names []string
+	results := make(map[string]schemaCheckStruct)
+	for _, dir := range dirs {
+		if !dir.IsDir() || dir.Name() == "mysql" || dir.Name() == "performance_schema" {
+			continue
+		}
+
+		if c, ok := cached[dir.Name()]; ok && c.ModTime == dir.ModTime().UnixNano() {
+			results[dir.Name()] = c
+		} else {
+			names = append(names, dir.Name())
+		}
+	}
+
+	// Check the changed directories with a pool of workers
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	var done int
+	work := make(chan string)
+	for i := 0; i < runtime.NumCPU()*2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range work {
+				check, err := checkSchemaFiles(filepath.Join(backupPath, name))
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				results[name] = check
+				done++
+				fmt.Fprintf(os.Stderr, "Checked %d/%d changed schema directories\r", done, len(names))
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		work <- name
+	}
+	close(work)
+	wg.Wait()
+
+	if len(names) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// Save the results for the next start, a cache that cannot be written only costs time
+	if cacheFile != "" {
+		if b, err := json.Marshal(results); err == nil {
+			os.MkdirAll(filepath.Dir(cacheFile), dirPerms)
+			ioutil.WriteFile(cacheFile, b, filePerms)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// warmBufferPool reads every index of the listed schema.table names so restored hot tables are in the buffer pool before applications use them
+func warmBufferPool(db *sql.DB, tables []string) {
+	for _, fqTable := range tables {
+		names := strings.SplitN(fqTable, ".", 2)
+		if len(names) != 2 {
+			warnf(levelWarn, "%s must be in schema.table format to warm the buffer pool", fqTable)
+			continue
+		}
+
+		start := time.Now()
+		err := warmTable(db, names[0], names[1])
+		if err != nil {
+			warnf(levelWarn, "Unable to warm the buffer pool for %s - %s", fqTable, err)
+			continue
+		}
+		fmt.Println("Warmed:", fqTable, "in", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// warmTable scans each index of a table, scanning the primary key reads the clustered index and with it all table data
+func warmTable(db *sql.DB, schema string, table string) error {
+	rows, err := db.Query("select distinct index_name from information_schema.statistics where table_schema = ? and table_name = ?", schema, table)
+	if err != nil {
+		return err
+	}
+
+	var indexes []string
+	for rows.Next() {
+		var index string
+		err = rows.Scan(&index)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+
+	fqTable := addQuotes(schema) + "." + addQuotes(table)
+	if len(indexes) == 0 {
+		// Tables without indexes are read with a full scan
+		_, err = execSQL(db, "select count(*) from "+fqTable)
+		return err
+	}
+
+	for _, index := range indexes {
+		_, err = execSQL(db, "select count(*) from "+fqTable+" force index ("+addQuotes(index)+")")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
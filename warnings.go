@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Warning levels from least to most severe
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// exitWarnings is the exit code used when a run finished with warnings at or above -failOnWarn
+const exitWarnings = 3
+
+// warningLevels orders the levels by severity
+var warningLevels = map[string]int{levelInfo: 1, levelWarn: 2, levelError: 3}
+
+// warningStruct is a problem that did not stop a table, object or dump from completing
+type warningStruct struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// warningsStruct collects the warnings of a run so automation can fail a pipeline on them with -failOnWarn
+type warningsStruct struct {
+	mu     sync.Mutex
+	list   []warningStruct
+	failOn string
+}
+
+// warnings are the warnings of the current run
+var warnings = &warningsStruct{}
+
+// warnf records a warning and prints it, info with the other messages of the mode and warnings and errors to stderr
+func warnf(level string, format string, a ...interface{}) {
+	w := warningStruct{Time: time.Now().Format(time.RFC3339), Level: level, Message: fmt.Sprintf(format, a...)}
+	journal.printf("WARNING", "%s %s", w.Level, w.Message)
+
+	warnings.mu.Lock()
+	warnings.list = append(warnings.list, w)
+	warnings.mu.Unlock()
+
+	switch level {
+	case levelInfo:
+		fmt.Fprintln(dumpMessages(), "INFO:", w.Message)
+	case levelWarn:
+		fmt.Fprintln(os.Stderr, "WARNING:", w.Message)
+	default:
+		fmt.Fprintln(os.Stderr, "ERROR:", w.Message)
+	}
+}
+
+// setFailOnWarn sets the lowest warning level that fails the run, a blank level never fails it
+func (ws *warningsStruct) setFailOnWarn(level string) error {
+	if _, ok := warningLevels[level]; !ok && level != "" {
+		return fmt.Errorf("-failOnWarn must be info, warn or error")
+	}
+	ws.failOn = level
+
+	return nil
+}
+
+// all returns a copy of the recorded warnings
+func (ws *warningsStruct) all() []warningStruct {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return append([]warningStruct(nil), ws.list...)
+}
+
+// failed returns the number of warnings at or above -failOnWarn
+func (ws *warningsStruct) failed() int {
+	if ws.failOn == "" {
+		return 0
+	}
+
+	var count int
+	for _, w := range ws.all() {
+		if warningLevels[w.Level] >= warningLevels[ws.failOn] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// exitOnWarnings exits with exitWarnings when warnings at or above -failOnWarn were recorded
+func (ws *warningsStruct) exitOnWarnings() {
+	if count := ws.failed(); count > 0 {
+		fmt.Fprintln(os.Stderr, count, "warnings of level", ws.failOn, "or above were recorded, failing because of -failOnWarn")
+		os.Exit(exitWarnings)
+	}
+}
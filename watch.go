@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// startWatch polls a trite server serving a catalog and restores each new backup generation as it appears. The last restored generation is kept in stateFile so a restarted watcher does not refresh again.
+// Each restore runs as a child trite process so a fatal error in one restore does not end the watch, and a generation is only recorded once it was restored without errors.
+func startWatch(clientConfig clientConfigStruct, dbi *mysqlCredentials, f *flag.FlagSet, interval time.Duration, stateFile string) {
+	last, _ := ioutil.ReadFile(stateFile)
+	restored := strings.TrimSpace(string(last))
+	if restored != "" {
+		fmt.Println("Last restored generation:", restored)
+	}
+
+	flags, err := watchFlags(f, dbi)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read the password -", err)
+		os.Exit(1)
+	}
+
+	for {
+		generation, err := fetchGeneration(clientConfig)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "Unable to check the server generation -", err)
+		} else if generation == "" {
+			fmt.Fprintln(os.Stderr, "The trite server is not serving a catalog, start it with -catalogPath to use -watch")
+			os.Exit(1)
+		} else if generation != restored {
+			fmt.Println()
+			fmt.Println(time.Now().Format(time.RFC3339), "Restoring generation", generation)
+
+			step := make(map[string]string)
+			for name, value := range flags {
+				step[name] = value
+			}
+			code := runPlanStep(generation, step, false)
+
+			// The server may have moved to a newer generation during the restore, which is restored by the next check
+			after, err := fetchGeneration(clientConfig)
+			switch {
+			case code != 0:
+				fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "Restore of generation", generation, "exited with code", code, "- it is restored again at the next check")
+			case err != nil || after != generation:
+				fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), "The trite server changed generation during the restore of", generation, "- restoring again at the next check")
+			default:
+				restored = generation
+				err = ioutil.WriteFile(stateFile, []byte(generation+"\n"), filePerms)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Unable to record the restored generation in", stateFile, "-", err)
+				}
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// watchFlags returns the flags of the watcher a child restores once with. Children run without stdin, so a password they would prompt for is read once here.
+func watchFlags(f *flag.FlagSet, dbi *mysqlCredentials) (map[string]string, error) {
+	flags := make(map[string]string)
+	f.Visit(func(fl *flag.Flag) {
+		flags[fl.Name] = fl.Value.String()
+	})
+	for _, name := range []string{"watchInterval", "watchState", "plan"} {
+		delete(flags, name)
+	}
+	flags["watch"] = "false"
+	flags["client"] = "true"
+
+	if dbi.pass == "" || dbi.pass == "-" {
+		pwd, err := readPassword()
+		if err != nil {
+			return nil, err
+		}
+		dbi.pass = pwd
+	}
+	flags["pass"] = dbi.pass
+
+	return flags, nil
+}
+
+// fetchGeneration returns the id of the generation a trite server is serving
+func fetchGeneration(clientConfig clientConfigStruct) (string, error) {
+	url := clientConfig.serverURL("generation")
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%d returned from %s", resp.StatusCode, url)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
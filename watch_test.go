@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+// childPasswordEnv makes the test binary act as a child restore that checks the password it was given
+const childPasswordEnv = "TRITE_TEST_CHILD_PASSWORD"
+
+func TestMain(m *testing.M) {
+	if expected := os.Getenv(childPasswordEnv); expected != "" {
+		// A child restore takes MYSQL_PWD and otherwise reads the password like connect does
+		pass := os.Getenv("MYSQL_PWD")
+		if pass == "" {
+			pwd, err := readPassword()
+			if err != nil {
+				os.Exit(2)
+			}
+			pass = pwd
+		}
+		if pass != expected {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// withStdin runs fn with stdin replaced by a pipe containing input, as when no terminal is attached
+func withStdin(t *testing.T, input string, fn func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	_, err = w.WriteString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin = r
+	fn()
+}
+
+func TestWatchPassword(t *testing.T) {
+	defer os.Setenv("MYSQL_PWD", os.Getenv("MYSQL_PWD"))
+	os.Unsetenv("MYSQL_PWD")
+	defer os.Unsetenv(childPasswordEnv)
+	os.Setenv(childPasswordEnv, "secret")
+
+	tests := []struct {
+		name  string
+		pass  string
+		stdin string
+	}{
+		{"no password", "", "secret\n"},
+		{"password from stdin", "-", "secret\n"},
+		{"password given", "secret", ""},
+	}
+
+	for _, tt := range tests {
+		f := flag.NewFlagSet("trite", flag.ContinueOnError)
+		f.String("user", "", "")
+		f.String("pass", "", "")
+		f.Bool("watch", false, "")
+		err := f.Parse([]string{"-user=restore", "-pass=" + tt.pass, "-watch"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Children have no stdin, they only get the password the watcher resolved
+		dbi := mysqlCredentials{user: "restore", pass: tt.pass}
+		var flags map[string]string
+		withStdin(t, tt.stdin, func() {
+			flags, err = watchFlags(f, &dbi)
+		})
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if flags["watch"] != "false" || flags["client"] != "true" {
+			t.Errorf("%s: child flags %v do not disable watch mode", tt.name, flags)
+		}
+
+		for i := 0; i < 2; i++ {
+			code := runPlanStep("watch", copyFlags(flags), false)
+			if code != 0 {
+				t.Errorf("%s: restore %d exited with code %d, expected the password secret", tt.name, i+1, code)
+			}
+		}
+	}
+}
+
+// copyFlags returns a copy of flags since runPlanStep removes the ones passed through the environment
+func copyFlags(flags map[string]string) map[string]string {
+	c := make(map[string]string)
+	for name, value := range flags {
+		c[name] = value
+	}
+	return c
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// xbcryptExtension is appended to files encrypted by xtrabackup --encrypt or xbcrypt
+const xbcryptExtension = ".xbcrypt"
+
+// keyIDHeader identifies the key a decrypted file was served with
+const keyIDHeader = "X-Trite-Key-Id"
+
+// xbcryptSize returns the decrypted size of an xbcrypt file by adding up the original size of every chunk
+func xbcryptSize(file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var total int64
+	for {
+		// magic, reserved, original size, encrypted size & checksum
+		var hdr [36]byte
+		_, err = io.ReadFull(r, hdr[:])
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if string(hdr[:7]) != "XBCRYP0" {
+			return 0, fmt.Errorf("%s is not an xbcrypt file", file)
+		}
+
+		origSize := binary.LittleEndian.Uint64(hdr[16:24])
+		skip := int64(binary.LittleEndian.Uint64(hdr[24:32]))
+
+		// Format versions 2 and later store an IV with each chunk
+		if hdr[7] >= '2' {
+			var ivSize [8]byte
+			_, err = io.ReadFull(r, ivSize[:])
+			if err != nil {
+				return 0, err
+			}
+			skip += int64(binary.LittleEndian.Uint64(ivSize[:]))
+		}
+
+		_, err = io.CopyN(ioutil.Discard, r, skip)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(origSize)
+	}
+}
+
+// decryptHandler serves encrypted backup files decrypted with xbcrypt. A request for a file that only exists with the .xbcrypt extension is decrypted on the fly,
+// any other request is passed to h so encrypted and plaintext backups can be served the same way.
+func decryptHandler(backupPath string, key backupKeyStruct, algo string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := filepath.Join(backupPath, filepath.FromSlash(filepath.Clean("/"+r.URL.Path)))
+		if _, err := os.Stat(file); err == nil || strings.HasSuffix(file, xbcryptExtension) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		encrypted := file + xbcryptExtension
+		size, err := xbcryptSize(encrypted)
+		if os.IsNotExist(err) {
+			h.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The key id lets clients record which key their data was decrypted with
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set(keyIDHeader, key.id)
+		if r.Method == "HEAD" {
+			return
+		}
+
+		cmd := exec.Command("xbcrypt")
+		keyArg, err := key.xbcryptKeyArgs(cmd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cmd.Args = append(cmd.Args, "--decrypt", "--encrypt-algo="+algo, keyArg, "--input="+encrypted)
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		for _, f := range cmd.ExtraFiles {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Decrypting", encrypted, "-", err)
+		}
+	})
+}